@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/jiro4989/arth/internal/options"
+	arthio "github.com/jiro4989/arth/io"
+	arthmath "github.com/jiro4989/arth/math"
+)
+
+// chunkSize は1つのファイルを分割して並列に集計するときの、1つの範囲の最小のバイト数です。
+// 小さいファイルは分割すると並列化の負荷のほうが大きいので、分割しない。
+var chunkSize int64 = 16 << 20
+
+// accumulateFile はファイルを集計し、出力データごとの集計結果を返す。
+// 大きなファイルは行の境界でworkers個以下の範囲に分割し、並列に集計して併合する。
+// 分割しても、ファイル全体を順に集計した場合と同じ順番、同じ統計値になる
+// (分散の浮動小数点の誤差と、--approxの近似の誤差を除く)。
+// 圧縮されたファイル、分割できない入力はarthio.WithOpenで開いて順に集計する。
+func accumulateFile(fn string, opts options.Options, conf arthmath.MinMaxSumAvgConfig, workers int) ([]accumulated, error) {
+	if splittable(conf) {
+		as, ok, err := accumulateSplit(fn, opts, conf, workers)
+		if ok || err != nil {
+			return as, err
+		}
+	}
+
+	var as []accumulated
+	_, err := arthio.WithOpen(fn, func(r io.Reader) ([]options.OutValues, error) {
+		var err error
+		as, err = accumulateAll(r, opts, conf)
+		return nil, err
+	})
+	return as, err
+}
+
+// accumulateSplit はファイルを行の境界で分割できれば、範囲ごとに並列に集計する。
+// 分割できないファイルは集計せずにokをfalseで返す。
+func accumulateSplit(fn string, opts options.Options, conf arthmath.MinMaxSumAvgConfig, workers int) (as []accumulated, ok bool, err error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+
+	header, chunks, err := arthio.SplitFile(f, fn, conf.HeaderRows(), workers, chunkSize)
+	if err != nil || chunks == nil {
+		return nil, false, err
+	}
+	as, err = accumulateChunks(f, header, chunks, opts, conf)
+	return as, true, err
+}
+
+// splittable は入力を行の境界で分割して集計できるか否かを返す。
+// CSVはクォートされたフィールドに改行を含みうるので分割しない。
+// 同じフィールドを重複して指定したときは、併合で区別できないので分割しない。
+func splittable(conf arthmath.MinMaxSumAvgConfig) bool {
+	if conf.CSV {
+		return false
+	}
+	seen := make(map[arthmath.Field]bool)
+	for _, f := range conf.Fields {
+		if seen[f] {
+			return false
+		}
+		seen[f] = true
+	}
+	return true
+}
+
+// accumulateChunks はファイルの範囲ごとに並列に集計し、範囲の順に併合する。
+// 各範囲の先頭にヘッダを付け直すので、ヘッダ名によるフィールド指定、
+// 無視する行の指定は範囲ごとに同じように解決する。
+// 集計したデータは範囲の順に連結するので、ソート済みの入力は併合後もソート済みになる。
+// 集計キーは最初に現れた範囲の順、複数フィールドはフィールドの指定順に並べる。
+func accumulateChunks(f io.ReaderAt, header []byte, chunks []arthio.Chunk, opts options.Options, conf arthmath.MinMaxSumAvgConfig) ([]accumulated, error) {
+	var wg sync.WaitGroup
+	ass := make([][]accumulated, len(chunks))
+	errs := make([]error, len(chunks))
+	for i, c := range chunks {
+		wg.Add(1)
+		go func(i int, c arthio.Chunk) {
+			defer wg.Done()
+			r := io.MultiReader(bytes.NewReader(header), io.NewSectionReader(f, c.Offset, c.Size))
+			ass[i], errs[i] = accumulateAll(r, opts, conf)
+		}(i, c)
+	}
+	wg.Wait()
+
+	// ヘッダ名が見つからないときなど、すべての範囲で同じエラーになるので最初のエラーを返す
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	merged, err := mergeAccumulated(ass, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.MultiFields() {
+		pos := make(map[options.Field]int)
+		for i, f := range fieldsOf(merged) {
+			pos[f] = i
+		}
+		sort.SliceStable(merged, func(i, j int) bool {
+			fi := options.Field{Index: merged[i].fieldIndex, Name: merged[i].fieldName}
+			fj := options.Field{Index: merged[j].fieldIndex, Name: merged[j].fieldName}
+			return pos[fi] < pos[fj]
+		})
+	}
+	return merged, nil
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/jiro4989/arth/internal/options"
+	arthio "github.com/jiro4989/arth/io"
+	arthmath "github.com/jiro4989/arth/math"
+)
+
+// runFollow は入力ファイルを追跡し、中断(SIGINT, SIGTERM)されるまで
+// 一定の間隔で集計結果を出力して、終了コードを返す。
+func runFollow(args []string, opts options.Options) int {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	stop := make(chan struct{})
+	go func() {
+		<-sig
+		close(stop)
+	}()
+
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	return follow(args, opts, ticker.C, stop, out)
+}
+
+// follow は入力ファイルを追跡し、開始時とtickを受け取るたびに集計結果を出力する。
+// stopが閉じられたら、それまでに追記された行を集計して出力してから終了する。
+// 処理に失敗したファイルはエラーを出力して追跡をやめ、他のファイルの追跡は継続する。
+func follow(args []string, opts options.Options, tick <-chan time.Time, stop <-chan struct{}, w func([]string, options.Options) error) int {
+	// 追記された行を連結して集計するので、ソート済みとはみなさない
+	opts.SortedFlag = false
+
+	fs := make([]*followedFile, len(args))
+	for i, fn := range args {
+		spath := options.SeparatableFilePath{FieldIndex: 1}
+		if 0 < len(opts.SeparatableFilePath) {
+			spath = opts.SeparatableFilePath[i]
+		}
+		fs[i] = newFollowedFile(fn, newConfig(opts, spath))
+		defer fs[i].tail.Close()
+	}
+
+	code := exitCodeOK
+	emit := func() bool {
+		ovs, err := pollFollowedFiles(fs, opts)
+		if err != nil {
+			logger.Println(err)
+			code = exitCodeInputError
+		}
+		lines, err := options.Format(ovs, opts)
+		if err == nil {
+			err = w(lines, opts)
+		}
+		if err != nil {
+			logger.Println(err)
+			code = exitCodeInputError
+			return false
+		}
+		return true
+	}
+
+	if !emit() {
+		return code
+	}
+	for {
+		select {
+		case <-tick:
+			if !emit() {
+				return code
+			}
+		case <-stop:
+			emit()
+			return code
+		}
+	}
+}
+
+// followedFile は--followで追跡する入力ファイルと、その集計結果です。
+type followedFile struct {
+	fileName string
+	conf     arthmath.MinMaxSumAvgConfig
+	tail     *arthio.Tail
+	// header はファイルの先頭の、ヘッダあるいは無視する行です。
+	// 追記された行の前に付け直して、ヘッダ名によるフィールド指定を解決する。
+	header     []byte
+	headerRows int
+	// pending はCSVの改行を含むレコードのうち、残りがまだ追記されていない部分です。
+	// 次に追記された行の前に付け直して、1つのレコードとして集計する。
+	pending []byte
+	// as は開始からの累計の集計結果です。
+	as []accumulated
+	// err は処理に失敗したときのエラーです。失敗したファイルは追跡しない。
+	err error
+}
+
+func newFollowedFile(fn string, conf arthmath.MinMaxSumAvgConfig) *followedFile {
+	return &followedFile{
+		fileName: fn,
+		conf:     conf,
+		tail:     arthio.NewTail(fn),
+	}
+}
+
+// read は前回から追記された行を集計する。
+// ファイルを開き直したときは、新しいファイルの先頭の行をヘッダとして保持し直す。
+// 古いファイルの途中までのCSVのレコードは、残りが追記されないので捨てる。
+// 圧縮されたファイルは追記された行を区切れないのでエラーを返す。
+// CSVの改行を含むレコードが途中まで追記されたときは、残りが追記されるまで集計しない。
+func (f *followedFile) read(opts options.Options) ([]accumulated, error) {
+	b, reopened, err := f.tail.ReadLines()
+	if err != nil {
+		return nil, err
+	}
+	if reopened {
+		if err := checkNotCompressed(f.fileName); err != nil {
+			return nil, err
+		}
+		f.header = nil
+		f.headerRows = 0
+		f.pending = nil
+	}
+	if 0 < len(f.pending) {
+		b = append(f.pending, b...)
+		f.pending = nil
+	}
+	for f.headerRows < f.conf.HeaderRows() && 0 < len(b) {
+		i := bytes.IndexByte(b, '\n')
+		f.header = append(f.header, b[:i+1]...)
+		f.headerRows++
+		b = b[i+1:]
+	}
+	if f.conf.CSV {
+		i := csvRecordsEnd(b, f.conf.Delimiter)
+		f.pending = append([]byte(nil), b[i:]...)
+		b = b[:i]
+	}
+
+	r := io.MultiReader(bytes.NewReader(f.header), bytes.NewReader(b))
+	return accumulateAll(r, opts, f.conf)
+}
+
+// checkNotCompressed はファイルが圧縮されていればエラーを返す。
+func checkNotCompressed(fn string) error {
+	c, err := arthio.DetectFileCompression(fn)
+	if err != nil {
+		return err
+	}
+	if c != arthio.CompressionNone {
+		return errors.New("compressed files are not available with --follow.")
+	}
+	return nil
+}
+
+// csvRecordsEnd は改行で終わる行の連なりのうち、完結したCSVのレコードの終わりの位置を返す。
+// 最後のレコードがクォートされたフィールドの途中で終わっていれば、そのレコードの先頭を返す。
+// クォートはフィールドの先頭にあるときのみクォートとみなし、RFC 4180と同じく""はエスケープとする。
+func csvRecordsEnd(b []byte, comma string) int {
+	end := 0
+	quoted := false
+	fieldStart := true
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		if quoted {
+			if c == '"' {
+				if i+1 < len(b) && b[i+1] == '"' {
+					i++
+					continue
+				}
+				quoted = false
+			}
+			continue
+		}
+		switch {
+		case c == '"' && fieldStart:
+			quoted = true
+			fieldStart = false
+		case c == '\n':
+			end = i + 1
+			fieldStart = true
+		case comma != "" && bytes.HasPrefix(b[i:], []byte(comma)):
+			i += len(comma) - 1
+			fieldStart = true
+		default:
+			fieldStart = false
+		}
+	}
+	return end
+}
+
+// pollFollowedFiles は追跡しているファイルの追記された行を集計し、出力データを返す。
+// FollowModeがcumulativeのときは開始からの累計、intervalのときは今回追記された分を返す。
+// 処理に失敗したファイルは出力データに含めず、ファイルごとのエラーをinputErrorで返す。
+func pollFollowedFiles(fs []*followedFile, opts options.Options) ([]options.OutValues, error) {
+	var ovs []options.OutValues
+	var ierr inputError
+	for _, f := range fs {
+		if f.err != nil {
+			continue
+		}
+
+		as, err := f.read(opts)
+		if err == nil && opts.FollowMode != options.FollowModeInterval {
+			f.as, err = mergeAccumulated([][]accumulated{f.as, as}, opts)
+			as = f.as
+		}
+		var vs []options.OutValues
+		if err == nil {
+			vs, err = newOutValues(as, opts)
+		}
+		if err != nil {
+			f.err = err
+			f.tail.Close()
+			ierr = append(ierr, fileError{fileName: f.fileName, err: err})
+			continue
+		}
+
+		for i := range vs {
+			vs[i].FileName = f.fileName
+		}
+		ovs = append(ovs, vs...)
+	}
+	if 0 < len(ierr) {
+		return ovs, ierr
+	}
+	return ovs, nil
+}
@@ -0,0 +1,216 @@
+package options
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Assertion は出力データに対する閾値の条件(p99<250, avg<=100)です。
+type Assertion struct {
+	// Stat は条件の対象の統計値のヘッダ名です。
+	// パーセンタイル値のときはPercentileに値をセットする。
+	Stat string
+	// Percentile は条件の対象のパーセンタイル(1~100)です。
+	Percentile float64
+	// Op は比較演算子(<, <=, >, >=, ==, !=)です。
+	Op string
+	// Value は閾値です。
+	Value float64
+}
+
+// assertionOps は比較演算子の一覧です。
+// 2文字の演算子を先に判定する。
+var assertionOps = []string{"<=", ">=", "==", "!=", "<", ">"}
+
+// assertionStats は条件に指定できる、パーセンタイル値以外の統計値の一覧です。
+var assertionStats = []string{
+	HeaderCount,
+	HeaderMin,
+	HeaderMax,
+	HeaderSum,
+	HeaderAverage,
+	HeaderMedian,
+	HeaderVariance,
+	HeaderSampleVariance,
+	HeaderStdDev,
+	HeaderSampleStdDev,
+}
+
+// UnmarshalFlag は統計値、比較演算子、閾値の順の条件を解析する。
+// パーセンタイル値はp99, p99.9, 99percentileのように指定する。
+func (a *Assertion) UnmarshalFlag(v string) error {
+	i := strings.IndexAny(v, "<>=!")
+	if i < 0 {
+		msg := fmt.Sprintf("assertion needs an operator. input=%s", v)
+		return errors.New(msg)
+	}
+	var op string
+	for _, o := range assertionOps {
+		if strings.HasPrefix(v[i:], o) {
+			op = o
+			break
+		}
+	}
+	if op == "" {
+		msg := fmt.Sprintf("illegal assertion operator. input=%s", v)
+		return errors.New(msg)
+	}
+
+	stat := strings.TrimSpace(v[:i])
+	s := strings.TrimSpace(v[i+len(op):])
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		msg := fmt.Sprintf("expected that assertion threshold is number. input=%s", v)
+		return errors.New(msg)
+	}
+
+	a.Stat = ""
+	a.Percentile = 0
+	if p, ok := parsePercentileStat(stat); ok {
+		if p <= 0 || 100 < p {
+			msg := fmt.Sprintf("percentile is between 0 and 100. input=%s", v)
+			return errors.New(msg)
+		}
+		a.Stat = HeaderPercentile
+		a.Percentile = p
+	} else {
+		for _, v := range assertionStats {
+			if v == stat {
+				a.Stat = v
+			}
+		}
+	}
+	if a.Stat == "" {
+		msg := fmt.Sprintf("illegal assertion stat. stat=%s available=[%s, pN]", stat, strings.Join(assertionStats, ", "))
+		return errors.New(msg)
+	}
+
+	a.Op = op
+	a.Value = n
+	return nil
+}
+
+func (a Assertion) MarshalFlag() (string, error) {
+	return a.String(), nil
+}
+
+// String は条件をp99<250のような文字列で返す。
+func (a Assertion) String() string {
+	stat := a.Stat
+	if a.Stat == HeaderPercentile {
+		stat = "p" + formatPercentile(a.Percentile)
+	}
+	return stat + a.Op + strconv.FormatFloat(a.Value, 'f', -1, 64)
+}
+
+// parsePercentileStat はp99, 99percentileのようなパーセンタイル値の指定を解析する。
+func parsePercentileStat(s string) (float64, bool) {
+	var ps string
+	switch {
+	case strings.HasPrefix(s, "p"):
+		ps = strings.TrimPrefix(s, "p")
+	case strings.HasSuffix(s, HeaderPercentile):
+		ps = strings.TrimSuffix(s, HeaderPercentile)
+	default:
+		return 0, false
+	}
+	p, err := strconv.ParseFloat(ps, 64)
+	if err != nil {
+		return 0, false
+	}
+	return p, true
+}
+
+// Actual は条件の対象の統計値を出力データから返す。
+func (a Assertion) Actual(v OutValues) float64 {
+	switch a.Stat {
+	case HeaderCount:
+		return float64(v.Count)
+	case HeaderMin:
+		return v.Min
+	case HeaderMax:
+		return v.Max
+	case HeaderSum:
+		return v.Sum
+	case HeaderAverage:
+		return v.Average
+	case HeaderMedian:
+		return v.Median
+	case HeaderPercentile:
+		return v.Percentiles[a.Percentile]
+	case HeaderVariance:
+		return v.Variance
+	case HeaderSampleVariance:
+		return v.SampleVariance
+	case HeaderStdDev:
+		return v.StdDev
+	case HeaderSampleStdDev:
+		return v.SampleStdDev
+	}
+	return 0
+}
+
+// Check は出力データが条件を満たすか否かを返す。
+// 統計値がNaNのときは!=以外の条件を満たさない。
+func (a Assertion) Check(v OutValues) bool {
+	n := a.Actual(v)
+	switch a.Op {
+	case "<":
+		return n < a.Value
+	case "<=":
+		return n <= a.Value
+	case ">":
+		return n > a.Value
+	case ">=":
+		return n >= a.Value
+	case "==":
+		return n == a.Value
+	case "!=":
+		return n != a.Value
+	}
+	return false
+}
+
+// Violation は条件を満たさなかった出力データです。
+type Violation struct {
+	OutValues OutValues
+	Assertion Assertion
+	// MultiFields は複数のフィールドを集計したか否かです。
+	MultiFields bool
+}
+
+// String は違反した入力と条件、実際の値を返す。
+// 複数フィールド、集計キー、時間窓の指定があるときはフィールド、集計キー、時間窓も含める。
+func (v Violation) String() string {
+	ss := make([]string, 0, 4)
+	if v.OutValues.FileName != "" {
+		ss = append(ss, v.OutValues.FileName)
+	}
+	if v.MultiFields {
+		ss = append(ss, "field="+v.OutValues.FieldLabel())
+	}
+	if v.OutValues.GroupKey != "" {
+		ss = append(ss, "group="+v.OutValues.GroupKey)
+	}
+	if !v.OutValues.Window.IsZero() {
+		ss = append(ss, "window="+formatWindow(v.OutValues.Window))
+	}
+	actual := formatFloat(v.Assertion.Actual(v.OutValues))
+	return fmt.Sprintf("assertion failed: %s: %s actual=%s", strings.Join(ss, " "), v.Assertion, actual)
+}
+
+// CheckAssertions はすべての出力データについて条件を判定し、
+// 満たさなかった条件を出力データの順番に返す。
+func CheckAssertions(vs []OutValues, opts Options) []Violation {
+	var vls []Violation
+	for _, v := range vs {
+		for _, a := range opts.Assertions {
+			if !a.Check(v) {
+				vls = append(vls, Violation{OutValues: v, Assertion: a, MultiFields: opts.MultiFields()})
+			}
+		}
+	}
+	return vls
+}
@@ -0,0 +1,156 @@
+package options
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type TestAssertionUnmarshalFlagData struct {
+	in  string
+	out Assertion
+}
+
+func TestAssertionUnmarshalFlag(t *testing.T) {
+	// 正常系
+	tds := []TestAssertionUnmarshalFlagData{
+		TestAssertionUnmarshalFlagData{
+			in:  "p99<250",
+			out: Assertion{Stat: HeaderPercentile, Percentile: 99, Op: "<", Value: 250},
+		},
+		TestAssertionUnmarshalFlagData{ // 小数のパーセンタイル
+			in:  "p99.9<=1.5",
+			out: Assertion{Stat: HeaderPercentile, Percentile: 99.9, Op: "<=", Value: 1.5},
+		},
+		TestAssertionUnmarshalFlagData{ // ヘッダ名でのパーセンタイル指定
+			in:  "95percentile>0",
+			out: Assertion{Stat: HeaderPercentile, Percentile: 95, Op: ">", Value: 0},
+		},
+		TestAssertionUnmarshalFlagData{ // 空白を含む
+			in:  " count >= 10000 ",
+			out: Assertion{Stat: HeaderCount, Op: ">=", Value: 10000},
+		},
+		TestAssertionUnmarshalFlagData{
+			in:  "avg==-1",
+			out: Assertion{Stat: HeaderAverage, Op: "==", Value: -1},
+		},
+		TestAssertionUnmarshalFlagData{
+			in:  "samplestddev!=0",
+			out: Assertion{Stat: HeaderSampleStdDev, Op: "!=", Value: 0},
+		},
+	}
+	for _, v := range tds {
+		var a Assertion
+		err := a.UnmarshalFlag(v.in)
+		assert.NoError(t, err, v.in)
+		assert.Equal(t, v.out, a, v.in)
+	}
+
+	// 異常系
+	for _, v := range []string{
+		"",
+		"p99",       // 演算子なし
+		"p99=250",   // 不正な演算子
+		"p99!250",   // 不正な演算子
+		"p99<",      // 閾値なし
+		"p99<abc",   // 数値でない閾値
+		"p0<1",      // 範囲外のパーセンタイル
+		"p101<1",    // 範囲外のパーセンタイル
+		"latency<1", // 存在しない統計値
+		"<1",        // 統計値なし
+	} {
+		var a Assertion
+		assert.Error(t, a.UnmarshalFlag(v), v)
+	}
+}
+
+func TestAssertionString(t *testing.T) {
+	for _, v := range []string{"p99<250", "p99.9<=1.5", "count>=10000", "avg!=-0.5"} {
+		var a Assertion
+		assert.NoError(t, a.UnmarshalFlag(v))
+		assert.Equal(t, v, a.String())
+		s, err := a.MarshalFlag()
+		assert.NoError(t, err)
+		assert.Equal(t, v, s)
+	}
+}
+
+type TestAssertionCheckData struct {
+	in  string
+	out bool
+}
+
+func TestAssertionCheck(t *testing.T) {
+	ov := OutValues{
+		Count:       100,
+		Min:         1,
+		Max:         100,
+		Sum:         5050,
+		Average:     50.5,
+		Median:      50,
+		Percentiles: map[float64]float64{99: 99},
+		Variance:    math.NaN(),
+	}
+	tds := []TestAssertionCheckData{
+		TestAssertionCheckData{in: "count>=100", out: true},
+		TestAssertionCheckData{in: "count>100", out: false},
+		TestAssertionCheckData{in: "min==1", out: true},
+		TestAssertionCheckData{in: "max<100", out: false},
+		TestAssertionCheckData{in: "sum<=5050", out: true},
+		TestAssertionCheckData{in: "avg<50", out: false},
+		TestAssertionCheckData{in: "median!=50", out: false},
+		TestAssertionCheckData{in: "p99<100", out: true},
+		TestAssertionCheckData{in: "p99<99", out: false},
+		TestAssertionCheckData{in: "variance<1", out: false}, // NaNは条件を満たさない
+		TestAssertionCheckData{in: "variance>=1", out: false},
+		TestAssertionCheckData{in: "variance!=1", out: true},
+	}
+	for _, v := range tds {
+		var a Assertion
+		assert.NoError(t, a.UnmarshalFlag(v.in))
+		assert.Equal(t, v.out, a.Check(ov), v.in)
+	}
+}
+
+func TestCheckAssertions(t *testing.T) {
+	var p99, count Assertion
+	assert.NoError(t, p99.UnmarshalFlag("p99<250"))
+	assert.NoError(t, count.UnmarshalFlag("count>=10"))
+	ovs := []OutValues{
+		OutValues{
+			FileName:    "a.txt",
+			FieldIndex:  1,
+			Count:       10,
+			Percentiles: map[float64]float64{99: 300},
+		},
+		OutValues{
+			FileName:    "b.txt",
+			FieldIndex:  2,
+			FieldName:   "latency",
+			GroupKey:    "/a",
+			Count:       5,
+			Percentiles: map[float64]float64{99: 100.5},
+		},
+	}
+
+	// 1つのフィールドのみ集計したときはフィールドを出力しない
+	vls := CheckAssertions(ovs, Options{Assertions: []Assertion{p99, count}})
+	assert.Equal(t, []Violation{
+		Violation{OutValues: ovs[0], Assertion: p99},
+		Violation{OutValues: ovs[1], Assertion: count},
+	}, vls)
+	assert.Equal(t, "assertion failed: a.txt: p99<250 actual=300", vls[0].String())
+	assert.Equal(t, "assertion failed: b.txt group=/a: count>=10 actual=5", vls[1].String())
+
+	// 複数フィールドを集計したときはフィールドを出力する
+	vls = CheckAssertions(ovs, Options{
+		Assertions: []Assertion{p99, count},
+		Fields:     Fields{Field{Index: 1}, Field{Name: "latency"}},
+	})
+	assert.Equal(t, "assertion failed: a.txt field=1: p99<250 actual=300", vls[0].String())
+	assert.Equal(t, "assertion failed: b.txt field=latency group=/a: count>=10 actual=5", vls[1].String())
+
+	// 条件がなければ違反もない
+	assert.Nil(t, CheckAssertions(ovs, Options{}))
+}
@@ -0,0 +1,312 @@
+package options
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// CommandCompare は基準と候補の2つの入力を比較するモードのコマンド名です。
+const CommandCompare = "compare"
+
+const (
+	HeaderStat         = "stat"
+	HeaderBaseline     = "baseline"
+	HeaderCandidate    = "candidate"
+	HeaderDelta        = "delta"
+	HeaderDeltaPercent = "deltapercent"
+)
+
+// Threshold は割合(%)で指定する閾値です。
+type Threshold struct {
+	Percent float64
+	// Specified は閾値が指定されているか否かです。
+	Specified bool
+}
+
+// UnmarshalFlag は5%, 5のような割合の指定を解析する。
+func (t *Threshold) UnmarshalFlag(v string) error {
+	s := strings.TrimSuffix(strings.TrimSpace(v), "%")
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		msg := fmt.Sprintf("expected that threshold is number. input=%s", v)
+		return errors.New(msg)
+	}
+
+	// 負数はNG
+	if n < 0 || math.IsNaN(n) {
+		msg := fmt.Sprintf("threshold is over 0. input=%s", v)
+		return errors.New(msg)
+	}
+
+	t.Percent = n
+	t.Specified = true
+	return nil
+}
+
+func (t Threshold) MarshalFlag() (string, error) {
+	if !t.Specified {
+		return "", nil
+	}
+	return formatFloat(t.Percent) + "%", nil
+}
+
+// Comparison は基準と候補の1つの統計値の比較結果です。
+type Comparison struct {
+	// Field は集計したフィールドの表示名です。
+	Field    string
+	GroupKey string
+	// Stat は統計値のヘッダ名です。
+	Stat      string
+	Baseline  float64
+	Candidate float64
+	// HasBaseline, HasCandidate は基準、候補にそれぞれ対応する出力データがあるか否かです。
+	// 集計キーが片方にしか出現しないときにfalseになる。
+	HasBaseline  bool
+	HasCandidate bool
+}
+
+// Delta は基準から候補への差分を返す。
+func (c Comparison) Delta() float64 {
+	return c.Candidate - c.Baseline
+}
+
+// DeltaPercent は基準に対する差分の割合(%)を返す。
+// 基準が0のときは、候補も0なら0、それ以外なら差分の符号の無限大を返す。
+func (c Comparison) DeltaPercent() float64 {
+	d := c.Delta()
+	if c.Baseline == 0 {
+		if d == 0 {
+			return 0
+		}
+		return math.Inf(int(math.Copysign(1, d)))
+	}
+	return d / math.Abs(c.Baseline) * 100
+}
+
+// Regressed は候補の統計値が基準から閾値の割合を超えて増加したか否かを返す。
+// レイテンシのように値が大きいほど悪化とみなす。
+// 判定対象はregressionStatの統計値のみ。片方にしかない出力データも判定対象にしない。
+func (c Comparison) Regressed(t Threshold) bool {
+	if !t.Specified || !regressionStat(c.Stat) || !c.HasBaseline || !c.HasCandidate {
+		return false
+	}
+	return t.Percent < c.DeltaPercent()
+}
+
+// regressionStat は悪化の判定対象の統計値か否かを返す。
+// 値が大きいほど悪化とみなせる平均値、中央値、パーセンタイル値、最大値のみ判定する。
+// データ数、最小値、合計値、分散、標準偏差は増加しても悪化とは限らないので判定しない。
+func regressionStat(stat string) bool {
+	switch stat {
+	case HeaderAverage, HeaderMedian, HeaderMax:
+		return true
+	}
+	return strings.HasSuffix(stat, HeaderPercentile)
+}
+
+// String は比較結果を1行の文字列で返す。
+func (c Comparison) String() string {
+	ss := []string{"field=" + c.Field}
+	if c.GroupKey != "" {
+		ss = append(ss, "group="+c.GroupKey)
+	}
+	ss = append(ss,
+		fmt.Sprintf("stat=%s", c.Stat),
+		fmt.Sprintf("baseline=%s", formatFloat(c.Baseline)),
+		fmt.Sprintf("candidate=%s", formatFloat(c.Candidate)),
+		fmt.Sprintf("delta=%s", formatSigned(c.Delta())),
+		fmt.Sprintf("deltapercent=%s%%", formatSigned(c.DeltaPercent())),
+	)
+	return strings.Join(ss, " ")
+}
+
+// statValue は統計値のヘッダ名と値の組です。
+type statValue struct {
+	header string
+	value  float64
+}
+
+// statValues はオプションで指定された統計値を出力順に返す。
+func statValues(v OutValues, opts Options) []statValue {
+	var svs []statValue
+	add := func(flg bool, h string, n float64) {
+		if flg {
+			svs = append(svs, statValue{header: h, value: n})
+		}
+	}
+	add(opts.CountFlag, HeaderCount, float64(v.Count))
+	add(opts.MinFlag, HeaderMin, v.Min)
+	add(opts.MaxFlag, HeaderMax, v.Max)
+	add(opts.SumFlag, HeaderSum, v.Sum)
+	add(opts.AverageFlag, HeaderAverage, v.Average)
+	add(opts.MedianFlag, HeaderMedian, v.Median)
+	for _, p := range opts.Percentiles {
+		add(true, PercentileHeader(p), v.Percentiles[p])
+	}
+	add(opts.VarianceFlag, HeaderVariance, v.Variance)
+	add(opts.VarianceFlag, HeaderSampleVariance, v.SampleVariance)
+	add(opts.StdDevFlag, HeaderStdDev, v.StdDev)
+	add(opts.StdDevFlag, HeaderSampleStdDev, v.SampleStdDev)
+	return svs
+}
+
+// compareKey は基準と候補の出力データを対応付けるキーです。
+// ファイル名は異なるため、フィールドと集計キーで対応付ける。
+type compareKey struct {
+	field    string
+	groupKey string
+}
+
+// Compare は基準と候補の出力データを、オプションで指定された統計値ごとに比較する。
+// 比較結果は基準の出力データの順番に、候補にのみある出力データはその後ろに返す。
+func Compare(baseline, candidate []OutValues, opts Options) []Comparison {
+	var keys []compareKey
+	bs := make(map[compareKey]OutValues)
+	cs := make(map[compareKey]OutValues)
+	for _, v := range baseline {
+		k := compareKey{field: v.FieldLabel(), groupKey: v.GroupKey}
+		if _, ok := bs[k]; !ok {
+			keys = append(keys, k)
+		}
+		bs[k] = v
+	}
+	for _, v := range candidate {
+		k := compareKey{field: v.FieldLabel(), groupKey: v.GroupKey}
+		_, inBase := bs[k]
+		_, inCand := cs[k]
+		if !inBase && !inCand {
+			keys = append(keys, k)
+		}
+		cs[k] = v
+	}
+
+	var cmps []Comparison
+	for _, k := range keys {
+		b, hasB := bs[k]
+		c, hasC := cs[k]
+		bsv := statValues(b, opts)
+		csv := statValues(c, opts)
+		for i := range bsv {
+			cmps = append(cmps, Comparison{
+				Field:        k.field,
+				GroupKey:     k.groupKey,
+				Stat:         bsv[i].header,
+				Baseline:     bsv[i].value,
+				Candidate:    csv[i].value,
+				HasBaseline:  hasB,
+				HasCandidate: hasC,
+			})
+		}
+	}
+	return cmps
+}
+
+// Regressions は閾値を超えて悪化した比較結果を返す。
+func Regressions(cmps []Comparison, t Threshold) []Comparison {
+	var rs []Comparison
+	for _, c := range cmps {
+		if c.Regressed(t) {
+			rs = append(rs, c)
+		}
+	}
+	return rs
+}
+
+// FormatCompare は比較結果をオプションに応じて整形する。
+// 対応する出力データがない側の値と差分は、テキストでは-、JSONではnullを出力する。
+func FormatCompare(cmps []Comparison, opts Options) ([]string, error) {
+	switch opts.OutputFormat {
+	case OutputFormatJSON:
+		return jsonArrayLines(newCompareJSONObjects(cmps, opts))
+	case OutputFormatNDJSON:
+		return jsonLines(newCompareJSONObjects(cmps, opts))
+	}
+
+	lines := make([]string, 0, len(cmps)+1)
+	if opts.HeaderFlag {
+		hs := make([]string, 0, 7)
+		if opts.MultiFields() {
+			hs = append(hs, HeaderField)
+		}
+		if opts.GroupBy.Specified() {
+			hs = append(hs, HeaderGroup)
+		}
+		hs = append(hs, HeaderStat, HeaderBaseline, HeaderCandidate, HeaderDelta, HeaderDeltaPercent)
+		lines = append(lines, strings.Join(hs, opts.OutputDelimiter))
+	}
+
+	for _, c := range cmps {
+		ss := make([]string, 0, 7)
+		if opts.MultiFields() {
+			ss = append(ss, c.Field)
+		}
+		if opts.GroupBy.Specified() {
+			ss = append(ss, quoteField(c.GroupKey, opts.OutputDelimiter))
+		}
+		b, cand, d, dp := "-", "-", "-", "-"
+		if c.HasBaseline {
+			b = opts.formatStat(c.Stat, c.Baseline)
+		}
+		if c.HasCandidate {
+			cand = opts.formatStat(c.Stat, c.Candidate)
+		}
+		if c.HasBaseline && c.HasCandidate {
+			d = opts.formatSignedStat(c.Stat, c.Delta())
+			dp = formatSigned(c.DeltaPercent()) + "%"
+		}
+		ss = append(ss, c.Stat, b, cand, d, dp)
+		lines = append(lines, strings.Join(ss, opts.OutputDelimiter))
+	}
+	return lines, nil
+}
+
+// formatSigned は差分を+1.5, -2のように符号付きで整形する。
+func formatSigned(n float64) string {
+	return signed(formatFloat(n), n)
+}
+
+// formatSignedStat は統計値の差分をformatStatで整形し、符号を付ける。
+func (o Options) formatSignedStat(h string, n float64) string {
+	return signed(o.formatStat(h, n), n)
+}
+
+// signed は正の値の文字列に+を付ける。+Infはすでに符号を持つので付けない。
+func signed(s string, n float64) string {
+	if 0 < n && !math.IsInf(n, 1) {
+		return "+" + s
+	}
+	return s
+}
+
+func newCompareJSONObjects(cmps []Comparison, opts Options) []jsonObject {
+	objs := make([]jsonObject, len(cmps))
+	for i, c := range cmps {
+		o := jsonObject{jsonField{key: HeaderField, value: c.Field}}
+		if opts.GroupBy.Specified() {
+			o = append(o, jsonField{key: HeaderGroup, value: c.GroupKey})
+		}
+		var b, cand, d, dp interface{}
+		if c.HasBaseline {
+			b = jsonNumber(c.Baseline)
+		}
+		if c.HasCandidate {
+			cand = jsonNumber(c.Candidate)
+		}
+		if c.HasBaseline && c.HasCandidate {
+			d = jsonNumber(c.Delta())
+			dp = jsonNumber(c.DeltaPercent())
+		}
+		o = append(o,
+			jsonField{key: HeaderStat, value: c.Stat},
+			jsonField{key: HeaderBaseline, value: b},
+			jsonField{key: HeaderCandidate, value: cand},
+			jsonField{key: HeaderDelta, value: d},
+			jsonField{key: HeaderDeltaPercent, value: dp},
+		)
+		objs[i] = o
+	}
+	return objs
+}
@@ -0,0 +1,156 @@
+package options
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThresholdUnmarshalFlag(t *testing.T) {
+	for _, v := range []struct {
+		in  string
+		out float64
+	}{
+		{"5%", 5},
+		{"5", 5},
+		{" 0.5% ", 0.5},
+		{"0", 0},
+	} {
+		var th Threshold
+		assert.NoError(t, th.UnmarshalFlag(v.in), v.in)
+		assert.Equal(t, Threshold{Percent: v.out, Specified: true}, th, v.in)
+	}
+
+	for _, v := range []string{"", "%", "abc", "-5%", "NaN"} {
+		var th Threshold
+		assert.Error(t, th.UnmarshalFlag(v), v)
+	}
+
+	s, err := Threshold{Percent: 2.5, Specified: true}.MarshalFlag()
+	assert.NoError(t, err)
+	assert.Equal(t, "2.5%", s)
+	s, err = Threshold{}.MarshalFlag()
+	assert.NoError(t, err)
+	assert.Equal(t, "", s)
+}
+
+func TestComparisonDeltaPercent(t *testing.T) {
+	assert.Equal(t, 20.0, Comparison{Baseline: 100, Candidate: 120}.DeltaPercent())
+	assert.Equal(t, -50.0, Comparison{Baseline: 10, Candidate: 5}.DeltaPercent())
+	// 基準が負数のときも増加は正の割合
+	assert.Equal(t, 50.0, Comparison{Baseline: -10, Candidate: -5}.DeltaPercent())
+	// 基準が0
+	assert.Equal(t, 0.0, Comparison{}.DeltaPercent())
+	assert.True(t, math.IsInf(Comparison{Candidate: 1}.DeltaPercent(), 1))
+	assert.True(t, math.IsInf(Comparison{Candidate: -1}.DeltaPercent(), -1))
+}
+
+func TestComparisonRegressed(t *testing.T) {
+	th := Threshold{Percent: 5, Specified: true}
+	c := Comparison{Stat: HeaderMax, Baseline: 100, Candidate: 106, HasBaseline: true, HasCandidate: true}
+	assert.True(t, c.Regressed(th))
+
+	// 閾値ちょうどは悪化とみなさない
+	c.Candidate = 105
+	assert.False(t, c.Regressed(th))
+
+	// 減少は悪化とみなさない
+	c.Candidate = 50
+	assert.False(t, c.Regressed(th))
+
+	// 閾値の指定なし
+	c.Candidate = 200
+	assert.False(t, c.Regressed(Threshold{}))
+
+	// 平均値、中央値、パーセンタイル値、最大値のみ判定対象
+	for _, s := range []string{HeaderAverage, HeaderMedian, PercentileHeader(99), PercentileHeader(99.9)} {
+		c.Stat = s
+		assert.True(t, c.Regressed(th), s)
+	}
+	for _, s := range []string{HeaderCount, HeaderMin, HeaderSum, HeaderVariance, HeaderSampleVariance, HeaderStdDev, HeaderSampleStdDev} {
+		c.Stat = s
+		assert.False(t, c.Regressed(th), s)
+	}
+
+	// 片方にしかない出力データは判定対象外
+	c.Stat = HeaderMax
+	c.HasBaseline = false
+	assert.False(t, c.Regressed(th))
+}
+
+func TestCompare(t *testing.T) {
+	opts := Options{
+		CountFlag:       true,
+		MaxFlag:         true,
+		Percentiles:     Percentiles{99},
+		GroupBy:         Field{Name: "endpoint"},
+		HeaderFlag:      true,
+		OutputDelimiter: "\t",
+	}
+	baseline := []OutValues{
+		OutValues{FileName: "base.csv", FieldIndex: 2, GroupKey: "/a", Count: 10, Max: 100, Percentiles: map[float64]float64{99: 90}},
+		OutValues{FileName: "base.csv", FieldIndex: 2, GroupKey: "/b", Count: 5, Max: 0, Percentiles: map[float64]float64{99: 0}},
+	}
+	candidate := []OutValues{
+		OutValues{FileName: "cand.csv", FieldIndex: 2, GroupKey: "/c", Count: 1, Max: 1, Percentiles: map[float64]float64{99: 1}},
+		OutValues{FileName: "cand.csv", FieldIndex: 2, GroupKey: "/a", Count: 12, Max: 110.5, Percentiles: map[float64]float64{99: 81}},
+	}
+
+	cmps := Compare(baseline, candidate, opts)
+	// 基準の順番、候補にのみある集計キーはその後ろ
+	assert.Equal(t, 9, len(cmps))
+	assert.Equal(t, Comparison{
+		Field:        "2",
+		GroupKey:     "/a",
+		Stat:         HeaderMax,
+		Baseline:     100,
+		Candidate:    110.5,
+		HasBaseline:  true,
+		HasCandidate: true,
+	}, cmps[1])
+
+	lines, err := FormatCompare(cmps, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"group\tstat\tbaseline\tcandidate\tdelta\tdeltapercent",
+		"/a\tcount\t10\t12\t+2\t+20%",
+		"/a\tmax\t100\t110.5\t+10.5\t+10.5%",
+		"/a\t99percentile\t90\t81\t-9\t-10%",
+		"/b\tcount\t5\t-\t-\t-",
+		"/b\tmax\t0\t-\t-\t-",
+		"/b\t99percentile\t0\t-\t-\t-",
+		"/c\tcount\t-\t1\t-\t-",
+		"/c\tmax\t-\t1\t-\t-",
+		"/c\t99percentile\t-\t1\t-\t-",
+	}, lines)
+
+	rs := Regressions(cmps, Threshold{Percent: 5, Specified: true})
+	assert.Equal(t, []Comparison{cmps[1]}, rs)
+	assert.Equal(t, "field=2 group=/a stat=max baseline=100 candidate=110.5 delta=+10.5 deltapercent=+10.5%", rs[0].String())
+	assert.Nil(t, Regressions(cmps, Threshold{Percent: 20, Specified: true}))
+
+	// JSON出力。対応する出力データがない側はnull
+	opts.OutputFormat = OutputFormatNDJSON
+	lines, err = FormatCompare(cmps, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"field":"2","group":"/a","stat":"count","baseline":10,"candidate":12,"delta":2,"deltapercent":20}`, lines[0])
+	assert.Equal(t, `{"field":"2","group":"/b","stat":"count","baseline":5,"candidate":null,"delta":null,"deltapercent":null}`, lines[3])
+
+	opts.OutputFormat = OutputFormatJSON
+	lines, err = FormatCompare(cmps[:1], opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"[",
+		`  {"field":"2","group":"/a","stat":"count","baseline":10,"candidate":12,"delta":2,"deltapercent":20}`,
+		"]",
+	}, lines)
+}
+
+func TestValidateCommand(t *testing.T) {
+	assert.NoError(t, Options{}.validateCommand([]string{"a.txt"}))
+	assert.NoError(t, Options{Compare: true}.validateCommand([]string{"a.txt", "b.txt"}))
+	assert.Error(t, Options{Compare: true}.validateCommand([]string{"a.txt"}))
+	assert.Error(t, Options{Compare: true}.validateCommand([]string{"a.txt", "b.txt", "c.txt"}))
+	assert.Error(t, Options{FailOnRegression: Threshold{Percent: 5, Specified: true}}.validateCommand([]string{"a.txt"}))
+}
@@ -0,0 +1,209 @@
+package options
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CommandHistogram は値の分布をヒストグラムで出力するモードのコマンド名です。
+const CommandHistogram = "histogram"
+
+const (
+	HeaderLower      = "lower"
+	HeaderUpper      = "upper"
+	HeaderPercent    = "percent"
+	HeaderCumPercent = "cumpercent"
+)
+
+const (
+	// BinScaleLinear は最小値から最大値までを等幅に分ける階級です。
+	BinScaleLinear = "linear"
+	// BinScaleLog は最小値から最大値までを対数で等幅に分ける階級です。
+	BinScaleLog = "log"
+)
+
+// DefaultBinCount は階級の指定がないときの階級の数です。
+const DefaultBinCount = 10
+
+// Bins はヒストグラムの階級の指定です。
+// 階級の数、あるいは境界値の一覧のどちらかを指定する。
+type Bins struct {
+	// Count は最小値から最大値までを分ける階級の数です。
+	Count int
+	// Edges は昇順の境界値の一覧です。
+	Edges []float64
+}
+
+// UnmarshalFlag は1つの整数なら階級の数、カンマ区切りの数値なら境界値の一覧として解析する。
+// 境界値は2つ以上、昇順で指定する。
+func (b *Bins) UnmarshalFlag(v string) error {
+	if !strings.Contains(v, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || n < 1 {
+			msg := fmt.Sprintf("bins is a count over 1 or comma separated edges. input=%s", v)
+			return errors.New(msg)
+		}
+		b.Count = n
+		b.Edges = nil
+		return nil
+	}
+
+	var edges []float64
+	for _, s := range strings.Split(v, ",") {
+		n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			msg := fmt.Sprintf("expected that bin edge is number. input=%s", s)
+			return errors.New(msg)
+		}
+		edges = append(edges, n)
+	}
+	if len(edges) < 2 {
+		msg := fmt.Sprintf("bin edges need 2 or more values. input=%s", v)
+		return errors.New(msg)
+	}
+	for i := 1; i < len(edges); i++ {
+		if edges[i] <= edges[i-1] {
+			msg := fmt.Sprintf("bin edges are ascending and not duplicated. input=%s", v)
+			return errors.New(msg)
+		}
+	}
+	b.Count = 0
+	b.Edges = edges
+	return nil
+}
+
+func (b Bins) MarshalFlag() (string, error) {
+	if b.Edges == nil {
+		if b.Count < 1 {
+			return "", nil
+		}
+		return strconv.Itoa(b.Count), nil
+	}
+	ss := make([]string, len(b.Edges))
+	for i, v := range b.Edges {
+		ss[i] = formatFloat(v)
+	}
+	return strings.Join(ss, ","), nil
+}
+
+// Bucket はヒストグラムの1つの階級です。
+// Lower以上Upper未満の値の件数を持つ。最後の階級のみUpper以下の値を数える。
+type Bucket struct {
+	Lower float64
+	Upper float64
+	Count int
+}
+
+// histogramRow はヒストグラムの1行です。
+type histogramRow struct {
+	ov         OutValues
+	bucket     Bucket
+	percent    float64
+	cumPercent float64
+}
+
+// histogramRows は出力データの階級ごとに、全体に対する割合と累積の割合を計算する。
+func histogramRows(vs []OutValues) []histogramRow {
+	var rows []histogramRow
+	for _, v := range vs {
+		total := 0
+		for _, b := range v.Histogram {
+			total += b.Count
+		}
+		cum := 0
+		for _, b := range v.Histogram {
+			cum += b.Count
+			r := histogramRow{ov: v, bucket: b}
+			if 0 < total {
+				r.percent = float64(b.Count) / float64(total) * 100
+				r.cumPercent = float64(cum) / float64(total) * 100
+			}
+			rows = append(rows, r)
+		}
+	}
+	return rows
+}
+
+// formatHistogram はヒストグラムを階級ごとに1行で整形する。
+// PlotFlagがあるときは、件数の棒グラフの列を末尾に追加する。
+func formatHistogram(vs []OutValues, opts Options) ([]string, error) {
+	rows := histogramRows(vs)
+	switch opts.OutputFormat {
+	case OutputFormatJSON:
+		return jsonArrayLines(newHistogramJSONObjects(rows, opts))
+	case OutputFormatNDJSON:
+		return jsonLines(newHistogramJSONObjects(rows, opts))
+	}
+
+	fileName := !opts.NoFileNameFlag && 0 < len(vs) && vs[0].FileName != ""
+	lines := make([]string, 0, len(rows)+1)
+	if opts.HeaderFlag {
+		var hs []string
+		if fileName {
+			hs = append(hs, FileName)
+		}
+		if opts.MultiFields() {
+			hs = append(hs, HeaderField)
+		}
+		if opts.GroupBy.Specified() {
+			hs = append(hs, HeaderGroup)
+		}
+		hs = append(hs, HeaderLower, HeaderUpper, HeaderCount, HeaderPercent, HeaderCumPercent)
+		lines = append(lines, strings.Join(hs, opts.OutputDelimiter))
+	}
+
+	for _, r := range rows {
+		var ss []string
+		if fileName {
+			ss = append(ss, r.ov.FileName)
+		}
+		if opts.MultiFields() {
+			ss = append(ss, r.ov.FieldLabel())
+		}
+		if opts.GroupBy.Specified() {
+			ss = append(ss, quoteField(r.ov.GroupKey, opts.OutputDelimiter))
+		}
+		ss = append(ss,
+			opts.formatStat(HeaderLower, r.bucket.Lower),
+			opts.formatStat(HeaderUpper, r.bucket.Upper),
+			strconv.Itoa(r.bucket.Count),
+			formatFloat(r.percent),
+			formatFloat(r.cumPercent),
+		)
+		lines = append(lines, strings.Join(ss, opts.OutputDelimiter))
+	}
+
+	if opts.PlotFlag {
+		counts := make([]int, len(rows))
+		for i, r := range rows {
+			counts[i] = r.bucket.Count
+		}
+		lines = plotLines(lines, counts, opts.HeaderFlag, opts.Width, opts.OutputDelimiter)
+	}
+	return lines, nil
+}
+
+func newHistogramJSONObjects(rows []histogramRow, opts Options) []jsonObject {
+	objs := make([]jsonObject, len(rows))
+	for i, r := range rows {
+		o := jsonObject{}
+		add := func(flg bool, k string, v interface{}) {
+			if flg {
+				o = append(o, jsonField{key: k, value: v})
+			}
+		}
+		add(r.ov.FileName != "" && !opts.NoFileNameFlag, FileName, r.ov.FileName)
+		add(true, FieldIndex, r.ov.FieldIndex)
+		add(r.ov.FieldName != "", FieldName, r.ov.FieldName)
+		add(opts.GroupBy.Specified(), HeaderGroup, r.ov.GroupKey)
+		add(true, HeaderLower, jsonNumber(r.bucket.Lower))
+		add(true, HeaderUpper, jsonNumber(r.bucket.Upper))
+		add(true, HeaderCount, r.bucket.Count)
+		add(true, HeaderPercent, r.percent)
+		add(true, HeaderCumPercent, r.cumPercent)
+		objs[i] = o
+	}
+	return objs
+}
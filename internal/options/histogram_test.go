@@ -0,0 +1,102 @@
+package options
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBinsUnmarshalFlag(t *testing.T) {
+	for _, v := range []struct {
+		in  string
+		out Bins
+	}{
+		{"10", Bins{Count: 10}},
+		{" 3 ", Bins{Count: 3}},
+		{"10,50,100,500", Bins{Edges: []float64{10, 50, 100, 500}}},
+		{"-1, 0.5", Bins{Edges: []float64{-1, 0.5}}},
+	} {
+		var b Bins
+		assert.NoError(t, b.UnmarshalFlag(v.in), v.in)
+		assert.Equal(t, v.out, b, v.in)
+
+		s, err := b.MarshalFlag()
+		assert.NoError(t, err)
+		var b2 Bins
+		assert.NoError(t, b2.UnmarshalFlag(s), s)
+		assert.Equal(t, b, b2, s)
+	}
+
+	for _, v := range []string{"", "0", "-1", "abc", "10,", "10,a", "10,10", "50,10"} {
+		var b Bins
+		assert.Error(t, b.UnmarshalFlag(v), v)
+	}
+}
+
+func TestValidateHistogram(t *testing.T) {
+	assert.NoError(t, Options{HistogramFlag: true, BinScale: BinScaleLog}.validateCommand([]string{"a.txt"}))
+	assert.Error(t, Options{HistogramFlag: true, ApproxFlag: true}.validateCommand([]string{"a.txt"}))
+	assert.Error(t, Options{HistogramFlag: true, Compare: true}.validateCommand([]string{"a.txt", "b.txt"}))
+	assert.Error(t, Options{HistogramFlag: true, BinScale: BinScaleLog, Bins: Bins{Edges: []float64{1, 2}}}.validateCommand([]string{"a.txt"}))
+}
+
+type TestFormatHistogramData struct {
+	desc string
+	vs   []OutValues
+	opts Options
+	out  []string
+}
+
+func TestFormatHistogram(t *testing.T) {
+	hist := []Bucket{
+		Bucket{Lower: math.Inf(-1), Upper: 10, Count: 1},
+		Bucket{Lower: 10, Upper: 50, Count: 2},
+		Bucket{Lower: 50, Upper: math.Inf(1), Count: 1},
+	}
+	tds := []TestFormatHistogramData{
+		TestFormatHistogramData{
+			desc: "ヘッダ付き",
+			vs:   []OutValues{OutValues{FileName: "a.txt", FieldIndex: 1, Histogram: hist}},
+			opts: Options{HistogramFlag: true, HeaderFlag: true, OutputDelimiter: "\t"},
+			out: []string{
+				"filename\tlower\tupper\tcount\tpercent\tcumpercent",
+				"a.txt\t-Inf\t10\t1\t25\t25",
+				"a.txt\t10\t50\t2\t50\t75",
+				"a.txt\t50\t+Inf\t1\t25\t100",
+			},
+		},
+		TestFormatHistogramData{
+			desc: "集計キーごと、ファイル名なし",
+			vs: []OutValues{
+				OutValues{FileName: "a.txt", GroupKey: "x", Histogram: []Bucket{Bucket{Lower: 1, Upper: 2, Count: 3}}},
+				OutValues{FileName: "a.txt", GroupKey: "y", Histogram: []Bucket{Bucket{Lower: 5, Upper: 5, Count: 1}}},
+			},
+			opts: Options{HistogramFlag: true, NoFileNameFlag: true, GroupBy: Field{Index: 1}, OutputDelimiter: ","},
+			out: []string{
+				"x,1,2,3,100,100",
+				"y,5,5,1,100,100",
+			},
+		},
+		TestFormatHistogramData{
+			desc: "値がない",
+			vs:   []OutValues{OutValues{FileName: "a.txt"}},
+			opts: Options{HistogramFlag: true, OutputDelimiter: "\t"},
+			out:  []string{},
+		},
+		TestFormatHistogramData{
+			desc: "NDJSONでは無限大をnullにする",
+			vs:   []OutValues{OutValues{FileName: "a.txt", FieldIndex: 1, Histogram: hist[:2]}},
+			opts: Options{HistogramFlag: true, OutputFormat: OutputFormatNDJSON},
+			out: []string{
+				`{"filename":"a.txt","fieldindex":1,"lower":null,"upper":10,"count":1,"percent":33.33333333333333,"cumpercent":33.33333333333333}`,
+				`{"filename":"a.txt","fieldindex":1,"lower":10,"upper":50,"count":2,"percent":66.66666666666666,"cumpercent":100}`,
+			},
+		},
+	}
+	for _, v := range tds {
+		lines, err := Format(v.vs, v.opts)
+		assert.NoError(t, err)
+		assert.Equal(t, v.out, lines, v.desc)
+	}
+}
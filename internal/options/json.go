@@ -0,0 +1,132 @@
+package options
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+)
+
+// jsonField はJSONオブジェクトのキーと値の組です。
+type jsonField struct {
+	key   string
+	value interface{}
+}
+
+// jsonObject はキーの順番を保持するJSONオブジェクトです。
+// ヘッダの出力順と同じ順番でキーを出力する。
+type jsonObject []jsonField
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	for i, f := range o {
+		if 0 < i {
+			buf.WriteString(",")
+		}
+		k, err := json.Marshal(f.key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteString(":")
+		buf.Write(v)
+	}
+	buf.WriteString("}")
+	return buf.Bytes(), nil
+}
+
+// jsonNumber はJSONで表現できないNaN, Infをnullに変換する。
+func jsonNumber(n float64) interface{} {
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return nil
+	}
+	return n
+}
+
+// newJSONObject は出力データをオプションで指定された値のみのJSONオブジェクトに変換する。
+// キー名はヘッダ名と同じ。
+func newJSONObject(v OutValues, opts Options) jsonObject {
+	o := jsonObject{}
+	add := func(flg bool, k string, v interface{}) {
+		if flg {
+			o = append(o, jsonField{key: k, value: v})
+		}
+	}
+
+	add(0 < opts.Window, HeaderWindow, formatWindow(v.Window))
+	add(v.FileName != "" && !opts.NoFileNameFlag, FileName, v.FileName)
+	add(true, FieldIndex, v.FieldIndex)
+	add(v.FieldName != "", FieldName, v.FieldName)
+	add(opts.GroupBy.Specified(), HeaderGroup, v.GroupKey)
+	add(opts.CountFlag, HeaderCount, v.Count)
+	add(opts.MinFlag, HeaderMin, jsonNumber(v.Min))
+	add(opts.MaxFlag, HeaderMax, jsonNumber(v.Max))
+	add(opts.SumFlag, HeaderSum, jsonNumber(v.Sum))
+	add(opts.AverageFlag, HeaderAverage, jsonNumber(v.Average))
+	add(opts.MedianFlag, HeaderMedian, jsonNumber(v.Median))
+	for _, p := range opts.Percentiles {
+		add(true, PercentileHeader(p), jsonNumber(v.Percentiles[p]))
+	}
+	add(opts.VarianceFlag, HeaderVariance, jsonNumber(v.Variance))
+	add(opts.VarianceFlag, HeaderSampleVariance, jsonNumber(v.SampleVariance))
+	add(opts.StdDevFlag, HeaderStdDev, jsonNumber(v.StdDev))
+	add(opts.StdDevFlag, HeaderSampleStdDev, jsonNumber(v.SampleStdDev))
+	add(opts.SparklineFlag, HeaderSparkline, Sparkline(v.Histogram))
+	return o
+}
+
+// formatJSON は出力データ全体を1つのJSON配列に整形する。
+// 配列の要素は1行に1つずつ出力する。
+func formatJSON(vs []OutValues, opts Options) ([]string, error) {
+	return jsonArrayLines(newJSONObjects(vs, opts))
+}
+
+// formatNDJSON は出力データを1行1つのJSONオブジェクトに整形する。
+func formatNDJSON(vs []OutValues, opts Options) ([]string, error) {
+	return jsonLines(newJSONObjects(vs, opts))
+}
+
+func newJSONObjects(vs []OutValues, opts Options) []jsonObject {
+	objs := make([]jsonObject, len(vs))
+	for i, v := range vs {
+		objs[i] = newJSONObject(v, opts)
+	}
+	return objs
+}
+
+// jsonArrayLines はJSONオブジェクトを1つのJSON配列に整形する。
+// 配列の要素は1行に1つずつ出力する。
+func jsonArrayLines(objs []jsonObject) ([]string, error) {
+	ls, err := jsonLines(objs)
+	if err != nil {
+		return nil, err
+	}
+	lines := []string{"["}
+	for i, s := range ls {
+		s = "  " + s
+		if i < len(objs)-1 {
+			s += ","
+		}
+		lines = append(lines, s)
+	}
+	lines = append(lines, "]")
+	return lines, nil
+}
+
+// jsonLines はJSONオブジェクトを1行1つに整形する。
+// NaN, Infはnullに変換済みだが、変換できない値があればエラーを返す。
+func jsonLines(objs []jsonObject) ([]string, error) {
+	lines := make([]string, len(objs))
+	for i, o := range objs {
+		b, err := json.Marshal(o)
+		if err != nil {
+			return nil, err
+		}
+		lines[i] = string(b)
+	}
+	return lines, nil
+}
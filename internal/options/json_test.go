@@ -0,0 +1,137 @@
+package options
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type TestFormatJSONData struct {
+	ovs  []OutValues
+	opts Options
+	out  []string
+}
+
+func TestFormatJSON(t *testing.T) {
+	ovs := []OutValues{
+		OutValues{
+			FileName:    "foo.txt",
+			FieldIndex:  1,
+			Count:       5,
+			Min:         1.0,
+			Max:         5.0,
+			Sum:         15.0,
+			Average:     3.0,
+			Median:      3.0,
+			Percentiles: map[float64]float64{95: 4, 99.9: 5},
+		},
+		OutValues{
+			FileName:    "bar.csv",
+			FieldIndex:  2,
+			Count:       2,
+			Min:         -1.5,
+			Max:         math.Inf(1),
+			Sum:         math.Inf(1),
+			Average:     math.Inf(1),
+			Median:      -1.5,
+			Percentiles: map[float64]float64{95: -1.5, 99.9: -1.5},
+		},
+	}
+
+	tds := []TestFormatJSONData{
+		TestFormatJSONData{ // NDJSON
+			ovs: ovs,
+			opts: Options{
+				CountFlag:    true,
+				MinFlag:      true,
+				MaxFlag:      true,
+				AverageFlag:  true,
+				Percentiles:  Percentiles{95, 99.9},
+				OutputFormat: OutputFormatNDJSON,
+			},
+			out: []string{
+				`{"filename":"foo.txt","fieldindex":1,"count":5,"min":1,"max":5,"avg":3,"95percentile":4,"99.9percentile":5}`,
+				`{"filename":"bar.csv","fieldindex":2,"count":2,"min":-1.5,"max":null,"avg":null,"95percentile":-1.5,"99.9percentile":-1.5}`,
+			},
+		},
+		TestFormatJSONData{ // JSON配列。ファイル名なし
+			ovs: ovs,
+			opts: Options{
+				NoFileNameFlag: true,
+				SumFlag:        true,
+				MedianFlag:     true,
+				HeaderFlag:     true, // JSONではヘッダは出力しない
+				OutputFormat:   OutputFormatJSON,
+			},
+			out: []string{
+				`[`,
+				`  {"fieldindex":1,"sum":15,"median":3},`,
+				`  {"fieldindex":2,"sum":null,"median":-1.5}`,
+				`]`,
+			},
+		},
+		TestFormatJSONData{ // 分散と標準偏差
+			ovs: []OutValues{
+				OutValues{
+					FieldIndex:     1,
+					Variance:       2,
+					SampleVariance: 2.5,
+					StdDev:         1.5,
+					SampleStdDev:   math.NaN(),
+				},
+			},
+			opts: Options{
+				VarianceFlag: true,
+				StdDevFlag:   true,
+				OutputFormat: OutputFormatNDJSON,
+			},
+			out: []string{
+				`{"fieldindex":1,"variance":2,"samplevariance":2.5,"stddev":1.5,"samplestddev":null}`,
+			},
+		},
+		TestFormatJSONData{ // 集計キー
+			ovs: []OutValues{
+				OutValues{
+					FieldIndex: 2,
+					GroupKey:   "/a",
+					Count:      3,
+				},
+			},
+			opts: Options{
+				CountFlag:    true,
+				GroupBy:      Field{Name: "endpoint"},
+				OutputFormat: OutputFormatNDJSON,
+			},
+			out: []string{
+				`{"fieldindex":2,"group":"/a","count":3}`,
+			},
+		},
+		TestFormatJSONData{ // データなし
+			ovs: []OutValues{},
+			opts: Options{
+				CountFlag:    true,
+				OutputFormat: OutputFormatJSON,
+			},
+			out: []string{
+				`[`,
+				`]`,
+			},
+		},
+	}
+
+	for _, v := range tds {
+		lines, err := Format(v.ovs, v.opts)
+		assert.NoError(t, err)
+		assert.Equal(t, v.out, lines)
+	}
+}
+
+func TestJSONLinesError(t *testing.T) {
+	// JSONで表現できない値はpanicせずにエラーを返す
+	objs := []jsonObject{jsonObject{jsonField{key: "min", value: math.NaN()}}}
+	_, err := jsonLines(objs)
+	assert.Error(t, err)
+	_, err = jsonArrayLines(objs)
+	assert.Error(t, err)
+}
@@ -0,0 +1,45 @@
+package options
+
+import "errors"
+
+// CommandMerge は--emit-stateで出力した集計の状態ファイルを併合するモードのコマンド名です。
+const CommandMerge = "merge"
+
+// validateMerge は集計の状態の出力と併合の指定を検証する。
+// 併合では入力のフィールド、集計キー、時間窓、単位は状態ファイルの指定に従う。
+// 状態ファイルはデータを保持しないため、ヒストグラム、スパークラインとは併用できない。
+func (o Options) validateMerge(args []string) error {
+	if o.EmitState != "" {
+		if o.Compare {
+			return errors.New("--emit-state is not available with compare.")
+		}
+		if o.FollowFlag {
+			return errors.New("--emit-state is not available with --follow.")
+		}
+	}
+	if !o.Merge {
+		return nil
+	}
+	if len(args) < 1 {
+		return errors.New("merge needs state files.")
+	}
+	if o.HistogramFlag {
+		return errors.New("histogram is not available with merge.")
+	}
+	if o.SparklineFlag {
+		return errors.New("--sparkline is not available with merge.")
+	}
+	if o.TotalFlag {
+		return errors.New("--total is not available with merge.")
+	}
+	if o.FollowFlag {
+		return errors.New("--follow is not available with merge.")
+	}
+	if 0 < len(o.SeparatableFilePath) || 0 < len(o.Fields) {
+		return errors.New("field options are not available with merge. fields are given by state files.")
+	}
+	if o.GroupBy.Specified() || 0 < o.Window || o.TimeField.Specified() || o.Unit.Specified() {
+		return errors.New("--group-by, --window, --time-field and --unit are not available with merge. they are given by state files.")
+	}
+	return nil
+}
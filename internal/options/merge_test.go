@@ -0,0 +1,42 @@
+package options
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type TestValidateMergeData struct {
+	desc string
+	opts Options
+	args []string
+	err  bool
+}
+
+func TestValidateMerge(t *testing.T) {
+	args := []string{"a.bin", "b.bin"}
+	tds := []TestValidateMergeData{
+		TestValidateMergeData{desc: "併合", opts: Options{Merge: true}, args: args},
+		TestValidateMergeData{desc: "併合した状態の出力", opts: Options{Merge: true, EmitState: "all.bin"}, args: args},
+		TestValidateMergeData{desc: "併合の単位", opts: Options{Merge: true, HumanFlag: true}, args: args},
+		TestValidateMergeData{desc: "状態の出力", opts: Options{EmitState: "a.bin", GroupBy: Field{Index: 2}}, args: []string{"a.txt"}},
+		TestValidateMergeData{desc: "状態ファイルがない", opts: Options{Merge: true}, err: true},
+		TestValidateMergeData{desc: "ヒストグラム", opts: Options{Merge: true, HistogramFlag: true}, args: args, err: true},
+		TestValidateMergeData{desc: "スパークライン", opts: Options{Merge: true, SparklineFlag: true}, args: args, err: true},
+		TestValidateMergeData{desc: "合計の行", opts: Options{Merge: true, TotalFlag: true}, args: args, err: true},
+		TestValidateMergeData{desc: "複数フィールド", opts: Options{Merge: true, Fields: Fields{Field{Index: 2}}}, args: args, err: true},
+		TestValidateMergeData{desc: "集計キー", opts: Options{Merge: true, GroupBy: Field{Index: 2}}, args: args, err: true},
+		TestValidateMergeData{desc: "時間窓", opts: Options{Merge: true, Window: time.Second, TimeField: Field{Index: 1}}, args: args, err: true},
+		TestValidateMergeData{desc: "比較で状態の出力", opts: Options{Compare: true, EmitState: "a.bin"}, args: args, err: true},
+		TestValidateMergeData{desc: "追跡で状態の出力", opts: Options{FollowFlag: true, Interval: time.Second, EmitState: "a.bin"}, args: args, err: true},
+	}
+	for _, v := range tds {
+		err := v.opts.validateCommand(v.args)
+		if v.err {
+			assert.Error(t, err, v.desc)
+			continue
+		}
+		assert.NoError(t, err, v.desc)
+	}
+}
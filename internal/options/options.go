@@ -3,15 +3,24 @@ package options
 import (
 	"errors"
 	"fmt"
+	"math"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	flags "github.com/jessevdk/go-flags"
 )
 
+// TotalFileName は--totalで追加する合計の行のファイル名の列の値です。
+const TotalFileName = "TOTAL"
+
 const (
 	FileName         = "filename"
+	FieldIndex       = "fieldindex"
+	FieldName        = "fieldname"
+	HeaderField      = "field"
+	HeaderGroup      = "group"
 	HeaderCount      = "count"
 	HeaderMin        = "min"
 	HeaderMax        = "max"
@@ -19,8 +28,16 @@ const (
 	HeaderAverage    = "avg"
 	HeaderMedian     = "median"
 	HeaderPercentile = "percentile"
+
+	HeaderVariance       = "variance"
+	HeaderSampleVariance = "samplevariance"
+	HeaderStdDev         = "stddev"
+	HeaderSampleStdDev   = "samplestddev"
 )
 
+// ExitCodeUsageError はオプション引数が不正なときの終了コードです。
+const ExitCodeUsageError = 2
+
 // Options はコマンドラインオプション引数です。
 type Options struct {
 	Version             func()                `short:"v" long:"version" description:"バージョン情報"`
@@ -31,19 +48,228 @@ type Options struct {
 	SumFlag             bool                  `short:"u" long:"sum" description:"合計を出力する"`
 	AverageFlag         bool                  `short:"a" long:"avg" description:"平均値を出力する"`
 	MedianFlag          bool                  `short:"m" long:"median" description:"中央値を出力する"`
-	Percentile          int                   `short:"p" long:"percentile" description:"パーセンタイル値を出力する(1~100)"`
+	Percentiles         Percentiles           `short:"p" long:"percentile" description:"パーセンタイル値を出力する(1~100)。カンマ区切りで複数指定可(50,90,99.9)"`
+	StdDevFlag          bool                  `short:"S" long:"stddev" description:"標準偏差(母集団、標本)を出力する"`
+	VarianceFlag        bool                  `short:"V" long:"variance" description:"分散(母分散、不偏分散)を出力する"`
+	QuantileMethod      string                `short:"q" long:"quantile-method" description:"中央値、パーセンタイル値の算出方法" choice:"legacy" choice:"nearest" choice:"linear" choice:"midpoint" choice:"lower" choice:"higher" default:"legacy"`
+	ApproxFlag          bool                  `long:"approx" description:"中央値、パーセンタイル値をデータを保持せずに近似する(t-digest)"`
 	SortedFlag          bool                  `short:"s" long:"sorted" description:"入力元データがソート済みフラグ"`
 	HeaderFlag          bool                  `short:"H" long:"header" description:"ヘッダを出力する"`
 	InputDelimiter      string                `short:"d" long:"indelimiter" description:"入力の区切り文字を指定" default:"\t"`
+	CSVFlag             bool                  `long:"csv" description:"入力をCSV(RFC 4180)として読み込む。-d未指定時の区切り文字はカンマ"`
+	Unit                Unit                  `long:"unit" description:"12.5ms, 1.5MiBのような単位付きの値を読み込み、指定の単位の数値にする(ms, s, us, B, KiB, MBなど)"`
+	HumanFlag           bool                  `long:"human" description:"--unitの指定があるとき、統計値を人が読みやすい単位で出力する"`
+	JSONField           string                `long:"json-field" description:"入力を1行1つのJSONオブジェクトとして読み込み、指定のキーの値を集計する(latency_ms / timing.total)"`
 	OutputDelimiter     string                `short:"D" long:"outdelimiter" description:"出力の区切り文字を指定" default:"\t"`
 	OutFile             string                `short:"o" long:"outfile" description:"出力ファイルパス"`
-	SeparatableFilePath []SeparatableFilePath `short:"f" long:"fieldfilepath" description:"複数フィールド持つファイルと、その区切り位置指定(N:filepath)"`
+	SeparatableFilePath []SeparatableFilePath `short:"f" long:"fieldfilepath" description:"複数フィールド持つファイルと、その区切り位置指定(N:filepath, N,M:filepath, ヘッダ名:filepath)"`
 	IgnoreHeaderRows    int                   `short:"I" long:"ignoreheader" description:"入力データヘッダを指定行無視する"`
+	Fields              Fields                `long:"fields" description:"1回の読み込みで集計する複数のフィールド(2,3,5 / 2-5 / ヘッダ名)"`
+	GroupBy             Field                 `short:"g" long:"group-by" description:"指定のフィールドの値ごとに集計する(フィールド番号、あるいはヘッダ名)"`
+	OutputFormat        string                `short:"F" long:"format" description:"出力形式" choice:"text" choice:"json" choice:"ndjson" default:"text"`
+	Assertions          []Assertion           `long:"assert" description:"統計値の閾値の条件。満たさなければ終了コード3で終了する(p99<250, avg<=100, count>=10000)"`
+	FailOnRegression    Threshold             `long:"fail-on-regression" description:"compareで候補の統計値が基準から指定の割合を超えて増加したら終了コード3で終了する(5%)"`
+	TimeField           Field                 `long:"time-field" description:"--windowで時間窓を判定する時刻のフィールド(フィールド番号、ヘッダ名、--json-fieldではキーのパス)"`
+	TimeFormat          TimeFormat            `long:"time-format" description:"時刻のフィールドの形式(RFC3339, unix, unixms, あるいは2006-01-02 15:04:05のようなGoの時刻のレイアウト)" default:"RFC3339"`
+	Window              time.Duration         `long:"window" description:"時刻のフィールドの値で指定の幅の時間窓に分け、時間窓ごとに集計する(10s, 1m)"`
+	FollowFlag          bool                  `long:"follow" description:"入力ファイルをtail -Fのように追跡し、中断されるまで--intervalごとに集計結果を出力する"`
+	Interval            time.Duration         `long:"interval" description:"--followで集計結果を出力する間隔" default:"5s"`
+	FollowMode          string                `long:"follow-mode" description:"--followで出力する集計結果(cumulative: 開始からの累計, interval: 直前の間隔の分)" choice:"cumulative" choice:"interval" default:"cumulative"`
+	TotalFlag           bool                  `long:"total" description:"すべての入力を併合した合計の行(TOTAL)を追加する"`
+	HistogramFlag       bool                  `long:"histogram" description:"値の分布をヒストグラムで出力する(histogramと同じ)"`
+	Bins                Bins                  `long:"bins" description:"histogramの階級の数、あるいはカンマ区切りの境界値(10 / 10,50,100,500)"`
+	BinScale            string                `long:"bin-scale" description:"histogramで階級の数を指定したときの階級の幅" choice:"linear" choice:"log" default:"linear"`
+	PlotFlag            bool                  `long:"plot" description:"histogramの件数を棒グラフで描く(histogramと同時に指定される)"`
+	Width               int                   `long:"width" description:"--plotの出力の幅(デフォルトは端末の幅)"`
+	SparklineFlag       bool                  `long:"sparkline" description:"値の分布をスパークラインで出力する。階級は--bins, --bin-scaleに従う"`
+	EmitState           string                `long:"emit-state" description:"mergeで併合できる集計の状態(件数、合計、最小値、最大値、分散、中央値とパーセンタイル値のスケッチ)をファイルに出力する"`
+
+	// Compare は基準と候補の2つの入力を比較するモードか否かです。
+	// 先頭の引数がcompareのときにtrueになる。
+	Compare bool
+	// Merge は--emit-stateの状態ファイルを併合するモードか否かです。
+	// 先頭の引数がmergeのときにtrueになる。
+	Merge bool
+}
+
+const (
+	// OutputFormatText は区切り文字で値を連結する出力形式です。
+	OutputFormatText = "text"
+	// OutputFormatJSON は全データをJSON配列で出力する形式です。
+	OutputFormatJSON = "json"
+	// OutputFormatNDJSON は1データ1行のJSONで出力する形式です。
+	OutputFormatNDJSON = "ndjson"
+)
+
+const (
+	// FollowModeCumulative は--followで開始からの累計を出力するモードです。
+	FollowModeCumulative = "cumulative"
+	// FollowModeInterval は--followで直前の間隔に追記された分のみを出力するモードです。
+	FollowModeInterval = "interval"
+)
+
+// Percentiles は出力するパーセンタイルの一覧です。
+// 指定された順番で出力する。
+type Percentiles []float64
+
+// UnmarshalFlag はカンマ区切りのパーセンタイル指定を解析して追加する。
+// 複数回指定された場合は追記する。重複した値は無視する。
+func (p *Percentiles) UnmarshalFlag(v string) error {
+	for _, s := range strings.Split(v, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return errors.New("not allowed empty value.")
+		}
+
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			msg := fmt.Sprintf("expected that percentile is number. input=%s", s)
+			return errors.New(msg)
+		}
+
+		// 0以下はNG
+		if n <= 0 {
+			msg := fmt.Sprintf("percentile is over 0. input=%v", s)
+			return errors.New(msg)
+		}
+
+		if !p.Contains(n) {
+			*p = append(*p, n)
+		}
+	}
+	return nil
+}
+
+func (p Percentiles) MarshalFlag() (string, error) {
+	ss := make([]string, len(p))
+	for i, v := range p {
+		ss[i] = formatPercentile(v)
+	}
+	return strings.Join(ss, ","), nil
+}
+
+// Contains はパーセンタイルが指定済みか否かを返す。
+func (p Percentiles) Contains(n float64) bool {
+	for _, v := range p {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
+
+// PercentileHeader はパーセンタイル値のヘッダ名(95percentile, 99.9percentile)を返す。
+func PercentileHeader(p float64) string {
+	return formatPercentile(p) + HeaderPercentile
+}
+
+func formatPercentile(p float64) string {
+	return strconv.FormatFloat(p, 'f', -1, 64)
+}
+
+// Field はフィールド番号(1〜)、あるいはヘッダ名によるフィールド指定です。
+type Field struct {
+	Index int
+	Name  string
 }
 
+// UnmarshalFlag は数値ならフィールド番号、それ以外ならヘッダ名として解析する。
+func (f *Field) UnmarshalFlag(v string) error {
+	v = strings.TrimSpace(v)
+
+	// 空文字はNG
+	if v == "" {
+		return errors.New("not allowed empty value.")
+	}
+
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		f.Index = 0
+		f.Name = v
+		return nil
+	}
+
+	// 1未満はNG
+	if i < 1 {
+		msg := fmt.Sprintf("integer is over 1. input=%v", i)
+		return errors.New(msg)
+	}
+
+	f.Index = i
+	f.Name = ""
+	return nil
+}
+
+func (f Field) MarshalFlag() (string, error) {
+	if f.Name != "" {
+		return f.Name, nil
+	}
+	if f.Index < 1 {
+		return "", nil
+	}
+	return strconv.Itoa(f.Index), nil
+}
+
+// Specified はフィールドが指定されているか否かを返す。
+func (f Field) Specified() bool {
+	return 0 < f.Index || f.Name != ""
+}
+
+// Fields は複数のフィールド指定です。
+type Fields []Field
+
+// UnmarshalFlag はカンマ区切りのフィールド指定を解析して追加する。
+// 2-5のような範囲指定もできる。複数回指定された場合は追記する。
+func (fs *Fields) UnmarshalFlag(v string) error {
+	for _, s := range strings.Split(v, ",") {
+		// 範囲指定
+		if parts := strings.Split(s, "-"); len(parts) == 2 {
+			from, err1 := strconv.Atoi(strings.TrimSpace(parts[0]))
+			to, err2 := strconv.Atoi(strings.TrimSpace(parts[1]))
+			if err1 == nil && err2 == nil {
+				if from < 1 || to < from {
+					msg := fmt.Sprintf("illegal field range. input=%s", s)
+					return errors.New(msg)
+				}
+				for i := from; i <= to; i++ {
+					*fs = append(*fs, Field{Index: i})
+				}
+				continue
+			}
+		}
+
+		var f Field
+		if err := f.UnmarshalFlag(s); err != nil {
+			return err
+		}
+		*fs = append(*fs, f)
+	}
+	return nil
+}
+
+func (fs Fields) MarshalFlag() (string, error) {
+	ss := make([]string, len(fs))
+	for i, f := range fs {
+		s, err := f.MarshalFlag()
+		if err != nil {
+			return "", err
+		}
+		ss[i] = s
+	}
+	return strings.Join(ss, ","), nil
+}
+
+// SeparatableFilePath は集計するフィールドとファイルパスの指定です。
+// フィールドはフィールド番号(1〜)、あるいはヘッダ名で指定する。
+// 2,3,5や2-5のように複数指定したときはFieldsにセットする。
 type SeparatableFilePath struct {
 	FieldIndex int
-	FilePath   string
+	// FieldName はヘッダ名によるフィールド指定です。
+	// 指定したときは先頭行をヘッダとしてフィールド番号を解決する。
+	FieldName string
+	// Fields は複数のフィールド指定です。
+	Fields   Fields
+	FilePath string
 }
 
 func (s *SeparatableFilePath) UnmarshalFlag(v string) error {
@@ -73,9 +299,31 @@ func (s *SeparatableFilePath) UnmarshalFlag(v string) error {
 		return errors.New(msg)
 	}
 
+	// 複数のフィールド指定
+	var fs Fields
+	if err := fs.UnmarshalFlag(stri); err != nil {
+		return err
+	}
+	if 1 < len(fs) {
+		s.FieldIndex = 0
+		s.FieldName = ""
+		s.Fields = fs
+		s.FilePath = fn
+		return nil
+	}
+
 	i, err := strconv.Atoi(stri)
 	if err != nil {
-		return errors.New("expected that first values is integer that separated by a : .")
+		// 数値として解釈できるものはヘッダ名とみなさない
+		if _, err := strconv.ParseFloat(stri, 64); err == nil {
+			return errors.New("expected that first values is integer or header name that separated by a : .")
+		}
+
+		// 数値でなければヘッダ名
+		s.FieldIndex = 0
+		s.FieldName = stri
+		s.FilePath = fn
+		return nil
 	}
 
 	// 1未満はNG
@@ -85,25 +333,64 @@ func (s *SeparatableFilePath) UnmarshalFlag(v string) error {
 	}
 
 	s.FieldIndex = i
+	s.FieldName = ""
 	s.FilePath = fn
 
 	return nil
 }
 
 func (s SeparatableFilePath) MarshalFlag() (string, error) {
+	if 0 < len(s.Fields) {
+		fs, err := s.Fields.MarshalFlag()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s:%s", fs, s.FilePath), nil
+	}
+	if s.FieldName != "" {
+		return fmt.Sprintf("%s:%s", s.FieldName, s.FilePath), nil
+	}
 	return fmt.Sprintf("%d:%s", s.FieldIndex, s.FilePath), nil
 }
 
 // OutValues はFormat関数で使用する値構造体です。
 type OutValues struct {
-	FileName   string
-	Count      int
-	Min        float64
-	Max        float64
-	Sum        float64
-	Average    float64
-	Median     float64
-	Percentile float64
+	FileName string
+	// FieldIndex は集計したフィールド番号です。
+	FieldIndex int
+	// FieldName は集計したフィールドのヘッダ名です。ヘッダ名で指定したときのみセットする。
+	FieldName string
+	// GroupKey は集計キーの値です。集計キーを指定したときのみセットする。
+	GroupKey string
+	Count    int
+	Min      float64
+	Max      float64
+	Sum      float64
+	Average  float64
+	Median   float64
+	// Percentiles はパーセンタイルをキーとしたパーセンタイル値です。
+	Percentiles map[float64]float64
+	// Variance は母分散です。
+	Variance float64
+	// SampleVariance は標本分散(不偏分散)です。
+	SampleVariance float64
+	// StdDev は母集団の標準偏差です。
+	StdDev float64
+	// SampleStdDev は標本標準偏差です。
+	SampleStdDev float64
+	// Histogram はヒストグラムの階級です。histogram、sparklineのときのみセットする。
+	Histogram []Bucket
+	// Window は時間窓の開始時刻です。--windowの指定があるときのみセットする。
+	Window time.Time
+}
+
+// FieldLabel は集計したフィールドの表示名を返す。
+// ヘッダ名があればヘッダ名、なければフィールド番号を返す。
+func (v OutValues) FieldLabel() string {
+	if v.FieldName != "" {
+		return v.FieldName
+	}
+	return strconv.Itoa(v.FieldIndex)
 }
 
 // Parse はコマンドラインオプションを解析する。
@@ -116,12 +403,43 @@ func Parse(version string) (Options, []string) {
 		os.Exit(0)
 	}
 
-	args, err := flags.Parse(&opts)
+	parser := flags.NewParser(&opts, flags.Default)
+	args, err := parser.Parse()
 	if err != nil {
-		os.Exit(0)
+		// ヘルプの表示は正常終了。エラーメッセージはパーサが出力済み
+		if e, ok := err.(*flags.Error); ok && e.Type == flags.ErrHelp {
+			os.Exit(0)
+		}
+		os.Exit(ExitCodeUsageError)
 	}
 	opts.Setup()
 
+	// CSVの区切り文字は、-dで明示的に指定されなければカンマにする
+	d := parser.FindOptionByLongName("indelimiter")
+	if opts.CSVFlag && (!d.IsSet() || d.IsSetDefault()) {
+		opts.InputDelimiter = ","
+	}
+
+	// 先頭の引数がcompare, histogram, mergeのときはそれぞれのモード
+	if 0 < len(args) {
+		switch args[0] {
+		case CommandCompare:
+			opts.Compare = true
+			args = args[1:]
+		case CommandMerge:
+			opts.Merge = true
+			args = args[1:]
+		case CommandHistogram:
+			opts.HistogramFlag = true
+			args = args[1:]
+		}
+	}
+
+	// 棒グラフはヒストグラムに描く
+	if opts.PlotFlag {
+		opts.HistogramFlag = true
+	}
+
 	// -f フラグがあるときはファイルパスを上書きする
 	l := len(opts.SeparatableFilePath)
 	if 1 <= l {
@@ -132,11 +450,161 @@ func Parse(version string) (Options, []string) {
 		args = fns
 	}
 
+	if err := opts.validateCommand(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(ExitCodeUsageError)
+	}
+
 	return opts, args
 }
 
+// validateCommand はモードごとの引数を検証する。
+// 比較モードでは基準と候補の2つの入力が必要。
+// ヒストグラム、スパークラインはデータを保持して階級を決めるため、近似とは併用できない。
+func (o Options) validateCommand(args []string) error {
+	if o.HistogramFlag {
+		if o.Compare {
+			return errors.New("histogram is not available with compare.")
+		}
+		if o.ApproxFlag {
+			return errors.New("--approx is not available with histogram.")
+		}
+	}
+	if o.PlotFlag && o.OutputFormat != "" && o.OutputFormat != OutputFormatText {
+		return errors.New("--plot is only available with text format.")
+	}
+	if o.SparklineFlag {
+		if o.Compare {
+			return errors.New("--sparkline is not available with compare.")
+		}
+		if o.ApproxFlag {
+			return errors.New("--approx is not available with --sparkline.")
+		}
+	}
+	if o.Bins.Edges != nil && o.BinScale == BinScaleLog {
+		return errors.New("--bin-scale is not available with explicit bin edges.")
+	}
+	if o.TotalFlag && o.Compare {
+		return errors.New("--total is not available with compare.")
+	}
+	// 近似、併合ではスケッチから補間するので、算出方法は選べない
+	if (o.ApproxFlag || o.Merge) && o.QuantileMethod != "" && o.QuantileMethod != "legacy" {
+		return errors.New("--quantile-method is not available with --approx and merge.")
+	}
+	if err := o.validateWindow(); err != nil {
+		return err
+	}
+	if err := o.validateFollow(args); err != nil {
+		return err
+	}
+	if err := o.validateMerge(args); err != nil {
+		return err
+	}
+	// 併合では単位は状態ファイルの指定に従う
+	if o.HumanFlag && !o.Unit.Specified() && !o.Merge {
+		return errors.New("--human needs --unit.")
+	}
+	if o.JSONField != "" {
+		if o.CSVFlag {
+			return errors.New("--csv is not available with --json-field.")
+		}
+		if 0 < len(o.Fields) || o.MultiFields() {
+			return errors.New("multiple fields are not available with --json-field.")
+		}
+	}
+	if !o.Compare {
+		if o.FailOnRegression.Specified {
+			return errors.New("--fail-on-regression is only available with compare.")
+		}
+		return nil
+	}
+	if len(args) != 2 {
+		msg := fmt.Sprintf("compare needs baseline and candidate inputs. inputs=%d", len(args))
+		return errors.New(msg)
+	}
+	return nil
+}
+
+// validateWindow は時間窓の指定を検証する。
+// 時間窓と時刻のフィールドは同時に指定する。
+// 時間窓ごとの行を出力するため、集計キー、複数フィールド、ヒストグラム、比較とは併用できない。
+func (o Options) validateWindow() error {
+	if o.Window < 0 {
+		msg := fmt.Sprintf("--window must be positive. window=%v", o.Window)
+		return errors.New(msg)
+	}
+	if o.Window == 0 {
+		if o.TimeField.Specified() {
+			return errors.New("--time-field needs --window.")
+		}
+		return nil
+	}
+	if !o.TimeField.Specified() {
+		return errors.New("--window needs --time-field.")
+	}
+	if o.Compare {
+		return errors.New("--window is not available with compare.")
+	}
+	if o.HistogramFlag {
+		return errors.New("--window is not available with histogram.")
+	}
+	if o.GroupBy.Specified() {
+		return errors.New("--window is not available with --group-by.")
+	}
+	if 0 < len(o.Fields) || o.MultiFields() {
+		return errors.New("multiple fields are not available with --window.")
+	}
+	return nil
+}
+
+// validateFollow は--followの指定を検証する。
+// 追跡できるのは入力ファイルのみ。中断されるまで出力し続けるため、
+// ファイル出力、閾値の判定、比較、ヒストグラム、合計の行とは併用できない。
+func (o Options) validateFollow(args []string) error {
+	if !o.FollowFlag {
+		return nil
+	}
+	if o.Interval <= 0 {
+		msg := fmt.Sprintf("--interval must be positive. interval=%v", o.Interval)
+		return errors.New(msg)
+	}
+	if len(args) < 1 {
+		return errors.New("--follow needs input files.")
+	}
+	if o.Compare {
+		return errors.New("--follow is not available with compare.")
+	}
+	if o.HistogramFlag {
+		return errors.New("--follow is not available with histogram.")
+	}
+	if o.TotalFlag {
+		return errors.New("--follow is not available with --total.")
+	}
+	if o.OutFile != "" {
+		return errors.New("--follow is not available with --outfile.")
+	}
+	if 0 < len(o.Assertions) {
+		return errors.New("--follow is not available with --assert.")
+	}
+	return nil
+}
+
+// MultiFields は1つの入力から複数のフィールドを集計するか否かを返す。
+func (o Options) MultiFields() bool {
+	if 1 < len(o.Fields) {
+		return true
+	}
+	for _, v := range o.SeparatableFilePath {
+		if 1 < len(v.Fields) {
+			return true
+		}
+	}
+	return false
+}
+
 // Setup はオプションのデフォルト値をセットします。
 // Count, Min, Max, Sumのいずれもfalseの場合は、すべてtrueにする。
+// ただし標準偏差と分散はデフォルトでは出力しない。
 func (o *Options) Setup() {
 	if !o.CountFlag &&
 		!o.MinFlag &&
@@ -144,25 +612,84 @@ func (o *Options) Setup() {
 		!o.SumFlag &&
 		!o.AverageFlag &&
 		!o.MedianFlag &&
-		o.Percentile <= 0 {
+		!o.StdDevFlag &&
+		!o.VarianceFlag &&
+		len(o.Percentiles) < 1 {
 		o.CountFlag = true
 		o.MinFlag = true
 		o.SumFlag = true
 		o.MaxFlag = true
 		o.AverageFlag = true
 		o.MedianFlag = true
-		o.Percentile = 95
+		o.Percentiles = Percentiles{95}
 	}
-	if 100 < o.Percentile {
-		msg := fmt.Sprintf("warn: percentile is from 1 to 100. percentile=%d", o.Percentile)
-		fmt.Fprintln(os.Stderr, msg)
-		o.Percentile = 100
+
+	var ps Percentiles
+	for _, p := range o.Percentiles {
+		if 100 < p {
+			msg := fmt.Sprintf("warn: percentile is from 1 to 100. percentile=%v", p)
+			fmt.Fprintln(os.Stderr, msg)
+			p = 100
+		}
+		if !ps.Contains(p) {
+			ps = append(ps, p)
+		}
 	}
+	o.Percentiles = ps
+}
+
+// formatFloat は数値を出力用の文字列に変換する。
+// 不要な末尾の0埋めは削除する。-0は0として出力する。
+// 非常に大きい値、小さい値は桁が膨大になったり0に丸められたりするので指数表記にする。
+func formatFloat(n float64) string {
+	if n == 0 {
+		return "0"
+	}
+
+	a := math.Abs(n)
+	if !math.IsInf(n, 0) && (1e21 <= a || a < 1e-6) {
+		return strconv.FormatFloat(n, 'g', -1, 64)
+	}
+
+	s := fmt.Sprintf("%f", n)
+	// 不要な末尾の0埋めを削除
+	s = strings.TrimRight(s, "0")
+	s = strings.TrimRight(s, ".")
+	return s
+}
+
+// quoteField は区切り文字、ダブルクォート、改行を含む値を、CSVと同じようにダブルクォートで囲む。
+// 値の中のダブルクォートは2つ重ねる。
+func quoteField(s, delim string) string {
+	if !strings.ContainsAny(s, "\"\r\n") && (delim == "" || !strings.Contains(s, delim)) {
+		return s
+	}
+	return `"` + strings.Replace(s, `"`, `""`, -1) + `"`
 }
 
 // Format は出力用のデータをオプションに応じて出力ように整形する。
-func Format(vs []OutValues, opts Options) []string {
-	percentileHeader := fmt.Sprintf("%d%s", opts.Percentile, HeaderPercentile)
+// 出力形式にjson, ndjsonが指定されている場合はJSONで出力する。
+// JSONに変換できない値があればエラーを返す。
+func Format(vs []OutValues, opts Options) ([]string, error) {
+	if opts.HistogramFlag {
+		return formatHistogram(vs, opts)
+	}
+	switch opts.OutputFormat {
+	case OutputFormatJSON:
+		return formatJSON(vs, opts)
+	case OutputFormatNDJSON:
+		return formatNDJSON(vs, opts)
+	}
+
+	// すべての入力の処理に失敗したときは出力しない
+	if len(vs) < 1 {
+		return []string{}, nil
+	}
+
+	percentileHeaders := make([]string, len(opts.Percentiles))
+	for i, p := range opts.Percentiles {
+		percentileHeaders[i] = PercentileHeader(p)
+	}
 
 	maps := make([]map[string]string, len(vs))
 	for i, v := range vs {
@@ -176,11 +703,7 @@ func Format(vs []OutValues, opts Options) []string {
 				}
 
 				if n, ok := v.(float64); ok {
-					s := fmt.Sprintf("%f", n)
-					// 不要な末尾の0埋めを削除
-					s = strings.TrimRight(s, "0")
-					s = strings.TrimRight(s, ".")
-					m[h] = s
+					m[h] = opts.formatStat(h, n)
 					return
 				}
 
@@ -189,9 +712,12 @@ func Format(vs []OutValues, opts Options) []string {
 			}
 		}
 
+		setFunc(0 < opts.Window, HeaderWindow, formatWindow(v.Window))
 		if v.FileName != "" {
 			setFunc(!opts.NoFileNameFlag, FileName, v.FileName)
 		}
+		setFunc(opts.MultiFields(), HeaderField, v.FieldLabel())
+		setFunc(opts.GroupBy.Specified(), HeaderGroup, quoteField(v.GroupKey, opts.OutputDelimiter))
 		setFunc(opts.CountFlag, HeaderCount, v.Count)
 		setFunc(opts.MinFlag, HeaderMin, v.Min)
 		setFunc(opts.MaxFlag, HeaderMax, v.Max)
@@ -199,7 +725,14 @@ func Format(vs []OutValues, opts Options) []string {
 		setFunc(opts.AverageFlag, HeaderAverage, v.Average)
 		setFunc(opts.MedianFlag, HeaderMedian, v.Median)
 
-		setFunc(0 < opts.Percentile, percentileHeader, v.Percentile)
+		for i, p := range opts.Percentiles {
+			setFunc(true, percentileHeaders[i], v.Percentiles[p])
+		}
+		setFunc(opts.VarianceFlag, HeaderVariance, v.Variance)
+		setFunc(opts.VarianceFlag, HeaderSampleVariance, v.SampleVariance)
+		setFunc(opts.StdDevFlag, HeaderStdDev, v.StdDev)
+		setFunc(opts.StdDevFlag, HeaderSampleStdDev, v.SampleStdDev)
+		setFunc(opts.SparklineFlag, HeaderSparkline, Sparkline(v.Histogram))
 
 		maps[i] = m
 	}
@@ -210,17 +743,29 @@ func Format(vs []OutValues, opts Options) []string {
 	// オプションがあるとセットしない
 	headers := make([]string, 0)
 	m := maps[0]
-	for _, k := range []string{
+	keys := []string{
+		HeaderWindow,
 		FileName,
+		HeaderField,
+		HeaderGroup,
 		HeaderCount,
 		HeaderMin,
 		HeaderMax,
 		HeaderSum,
 		HeaderAverage,
 		HeaderMedian,
-		percentileHeader,
-	} {
-		if m[k] != "" {
+	}
+	keys = append(keys, percentileHeaders...)
+	keys = append(keys,
+		HeaderVariance,
+		HeaderSampleVariance,
+		HeaderStdDev,
+		HeaderSampleStdDev,
+		HeaderSparkline,
+	)
+	for _, k := range keys {
+		// 集計キーは空文字もありうるので値の有無で判定する
+		if _, ok := m[k]; ok {
 			headers = append(headers, k)
 		}
 	}
@@ -240,5 +785,5 @@ func Format(vs []OutValues, opts Options) []string {
 		lines = append(lines, s)
 	}
 
-	return lines
+	return lines, nil
 }
@@ -1,8 +1,10 @@
 package options
 
 import (
+	"math"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -43,6 +45,41 @@ func TestUnmarshalFlag(t *testing.T) {
 				FilePath:   " foobar4.txt ",
 			},
 		},
+		TestUnmarshalFlagData{ // ヘッダ名指定
+			in: "elapsed:results.csv",
+			out: SeparatableFilePath{
+				FieldName: "elapsed",
+				FilePath:  "results.csv",
+			},
+		},
+		TestUnmarshalFlagData{ // ヘッダ名はトリムする
+			in: " elapsed :results.csv",
+			out: SeparatableFilePath{
+				FieldName: "elapsed",
+				FilePath:  "results.csv",
+			},
+		},
+		TestUnmarshalFlagData{ // 複数フィールド指定
+			in: "2,3,5:sample.csv",
+			out: SeparatableFilePath{
+				Fields:   Fields{Field{Index: 2}, Field{Index: 3}, Field{Index: 5}},
+				FilePath: "sample.csv",
+			},
+		},
+		TestUnmarshalFlagData{ // 範囲指定
+			in: "2-4:sample.csv",
+			out: SeparatableFilePath{
+				Fields:   Fields{Field{Index: 2}, Field{Index: 3}, Field{Index: 4}},
+				FilePath: "sample.csv",
+			},
+		},
+		TestUnmarshalFlagData{ // ヘッダ名の複数指定
+			in: "latency,bytes:results.csv",
+			out: SeparatableFilePath{
+				Fields:   Fields{Field{Name: "latency"}, Field{Name: "bytes"}},
+				FilePath: "results.csv",
+			},
+		},
 	}
 	for _, v := range tds {
 		s := SeparatableFilePath{}
@@ -77,6 +114,12 @@ func TestUnmarshalFlag(t *testing.T) {
 		TestUnmarshalFlagData{ // 無
 			in: "",
 		},
+		TestUnmarshalFlagData{ // 範囲が逆
+			in: "5-2:foobar.txt",
+		},
+		TestUnmarshalFlagData{ // 複数指定に0値
+			in: "0,2:foobar.txt",
+		},
 	}
 	for _, v := range tds {
 		t.Log("<" + v.in + ">")
@@ -86,6 +129,144 @@ func TestUnmarshalFlag(t *testing.T) {
 	}
 }
 
+type TestFieldUnmarshalFlagData struct {
+	in  string
+	out Field
+}
+
+func TestMarshalFlag(t *testing.T) {
+	s, err := SeparatableFilePath{FieldIndex: 2, FilePath: "a.csv"}.MarshalFlag()
+	assert.NoError(t, err)
+	assert.Equal(t, "2:a.csv", s)
+
+	s, err = SeparatableFilePath{FieldName: "elapsed", FilePath: "a.csv"}.MarshalFlag()
+	assert.NoError(t, err)
+	assert.Equal(t, "elapsed:a.csv", s)
+}
+
+type TestFieldsUnmarshalFlagData struct {
+	in  string
+	out Fields
+}
+
+func TestFieldsUnmarshalFlag(t *testing.T) {
+	// 正常系
+	tds := []TestFieldsUnmarshalFlagData{
+		TestFieldsUnmarshalFlagData{ // 1つだけ
+			in:  "2",
+			out: Fields{Field{Index: 2}},
+		},
+		TestFieldsUnmarshalFlagData{ // 範囲とヘッダ名の混在
+			in:  "1,3-4,elapsed,response-time",
+			out: Fields{Field{Index: 1}, Field{Index: 3}, Field{Index: 4}, Field{Name: "elapsed"}, Field{Name: "response-time"}},
+		},
+	}
+	for _, v := range tds {
+		var fs Fields
+		err := fs.UnmarshalFlag(v.in)
+		assert.NoError(t, err)
+		assert.Equal(t, v.out, fs)
+
+		s, err := fs.MarshalFlag()
+		assert.NoError(t, err)
+		t.Log(s)
+	}
+
+	// 異常系
+	for _, v := range []string{"", "1,", "0-2", "3-1", "0"} {
+		t.Log("<" + v + ">")
+		var fs Fields
+		assert.Error(t, fs.UnmarshalFlag(v))
+	}
+}
+
+func TestMultiFields(t *testing.T) {
+	assert.False(t, Options{}.MultiFields())
+	assert.False(t, Options{Fields: Fields{Field{Index: 2}}}.MultiFields())
+	assert.True(t, Options{Fields: Fields{Field{Index: 2}, Field{Index: 3}}}.MultiFields())
+	assert.True(t, Options{
+		SeparatableFilePath: []SeparatableFilePath{
+			SeparatableFilePath{FieldIndex: 1, FilePath: "a.txt"},
+			SeparatableFilePath{Fields: Fields{Field{Index: 2}, Field{Index: 3}}, FilePath: "b.txt"},
+		},
+	}.MultiFields())
+}
+
+func TestFieldUnmarshalFlag(t *testing.T) {
+	// 正常系
+	tds := []TestFieldUnmarshalFlagData{
+		TestFieldUnmarshalFlagData{ // フィールド番号
+			in:  "2",
+			out: Field{Index: 2},
+		},
+		TestFieldUnmarshalFlagData{ // ヘッダ名
+			in:  "endpoint",
+			out: Field{Name: "endpoint"},
+		},
+		TestFieldUnmarshalFlagData{ // 前後の空白はトリムする
+			in:  " endpoint ",
+			out: Field{Name: "endpoint"},
+		},
+	}
+	for _, v := range tds {
+		var f Field
+		err := f.UnmarshalFlag(v.in)
+		assert.NoError(t, err)
+		assert.Equal(t, v.out, f)
+		assert.True(t, f.Specified())
+	}
+
+	// 異常系
+	for _, v := range []string{"", " ", "0", "-1"} {
+		t.Log("<" + v + ">")
+		var f Field
+		assert.Error(t, f.UnmarshalFlag(v))
+	}
+
+	assert.False(t, Field{}.Specified())
+}
+
+type TestPercentilesUnmarshalFlagData struct {
+	in  string
+	out Percentiles
+}
+
+func TestPercentilesUnmarshalFlag(t *testing.T) {
+	// 正常系
+	tds := []TestPercentilesUnmarshalFlagData{
+		TestPercentilesUnmarshalFlagData{ // 1つだけ
+			in:  "95",
+			out: Percentiles{95},
+		},
+		TestPercentilesUnmarshalFlagData{ // 複数、小数
+			in:  "50, 90,99.9",
+			out: Percentiles{50, 90, 99.9},
+		},
+		TestPercentilesUnmarshalFlagData{ // 重複は除外
+			in:  "90,50,90",
+			out: Percentiles{90, 50},
+		},
+	}
+	for _, v := range tds {
+		var p Percentiles
+		err := p.UnmarshalFlag(v.in)
+		assert.NoError(t, err)
+		assert.Equal(t, v.out, p)
+	}
+
+	// 異常系
+	for _, v := range []string{"", "a", "50,", "0", "-1", "50,,90"} {
+		t.Log("<" + v + ">")
+		var p Percentiles
+		assert.Error(t, p.UnmarshalFlag(v))
+	}
+}
+
+func TestPercentileHeader(t *testing.T) {
+	assert.Equal(t, "95percentile", PercentileHeader(95))
+	assert.Equal(t, "99.9percentile", PercentileHeader(99.9))
+}
+
 type testdata struct {
 	in     Options
 	expect Options
@@ -111,7 +292,7 @@ func TestParse(t *testing.T) {
 				SumFlag:        true,
 				AverageFlag:    true,
 				MedianFlag:     true,
-				Percentile:     95,
+				Percentiles:    Percentiles{95},
 				SortedFlag:     false,
 				HeaderFlag:     false,
 				InputDelimiter: "\t",
@@ -149,13 +330,41 @@ func TestParse(t *testing.T) {
 				SumFlag:        false,
 				AverageFlag:    false,
 				MedianFlag:     false,
-				Percentile:     90,
+				Percentiles:    Percentiles{90},
 				SortedFlag:     false,
 				HeaderFlag:     false,
 				InputDelimiter: "\t",
 			},
 			outargs: []string{},
 		},
+		TestParseData{ // パーセンタイルは複数指定できる
+			args: []string{
+				"main.go",
+				"-p",
+				"50,90",
+				"-p",
+				"99.9,90",
+			},
+			outopts: Options{
+				Percentiles:    Percentiles{50, 90, 99.9},
+				InputDelimiter: "\t",
+			},
+			outargs: []string{},
+		},
+		TestParseData{ // 算出方法の指定
+			args: []string{
+				"main.go",
+				"-m",
+				"--quantile-method",
+				"linear",
+			},
+			outopts: Options{
+				MedianFlag:     true,
+				QuantileMethod: "linear",
+				InputDelimiter: "\t",
+			},
+			outargs: []string{},
+		},
 		TestParseData{ // -f で上書きされる
 			args: []string{
 				"main.go",
@@ -172,7 +381,7 @@ func TestParse(t *testing.T) {
 				SumFlag:        true,
 				AverageFlag:    true,
 				MedianFlag:     true,
-				Percentile:     95,
+				Percentiles:    Percentiles{95},
 				SortedFlag:     false,
 				HeaderFlag:     false,
 				InputDelimiter: "\t",
@@ -192,6 +401,82 @@ func TestParse(t *testing.T) {
 				"sample2.txt",
 			},
 		},
+		TestParseData{
+			args: []string{
+				"main.go",
+				"--csv",
+				"testdata",
+			},
+			outopts: Options{ // CSVの区切り文字はカンマ
+				CountFlag:      true,
+				MinFlag:        true,
+				MaxFlag:        true,
+				SumFlag:        true,
+				AverageFlag:    true,
+				MedianFlag:     true,
+				Percentiles:    Percentiles{95},
+				InputDelimiter: ",",
+				CSVFlag:        true,
+			},
+			outargs: []string{"testdata"},
+		},
+		TestParseData{
+			args: []string{
+				"main.go",
+				"--csv",
+				"-d", ";",
+				"testdata",
+			},
+			outopts: Options{ // 明示的な区切り文字の指定を優先
+				CountFlag:      true,
+				MinFlag:        true,
+				MaxFlag:        true,
+				SumFlag:        true,
+				AverageFlag:    true,
+				MedianFlag:     true,
+				Percentiles:    Percentiles{95},
+				InputDelimiter: ";",
+				CSVFlag:        true,
+			},
+			outargs: []string{"testdata"},
+		},
+		TestParseData{
+			args: []string{
+				"main.go",
+				"compare",
+				"--fail-on-regression", "5%",
+				"base.txt",
+				"cand.txt",
+			},
+			outopts: Options{ // 比較モード
+				CountFlag:        true,
+				MinFlag:          true,
+				MaxFlag:          true,
+				SumFlag:          true,
+				AverageFlag:      true,
+				MedianFlag:       true,
+				Percentiles:      Percentiles{95},
+				InputDelimiter:   "\t",
+				FailOnRegression: Threshold{Percent: 5, Specified: true},
+				Compare:          true,
+			},
+			outargs: []string{"base.txt", "cand.txt"},
+		},
+		TestParseData{
+			args: []string{
+				"main.go",
+				"merge",
+				"-c",
+				"a.bin",
+				"b.bin",
+			},
+			outopts: Options{ // 併合モード
+				CountFlag:      true,
+				InputDelimiter: "\t",
+				Merge:          true,
+			},
+			outargs: []string{"a.bin", "b.bin"},
+		},
 	}
 	for _, v := range tds {
 		os.Args = v.args
@@ -202,9 +487,17 @@ func TestParse(t *testing.T) {
 		assert.Equal(t, v.outopts.SumFlag, opts.SumFlag)
 		assert.Equal(t, v.outopts.AverageFlag, opts.AverageFlag)
 		assert.Equal(t, v.outopts.MedianFlag, opts.MedianFlag)
+		assert.Equal(t, v.outopts.Percentiles, opts.Percentiles)
+		if v.outopts.QuantileMethod != "" {
+			assert.Equal(t, v.outopts.QuantileMethod, opts.QuantileMethod)
+		}
 		assert.Equal(t, v.outopts.SortedFlag, opts.SortedFlag)
 		assert.Equal(t, v.outopts.HeaderFlag, opts.HeaderFlag)
 		assert.Equal(t, v.outopts.InputDelimiter, opts.InputDelimiter)
+		assert.Equal(t, v.outopts.CSVFlag, opts.CSVFlag)
+		assert.Equal(t, v.outopts.Compare, opts.Compare)
+		assert.Equal(t, v.outopts.Merge, opts.Merge)
+		assert.Equal(t, v.outopts.FailOnRegression, opts.FailOnRegression)
 		assert.Equal(t, v.outargs, args)
 	}
 }
@@ -220,7 +513,7 @@ func TestSetup(t *testing.T) {
 				SumFlag:     true,
 				AverageFlag: true,
 				MedianFlag:  true,
-				Percentile:  95,
+				Percentiles: Percentiles{95},
 			},
 		},
 		testdata{
@@ -235,18 +528,26 @@ func TestSetup(t *testing.T) {
 		},
 		testdata{
 			in: Options{ // 95パーセンタイル値でも同様
-				Percentile: 80,
+				Percentiles: Percentiles{80},
+			},
+			expect: Options{
+				Percentiles: Percentiles{80},
+			},
+		},
+		testdata{
+			in: Options{ // 標準偏差のみ指定したときも他はtrueにならない
+				StdDevFlag: true,
 			},
 			expect: Options{
-				Percentile: 80,
+				StdDevFlag: true,
 			},
 		},
 		testdata{
 			in: Options{ // 上限値100を超えると100になおす
-				Percentile: 9999,
+				Percentiles: Percentiles{9999},
 			},
 			expect: Options{
-				Percentile: 100,
+				Percentiles: Percentiles{100},
 			},
 		},
 	}
@@ -258,6 +559,9 @@ func TestSetup(t *testing.T) {
 		assert.Equal(t, v.expect.SumFlag, v.in.SumFlag)
 		assert.Equal(t, v.expect.AverageFlag, v.in.AverageFlag)
 		assert.Equal(t, v.expect.MedianFlag, v.in.MedianFlag)
+		assert.Equal(t, v.expect.Percentiles, v.in.Percentiles)
+		assert.Equal(t, v.expect.StdDevFlag, v.in.StdDevFlag)
+		assert.Equal(t, v.expect.VarianceFlag, v.in.VarianceFlag)
 		assert.Equal(t, v.expect.SortedFlag, v.in.SortedFlag)
 		assert.Equal(t, v.expect.HeaderFlag, v.in.HeaderFlag)
 		assert.Equal(t, v.expect.InputDelimiter, v.in.InputDelimiter)
@@ -275,22 +579,22 @@ func TestFormat(t *testing.T) {
 		TestFormatData{
 			ovs: []OutValues{
 				OutValues{
-					Count:      2,
-					Min:        1.0,
-					Max:        2.0,
-					Sum:        3.0,
-					Average:    1.5,
-					Median:     1.0,
-					Percentile: 4.0,
+					Count:       2,
+					Min:         1.0,
+					Max:         2.0,
+					Sum:         3.0,
+					Average:     1.5,
+					Median:      1.0,
+					Percentiles: map[float64]float64{95: 4.0},
 				},
 				OutValues{
-					Count:      100,
-					Min:        1.0,
-					Max:        2.0,
-					Sum:        3.0,
-					Average:    1.5,
-					Median:     1.0,
-					Percentile: 95.0,
+					Count:       100,
+					Min:         1.0,
+					Max:         2.0,
+					Sum:         3.0,
+					Average:     1.5,
+					Median:      1.0,
+					Percentiles: map[float64]float64{95: 95.0},
 				},
 			},
 			opts: Options{
@@ -302,7 +606,7 @@ func TestFormat(t *testing.T) {
 				MedianFlag:      false,
 				SortedFlag:      false,
 				HeaderFlag:      false,
-				Percentile:      95,
+				Percentiles:     Percentiles{95},
 				InputDelimiter:  "\t",
 				OutputDelimiter: "\t",
 			},
@@ -314,22 +618,22 @@ func TestFormat(t *testing.T) {
 		TestFormatData{
 			ovs: []OutValues{
 				OutValues{
-					Count:      2,
-					Min:        1.0,
-					Max:        2.0,
-					Sum:        3.0,
-					Average:    1.5,
-					Median:     1.0,
-					Percentile: 4.0,
+					Count:       2,
+					Min:         1.0,
+					Max:         2.0,
+					Sum:         3.0,
+					Average:     1.5,
+					Median:      1.0,
+					Percentiles: map[float64]float64{95: 4.0},
 				},
 				OutValues{
-					Count:      100,
-					Min:        1.0,
-					Max:        2.0,
-					Sum:        3.0,
-					Average:    1.5,
-					Median:     1.0,
-					Percentile: 95.0,
+					Count:       100,
+					Min:         1.0,
+					Max:         2.0,
+					Sum:         3.0,
+					Average:     1.5,
+					Median:      1.0,
+					Percentiles: map[float64]float64{95: 95.0},
 				},
 			},
 			opts: Options{
@@ -341,7 +645,7 @@ func TestFormat(t *testing.T) {
 				MedianFlag:      true,
 				SortedFlag:      false,
 				HeaderFlag:      false,
-				Percentile:      95,
+				Percentiles:     Percentiles{95},
 				InputDelimiter:  "\t",
 				OutputDelimiter: ",",
 			},
@@ -573,9 +877,213 @@ func TestFormat(t *testing.T) {
 				"1,3,1.5",
 			},
 		},
+		TestFormatData{
+			ovs: []OutValues{
+				OutValues{
+					FileName: "foo.csv",
+					GroupKey: "/a",
+					Count:    3,
+					Sum:      60,
+				},
+				OutValues{
+					FileName: "foo.csv",
+					GroupKey: "",
+					Count:    1,
+					Sum:      5,
+				},
+			},
+			opts: Options{
+				CountFlag:       true,
+				SumFlag:         true,
+				GroupBy:         Field{Index: 1},
+				HeaderFlag:      true,
+				OutputDelimiter: ",",
+			},
+			out: []string{
+				"filename,group,count,sum",
+				"foo.csv,/a,3,60",
+				"foo.csv,,1,5",
+			},
+		},
+		TestFormatData{
+			ovs: []OutValues{
+				OutValues{
+					FileName:   "foo.csv",
+					FieldIndex: 2,
+					Count:      3,
+				},
+				OutValues{
+					FileName:   "foo.csv",
+					FieldIndex: 3,
+					FieldName:  "bytes",
+					Count:      2,
+				},
+			},
+			opts: Options{
+				CountFlag:       true,
+				Fields:          Fields{Field{Index: 2}, Field{Name: "bytes"}},
+				HeaderFlag:      true,
+				OutputDelimiter: ",",
+			},
+			out: []string{
+				"filename,field,count",
+				"foo.csv,2,3",
+				"foo.csv,bytes,2",
+			},
+		},
+		TestFormatData{
+			ovs: []OutValues{
+				OutValues{
+					Count: 1000,
+					Percentiles: map[float64]float64{
+						50:   500,
+						99:   990,
+						99.9: 999,
+					},
+				},
+			},
+			opts: Options{
+				CountFlag:       true,
+				Percentiles:     Percentiles{50, 99, 99.9},
+				HeaderFlag:      true,
+				OutputDelimiter: ",",
+			},
+			out: []string{
+				"count,50percentile,99percentile,99.9percentile",
+				"1000,500,990,999",
+			},
+		},
+		TestFormatData{
+			ovs: []OutValues{
+				OutValues{
+					Count:          5,
+					Average:        3.0,
+					Variance:       2.0,
+					SampleVariance: 2.5,
+					StdDev:         1.5,
+					SampleStdDev:   1.25,
+				},
+			},
+			opts: Options{
+				CountFlag:       true,
+				StdDevFlag:      true,
+				VarianceFlag:    true,
+				HeaderFlag:      true,
+				OutputDelimiter: ",",
+			},
+			out: []string{
+				"count,variance,samplevariance,stddev,samplestddev",
+				"5,2,2.5,1.5,1.25",
+			},
+		},
+	}
+
+	for _, v := range tds {
+		lines, err := Format(v.ovs, v.opts)
+		assert.NoError(t, err)
+		assert.Equal(t, v.out, lines)
+	}
+}
+
+func TestFormatEmpty(t *testing.T) {
+	opts := Options{CountFlag: true, HeaderFlag: true}
+	lines, err := Format(nil, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{}, lines)
+	opts.OutputFormat = OutputFormatJSON
+	lines, err = Format(nil, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"[", "]"}, lines)
+}
+
+type TestQuoteFieldData struct {
+	desc  string
+	s     string
+	delim string
+	out   string
+}
+
+func TestQuoteField(t *testing.T) {
+	tds := []TestQuoteFieldData{
+		TestQuoteFieldData{desc: "そのまま", s: "GET /a", delim: "\t", out: "GET /a"},
+		TestQuoteFieldData{desc: "空文字", s: "", delim: "\t", out: ""},
+		TestQuoteFieldData{desc: "区切り文字", s: "a\tb", delim: "\t", out: "\"a\tb\""},
+		TestQuoteFieldData{desc: "他の区切り文字", s: "a,b", delim: "\t", out: "a,b"},
+		TestQuoteFieldData{desc: "複数文字の区切り文字", s: "a::b", delim: "::", out: `"a::b"`},
+		TestQuoteFieldData{desc: "改行", s: "a\nb", delim: "\t", out: "\"a\nb\""},
+		TestQuoteFieldData{desc: "復帰", s: "a\rb", delim: "\t", out: "\"a\rb\""},
+		TestQuoteFieldData{desc: "ダブルクォート", s: `say "hi"`, delim: "\t", out: `"say ""hi"""`},
+	}
+	for _, v := range tds {
+		assert.Equal(t, v.out, quoteField(v.s, v.delim), v.desc)
 	}
+}
+
+func TestFormatFloat(t *testing.T) {
+	assert.Equal(t, "0", formatFloat(0))
+	assert.Equal(t, "0", formatFloat(math.Copysign(0, -1)))
+	assert.Equal(t, "1.5", formatFloat(1.5))
+	assert.Equal(t, "-3", formatFloat(-3))
+	assert.Equal(t, "100", formatFloat(100))
+	assert.Equal(t, "1.414214", formatFloat(math.Sqrt2))
+	assert.Equal(t, "1.2e+308", formatFloat(1.2e308))
+	assert.Equal(t, "-1.5e+308", formatFloat(-1.5e308))
+	assert.Equal(t, "1e-10", formatFloat(1e-10))
+	assert.Equal(t, "+Inf", formatFloat(math.Inf(1)))
+	assert.Equal(t, "-Inf", formatFloat(math.Inf(-1)))
+	assert.Equal(t, "NaN", formatFloat(math.NaN()))
+}
+
+func TestValidateJSONField(t *testing.T) {
+	assert.NoError(t, Options{JSONField: "latency_ms", GroupBy: Field{Name: "path"}}.validateCommand([]string{"a.txt"}))
+	assert.Error(t, Options{JSONField: "latency_ms", CSVFlag: true}.validateCommand([]string{"a.txt"}))
+	assert.Error(t, Options{JSONField: "latency_ms", Fields: Fields{Field{Index: 1}}}.validateCommand([]string{"a.txt"}))
+}
+
+func TestValidateQuantileMethod(t *testing.T) {
+	assert.NoError(t, Options{QuantileMethod: "linear"}.validateCommand([]string{"a.txt"}))
+	assert.NoError(t, Options{QuantileMethod: "legacy", ApproxFlag: true}.validateCommand([]string{"a.txt"}))
+	assert.Error(t, Options{QuantileMethod: "linear", ApproxFlag: true}.validateCommand([]string{"a.txt"}))
+	assert.Error(t, Options{QuantileMethod: "nearest", Merge: true}.validateCommand([]string{"a.bin"}))
+}
 
+func TestValidateTotal(t *testing.T) {
+	assert.NoError(t, Options{TotalFlag: true}.validateCommand([]string{"a.txt", "b.txt"}))
+	assert.Error(t, Options{TotalFlag: true, Compare: true}.validateCommand([]string{"a.txt", "b.txt"}))
+}
+
+type TestValidateFollowData struct {
+	desc string
+	opts Options
+	args []string
+	err  bool
+}
+
+func TestValidateFollow(t *testing.T) {
+	f := func(o Options) Options {
+		o.FollowFlag = true
+		o.Interval = 5 * time.Second
+		return o
+	}
+	args := []string{"a.log"}
+	tds := []TestValidateFollowData{
+		TestValidateFollowData{desc: "追跡", opts: f(Options{}), args: args},
+		TestValidateFollowData{desc: "間隔の指定のみ", opts: Options{Interval: -1}, args: args},
+		TestValidateFollowData{desc: "時間窓", opts: f(Options{Window: time.Second, TimeField: Field{Index: 1}}), args: args},
+		TestValidateFollowData{desc: "負の間隔", opts: Options{FollowFlag: true, Interval: -time.Second}, args: args, err: true},
+		TestValidateFollowData{desc: "標準入力", opts: f(Options{}), args: nil, err: true},
+		TestValidateFollowData{desc: "比較", opts: f(Options{Compare: true}), args: []string{"a.log", "b.log"}, err: true},
+		TestValidateFollowData{desc: "ヒストグラム", opts: f(Options{HistogramFlag: true}), args: args, err: true},
+		TestValidateFollowData{desc: "合計の行", opts: f(Options{TotalFlag: true}), args: args, err: true},
+		TestValidateFollowData{desc: "ファイル出力", opts: f(Options{OutFile: "out.txt"}), args: args, err: true},
+		TestValidateFollowData{desc: "閾値の判定", opts: f(Options{Assertions: []Assertion{Assertion{Stat: HeaderCount, Op: "<", Value: 1}}}), args: args, err: true},
+	}
 	for _, v := range tds {
-		assert.Equal(t, v.out, Format(v.ovs, v.opts))
+		err := v.opts.validateCommand(v.args)
+		if v.err {
+			assert.Error(t, err, v.desc)
+			continue
+		}
+		assert.NoError(t, err, v.desc)
 	}
 }
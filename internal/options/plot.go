@@ -0,0 +1,145 @@
+package options
+
+import (
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/width"
+)
+
+const (
+	HeaderSparkline = "sparkline"
+	HeaderBar       = "bar"
+)
+
+// DefaultWidth は出力の幅が不明なときに使う幅です。
+const DefaultWidth = 80
+
+// minBarWidth は出力の幅が狭くても確保する棒グラフの最大の長さです。
+const minBarWidth = 10
+
+// barChar は棒グラフを描く文字です。
+const barChar = "#"
+
+// sparkChars はスパークラインの値の大きさを表す文字です。
+var sparkChars = []rune("▁▂▃▄▅▆▇█")
+
+// tabWidth は表示幅の計算に使うタブの幅です。
+const tabWidth = 8
+
+// Sparkline はヒストグラムの階級ごとの件数を1文字ずつのスパークラインにする。
+// 件数が最大の階級を█とし、件数が0の階級は空白にする。
+func Sparkline(bs []Bucket) string {
+	max := 0
+	for _, b := range bs {
+		if max < b.Count {
+			max = b.Count
+		}
+	}
+
+	var sb strings.Builder
+	for _, b := range bs {
+		if b.Count < 1 {
+			sb.WriteRune(' ')
+			continue
+		}
+		i := int(math.Ceil(float64(b.Count)/float64(max)*float64(len(sparkChars)))) - 1
+		sb.WriteRune(sparkChars[i])
+	}
+	return sb.String()
+}
+
+// bar は件数を最大の件数に対する長さの棒グラフにする。
+// 件数が1以上なら少なくとも1文字は描く。
+func bar(count, max, width int) string {
+	if count < 1 || max < 1 {
+		return ""
+	}
+	n := int(math.Round(float64(count) / float64(max) * float64(width)))
+	if n < 1 {
+		n = 1
+	}
+	return strings.Repeat(barChar, n)
+}
+
+// plotLines は整形済みの各行の末尾に、区切り文字に続けて棒グラフの列を追加する。
+// 棒グラフの開始位置が揃うように空白で埋め、出力の幅に収まる長さで描く。
+// 行の幅が大きく出力の幅に収まらないときも、棒グラフは最低限の長さで描く。
+// headerがtrueのときは先頭の行をヘッダとして扱う。
+func plotLines(lines []string, counts []int, header bool, width int, delim string) []string {
+	if width < 1 {
+		width = DefaultWidth
+	}
+
+	prefix := 0
+	for _, l := range lines {
+		if w := displayWidth(l + delim); prefix < w {
+			prefix = w
+		}
+	}
+
+	barWidth := width - prefix
+	if barWidth < minBarWidth {
+		barWidth = minBarWidth
+	}
+
+	max := 0
+	for _, c := range counts {
+		if max < c {
+			max = c
+		}
+	}
+
+	ls := make([]string, len(lines))
+	for i, l := range lines {
+		var b string
+		if header {
+			if i == 0 {
+				b = HeaderBar
+			} else {
+				b = bar(counts[i-1], max, barWidth)
+			}
+		} else {
+			b = bar(counts[i], max, barWidth)
+		}
+		if b == "" {
+			ls[i] = l + delim
+			continue
+		}
+		pad := strings.Repeat(" ", prefix-displayWidth(l+delim))
+		ls[i] = l + delim + pad + b
+	}
+	return ls
+}
+
+// displayWidth は端末に表示したときの文字列の幅を返す。
+// タブは次のタブ位置まで進めて数える。
+func displayWidth(s string) int {
+	w := 0
+	for _, r := range s {
+		if r == '\t' {
+			w += tabWidth - w%tabWidth
+			continue
+		}
+		if r != utf8.RuneError {
+			w += runeWidth(r)
+		}
+	}
+	return w
+}
+
+// runeWidth は端末に表示したときの文字の幅を返す。
+// 東アジアの全角文字、幅広の文字は2、結合文字、書式制御文字は0、それ以外は1として数える。
+// 幅が曖昧な文字(罫線、ブロック要素など)は1として数える。
+func runeWidth(r rune) int {
+	if unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) {
+		return 0
+	}
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,163 @@
+package options
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSparkline(t *testing.T) {
+	for _, v := range []struct {
+		desc string
+		in   []int
+		out  string
+	}{
+		{"段階", []int{1, 2, 3, 4, 5, 6, 7, 8}, "▁▂▃▄▅▆▇█"},
+		{"0件は空白、少なくとも▁", []int{100, 0, 1}, "█ ▁"},
+		{"すべて0件", []int{0, 0}, "  "},
+		{"階級なし", nil, ""},
+	} {
+		bs := make([]Bucket, len(v.in))
+		for i, c := range v.in {
+			bs[i].Count = c
+		}
+		assert.Equal(t, v.out, Sparkline(bs), v.desc)
+	}
+}
+
+func TestBar(t *testing.T) {
+	assert.Equal(t, "##########", bar(50, 50, 10))
+	assert.Equal(t, "#####", bar(25, 50, 10))
+	// 1件以上なら少なくとも1文字
+	assert.Equal(t, "#", bar(1, 1000, 10))
+	assert.Equal(t, "", bar(0, 50, 10))
+	assert.Equal(t, "", bar(0, 0, 10))
+}
+
+func TestDisplayWidth(t *testing.T) {
+	assert.Equal(t, 0, displayWidth(""))
+	assert.Equal(t, 3, displayWidth("abc"))
+	assert.Equal(t, 8, displayWidth("abc\t"))
+	assert.Equal(t, 16, displayWidth("abcdefgh\t"))
+	assert.Equal(t, 17, displayWidth("a\tb\tc"))
+	assert.Equal(t, 3, displayWidth("▁▂▃"))
+
+	// 全角文字、幅広の文字は2、半角カナは1
+	assert.Equal(t, 6, displayWidth("日本語"))
+	assert.Equal(t, 4, displayWidth("ＡＢ"))
+	assert.Equal(t, 3, displayWidth("ｱｲｳ"))
+	assert.Equal(t, 5, displayWidth("/日本"))
+	assert.Equal(t, 8, displayWidth("日本語\t"))
+	assert.Equal(t, 9, displayWidth("日本語a\tb"))
+	// 結合文字、書式制御文字は0
+	assert.Equal(t, 1, displayWidth("e\u0301"))
+	assert.Equal(t, 2, displayWidth("a\u200bb"))
+}
+
+type TestPlotLinesData struct {
+	desc   string
+	lines  []string
+	counts []int
+	header bool
+	width  int
+	delim  string
+	out    []string
+}
+
+func TestPlotLines(t *testing.T) {
+	tds := []TestPlotLinesData{
+		TestPlotLinesData{
+			desc:   "行の幅を除いた出力の幅で描き、開始位置を揃える",
+			lines:  []string{"a 1", "bbb 20", "c 0"},
+			counts: []int{1, 20, 0},
+			width:  17,
+			delim:  " ",
+			out: []string{
+				"a 1    #",
+				"bbb 20 ##########",
+				"c 0 ",
+			},
+		},
+		TestPlotLinesData{
+			desc:   "ヘッダ、タブ区切り",
+			lines:  []string{"lower\tcount", "0\t4", "10\t2"},
+			counts: []int{4, 2},
+			header: true,
+			width:  26,
+			delim:  "\t",
+			out: []string{
+				"lower\tcount\tbar",
+				"0\t4\t##########",
+				"10\t2\t#####",
+			},
+		},
+		TestPlotLinesData{
+			desc:   "全角文字は2文字分の幅で開始位置を揃える",
+			lines:  []string{"日本 1", "abc 2"},
+			counts: []int{1, 2},
+			width:  17,
+			delim:  " ",
+			out: []string{
+				"日本 1 #####",
+				"abc 2  ##########",
+			},
+		},
+		TestPlotLinesData{
+			desc:   "出力の幅が狭くても最低限の長さで描く",
+			lines:  []string{"abcdefghij 3"},
+			counts: []int{3},
+			width:  5,
+			delim:  " ",
+			out:    []string{"abcdefghij 3 ##########"},
+		},
+	}
+	for _, v := range tds {
+		assert.Equal(t, v.out, plotLines(v.lines, v.counts, v.header, v.width, v.delim), v.desc)
+	}
+}
+
+func TestFormatPlot(t *testing.T) {
+	vs := []OutValues{OutValues{FileName: "a.txt", Histogram: []Bucket{
+		Bucket{Lower: 0, Upper: 10, Count: 3},
+		Bucket{Lower: 10, Upper: 20, Count: 1},
+	}}}
+	opts := Options{HistogramFlag: true, PlotFlag: true, NoFileNameFlag: true, OutputDelimiter: " ", Width: 30}
+	lines, err := Format(vs, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"0 10 3 75 75   ###############",
+		"10 20 1 25 100 #####",
+	}, lines)
+}
+
+func TestFormatSparkline(t *testing.T) {
+	vs := []OutValues{
+		OutValues{FileName: "a.txt", Count: 3, Histogram: []Bucket{Bucket{Count: 1}, Bucket{Count: 0}, Bucket{Count: 2}}},
+		OutValues{FileName: "b.txt", Count: 0},
+	}
+	opts := Options{CountFlag: true, SparklineFlag: true, HeaderFlag: true, OutputDelimiter: "\t"}
+	lines, err := Format(vs, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"filename\tcount\tsparkline",
+		"a.txt\t3\t▄ █",
+		"b.txt\t0\t",
+	}, lines)
+
+	opts.OutputFormat = OutputFormatNDJSON
+	lines, err = Format(vs, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`{"filename":"a.txt","fieldindex":0,"count":3,"sparkline":"▄ █"}`,
+		`{"filename":"b.txt","fieldindex":0,"count":0,"sparkline":""}`,
+	}, lines)
+}
+
+func TestValidatePlot(t *testing.T) {
+	assert.NoError(t, Options{HistogramFlag: true, PlotFlag: true, OutputFormat: OutputFormatText}.validateCommand([]string{"a.txt"}))
+	assert.Error(t, Options{HistogramFlag: true, PlotFlag: true, OutputFormat: OutputFormatJSON}.validateCommand([]string{"a.txt"}))
+	assert.NoError(t, Options{SparklineFlag: true}.validateCommand([]string{"a.txt"}))
+	assert.Error(t, Options{SparklineFlag: true, ApproxFlag: true}.validateCommand([]string{"a.txt"}))
+	assert.Error(t, Options{SparklineFlag: true, Compare: true}.validateCommand([]string{"a.txt", "b.txt"}))
+	assert.Error(t, Options{SparklineFlag: true, BinScale: BinScaleLog, Bins: Bins{Edges: []float64{1, 2}}}.validateCommand([]string{"a.txt"}))
+}
@@ -0,0 +1,50 @@
+package options
+
+import (
+	"strings"
+
+	arthmath "github.com/jiro4989/arth/math"
+)
+
+// Unit は単位付きの値を読み込むときの単位です。
+type Unit struct {
+	arthmath.Unit
+}
+
+// UnmarshalFlag は単位の表記を解析する。
+func (u *Unit) UnmarshalFlag(v string) error {
+	x, err := arthmath.ParseUnit(strings.TrimSpace(v))
+	if err != nil {
+		return err
+	}
+	u.Unit = x
+	return nil
+}
+
+func (u Unit) MarshalFlag() (string, error) {
+	return u.Name, nil
+}
+
+// Specified は単位が指定されているか否かを返す。
+func (u Unit) Specified() bool {
+	return u.Name != ""
+}
+
+// hasUnit は統計値が入力と同じ単位を持つか否かを返す。
+// データ数は単位を持たず、分散は単位の2乗になるので人が読みやすい単位にしない。
+func hasUnit(h string) bool {
+	switch h {
+	case HeaderCount, HeaderVariance, HeaderSampleVariance:
+		return false
+	}
+	return true
+}
+
+// formatStat は統計値を出力用の文字列に変換する。
+// --humanの指定があれば、単位を持つ統計値を人が読みやすい単位にする。
+func (o Options) formatStat(h string, n float64) string {
+	if o.HumanFlag && o.Unit.Specified() && hasUnit(h) {
+		return o.Unit.Format(n)
+	}
+	return formatFloat(n)
+}
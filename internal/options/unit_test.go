@@ -0,0 +1,85 @@
+package options
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnitUnmarshalFlag(t *testing.T) {
+	var u Unit
+	assert.False(t, u.Specified())
+	assert.NoError(t, u.UnmarshalFlag(" mib "))
+	assert.True(t, u.Specified())
+	s, err := u.MarshalFlag()
+	assert.NoError(t, err)
+	assert.Equal(t, "MiB", s)
+
+	assert.Error(t, u.UnmarshalFlag("parsec"))
+}
+
+func TestFormatHuman(t *testing.T) {
+	var u Unit
+	assert.NoError(t, u.UnmarshalFlag("ms"))
+	vs := []OutValues{OutValues{
+		Count:       3,
+		Min:         0.34,
+		Max:         1200,
+		Average:     12.5,
+		Percentiles: map[float64]float64{99: 1200},
+		Variance:    2500,
+		StdDev:      50,
+	}}
+	opts := Options{
+		CountFlag:       true,
+		MinFlag:         true,
+		MaxFlag:         true,
+		AverageFlag:     true,
+		Percentiles:     Percentiles{99},
+		VarianceFlag:    true,
+		StdDevFlag:      true,
+		OutputDelimiter: "\t",
+		Unit:            u,
+	}
+	// 単位を指定しても--humanがなければ数値のまま
+	lines, err := Format(vs, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"3\t0.34\t1200\t12.5\t1200\t2500\t0\t50\t0"}, lines)
+
+	// データ数と分散は単位を付けない
+	opts.HumanFlag = true
+	lines, err = Format(vs, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"3\t340µs\t1.2s\t12.5ms\t1.2s\t2500\t0\t50ms\t0ms"}, lines)
+
+	// JSONは数値のまま
+	opts.OutputFormat = OutputFormatNDJSON
+	lines, err = Format(vs, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`{"fieldindex":0,"count":3,"min":0.34,"max":1200,"avg":12.5,"99percentile":1200,"variance":2500,"samplevariance":0,"stddev":50,"samplestddev":0}`}, lines)
+}
+
+func TestFormatCompareHuman(t *testing.T) {
+	var u Unit
+	assert.NoError(t, u.UnmarshalFlag("ms"))
+	cmps := []Comparison{
+		Comparison{Stat: HeaderCount, Baseline: 100, Candidate: 120, HasBaseline: true, HasCandidate: true},
+		Comparison{Stat: HeaderMax, Baseline: 1000, Candidate: 1500, HasBaseline: true, HasCandidate: true},
+		Comparison{Stat: HeaderAverage, Baseline: 20, Candidate: 15, HasBaseline: true, HasCandidate: true},
+	}
+	opts := Options{OutputDelimiter: "\t", Unit: u, HumanFlag: true}
+	lines, err := FormatCompare(cmps, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"count\t100\t120\t+20\t+20%",
+		"max\t1s\t1.5s\t+500ms\t+50%",
+		"avg\t20ms\t15ms\t-5ms\t-25%",
+	}, lines)
+}
+
+func TestValidateHuman(t *testing.T) {
+	var u Unit
+	assert.NoError(t, u.UnmarshalFlag("ms"))
+	assert.NoError(t, Options{HumanFlag: true, Unit: u}.validateCommand([]string{"a.txt"}))
+	assert.Error(t, Options{HumanFlag: true}.validateCommand([]string{"a.txt"}))
+}
@@ -0,0 +1,36 @@
+package options
+
+import (
+	"strings"
+	"time"
+
+	arthmath "github.com/jiro4989/arth/math"
+)
+
+// HeaderWindow は--windowで集計した時間窓の開始時刻の列のヘッダ名です。
+const HeaderWindow = "window"
+
+// TimeFormat は時刻のフィールドの形式です。
+type TimeFormat struct {
+	arthmath.TimeFormat
+}
+
+// UnmarshalFlag は時刻の形式の表記を解析する。
+func (f *TimeFormat) UnmarshalFlag(v string) error {
+	x, err := arthmath.ParseTimeFormat(strings.TrimSpace(v))
+	if err != nil {
+		return err
+	}
+	f.TimeFormat = x
+	return nil
+}
+
+func (f TimeFormat) MarshalFlag() (string, error) {
+	return f.Name, nil
+}
+
+// formatWindow は時間窓の開始時刻を出力用の文字列に変換する。
+// 1秒未満の幅の時間窓も区別できるように、小数点以下の秒も出力する。
+func formatWindow(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
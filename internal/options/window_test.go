@@ -0,0 +1,90 @@
+package options
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeFormatUnmarshalFlag(t *testing.T) {
+	var f TimeFormat
+	assert.NoError(t, f.UnmarshalFlag(" unixMS "))
+	s, err := f.MarshalFlag()
+	assert.NoError(t, err)
+	assert.Equal(t, "unixms", s)
+
+	assert.NoError(t, f.UnmarshalFlag("2006/01/02 15:04"))
+	s, err = f.MarshalFlag()
+	assert.NoError(t, err)
+	assert.Equal(t, "2006/01/02 15:04", s)
+
+	assert.Error(t, f.UnmarshalFlag("epoch"))
+}
+
+type TestValidateWindowData struct {
+	desc string
+	opts Options
+	err  bool
+}
+
+func TestValidateWindow(t *testing.T) {
+	tf := Field{Name: "time"}
+	tds := []TestValidateWindowData{
+		TestValidateWindowData{desc: "指定なし", opts: Options{}},
+		TestValidateWindowData{desc: "時間窓", opts: Options{Window: 10 * time.Second, TimeField: tf}},
+		TestValidateWindowData{desc: "合計の行", opts: Options{Window: 10 * time.Second, TimeField: tf, TotalFlag: true}},
+		TestValidateWindowData{desc: "負の幅", opts: Options{Window: -time.Second, TimeField: tf}, err: true},
+		TestValidateWindowData{desc: "時刻のフィールドがない", opts: Options{Window: 10 * time.Second}, err: true},
+		TestValidateWindowData{desc: "時間窓がない", opts: Options{TimeField: tf}, err: true},
+		TestValidateWindowData{desc: "集計キー", opts: Options{Window: 10 * time.Second, TimeField: tf, GroupBy: Field{Index: 2}}, err: true},
+		TestValidateWindowData{desc: "複数フィールド", opts: Options{Window: 10 * time.Second, TimeField: tf, Fields: Fields{Field{Index: 2}, Field{Index: 3}}}, err: true},
+		TestValidateWindowData{desc: "ヒストグラム", opts: Options{Window: 10 * time.Second, TimeField: tf, HistogramFlag: true}, err: true},
+	}
+	for _, v := range tds {
+		err := v.opts.validateCommand([]string{"a.txt"})
+		if v.err {
+			assert.Error(t, err, v.desc)
+			continue
+		}
+		assert.NoError(t, err, v.desc)
+	}
+
+	// 比較
+	opts := Options{Window: 10 * time.Second, TimeField: tf, Compare: true}
+	assert.Error(t, opts.validateCommand([]string{"a.txt", "b.txt"}))
+}
+
+func TestFormatWindow(t *testing.T) {
+	w := time.Date(2024, 5, 1, 10, 0, 10, 0, time.UTC)
+	vs := []OutValues{
+		OutValues{FileName: "a.csv", Window: w, Count: 2, Average: 15},
+		OutValues{FileName: "a.csv", Window: w.Add(500 * time.Millisecond), Count: 1, Average: 5},
+	}
+	opts := Options{
+		CountFlag:       true,
+		AverageFlag:     true,
+		HeaderFlag:      true,
+		Window:          500 * time.Millisecond,
+		OutputDelimiter: "\t",
+	}
+	lines, err := Format(vs, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"window\tfilename\tcount\tavg",
+		"2024-05-01T10:00:10Z\ta.csv\t2\t15",
+		"2024-05-01T10:00:10.5Z\ta.csv\t1\t5",
+	}, lines)
+
+	opts.OutputFormat = OutputFormatNDJSON
+	lines, err = Format(vs, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`{"window":"2024-05-01T10:00:10Z","filename":"a.csv","fieldindex":0,"count":2,"avg":15}`,
+		`{"window":"2024-05-01T10:00:10.5Z","filename":"a.csv","fieldindex":0,"count":1,"avg":5}`,
+	}, lines)
+
+	// 閾値の条件を満たさない時間窓
+	vls := CheckAssertions(vs[:1], Options{Assertions: []Assertion{Assertion{Stat: HeaderCount, Op: "<", Value: 2}}})
+	assert.Equal(t, "assertion failed: a.csv window=2024-05-01T10:00:10Z: count<2 actual=2", vls[0].String())
+}
@@ -0,0 +1,109 @@
+package io
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+)
+
+// Chunk はファイルを行の境界で分割した範囲です。
+type Chunk struct {
+	Offset int64
+	Size   int64
+}
+
+// SplitFile は圧縮されていない通常のファイルを、行の境界でおおむね等しいn個の範囲に分割する。
+// 先頭のheaderRows行はヘッダとして範囲に含めずに返すので、各範囲の先頭に付け直して読み込む。
+// 1つの範囲がminSizeバイト未満になるときは分割する数を減らす。
+// 分割できないファイル(圧縮されたファイル、通常のファイル以外、小さいファイル)は
+// 範囲をnilで返すので、ファイル全体を順に読み込む。
+func SplitFile(f *os.File, fn string, headerRows, n int, minSize int64) (header []byte, chunks []Chunk, err error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	size := info.Size()
+	if !info.Mode().IsRegular() || size < 2*minSize || n < 2 {
+		return nil, nil, nil
+	}
+
+	// 先頭が短いファイルでもエラーにせず、読めた分で判定する
+	head := make([]byte, magicLen)
+	m, _ := f.ReadAt(head, 0)
+	if DetectCompression(head[:m], fn) != CompressionNone {
+		return nil, nil, nil
+	}
+
+	// ヘッダは改行で終わる行のみ。ヘッダのあとにデータがなければ分割しない
+	br := bufio.NewReader(io.NewSectionReader(f, 0, size))
+	for i := 0; i < headerRows; i++ {
+		l, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			return nil, nil, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		header = append(header, l...)
+	}
+
+	start := int64(len(header))
+	if k := (size - start) / minSize; k < int64(n) {
+		n = int(k)
+	}
+	if n < 2 {
+		return nil, nil, nil
+	}
+	chunks, err = splitLines(f, start, size, n)
+	if err != nil || len(chunks) < 2 {
+		return nil, nil, err
+	}
+	return header, chunks, nil
+}
+
+// splitLines は範囲[start, end)を、行の境界でおおむね等しいn個以下の範囲に分割する。
+// 各範囲は行の先頭から始まり、改行まで(最後の範囲は末尾まで)を含む。
+func splitLines(r io.ReaderAt, start, end int64, n int) ([]Chunk, error) {
+	var chunks []Chunk
+	off := start
+	for i := 1; i < n && off < end; i++ {
+		// 目安の位置の直前から、次の改行を探す
+		b, err := nextLine(r, start+(end-start)*int64(i)/int64(n)-1, end)
+		if err != nil {
+			return nil, err
+		}
+		if b <= off {
+			continue
+		}
+		chunks = append(chunks, Chunk{Offset: off, Size: b - off})
+		off = b
+	}
+	if off < end {
+		chunks = append(chunks, Chunk{Offset: off, Size: end - off})
+	}
+	return chunks, nil
+}
+
+// nextLine はposから後ろで最初の改行の次の位置を返す。改行がなければendを返す。
+func nextLine(r io.ReaderAt, pos, end int64) (int64, error) {
+	buf := make([]byte, 64*1024)
+	for pos < end {
+		l := int64(len(buf))
+		if end-pos < l {
+			l = end - pos
+		}
+		m, err := r.ReadAt(buf[:l], pos)
+		if i := bytes.IndexByte(buf[:m], '\n'); 0 <= i {
+			return pos + int64(i) + 1, nil
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if m == 0 {
+			break
+		}
+		pos += int64(m)
+	}
+	return end, nil
+}
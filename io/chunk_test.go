@@ -0,0 +1,91 @@
+package io
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type TestSplitLinesData struct {
+	desc   string
+	in     string
+	n      int
+	expect []string
+}
+
+func TestSplitLines(t *testing.T) {
+	tds := []TestSplitLinesData{
+		TestSplitLinesData{desc: "行の境界で分割", in: "1\n2\n3\n4\n", n: 2, expect: []string{"1\n2\n", "3\n4\n"}},
+		TestSplitLinesData{desc: "目安の位置が行の途中", in: "1\n2\n300\n4\n", n: 2, expect: []string{"1\n2\n300\n", "4\n"}},
+		TestSplitLinesData{desc: "目安の位置が行の先頭", in: "1\n2\n3\n4\n", n: 4, expect: []string{"1\n", "2\n", "3\n", "4\n"}},
+		TestSplitLinesData{desc: "末尾に改行がない", in: "1\n2\n3\n4", n: 2, expect: []string{"1\n2\n", "3\n4"}},
+		TestSplitLinesData{desc: "長い行の途中では分割しない", in: "1\n2222222222\n3\n", n: 4, expect: []string{"1\n2222222222\n", "3\n"}},
+		TestSplitLinesData{desc: "改行がない", in: "12345678", n: 4, expect: []string{"12345678"}},
+		TestSplitLinesData{desc: "分割しない", in: "1\n2\n", n: 1, expect: []string{"1\n2\n"}},
+	}
+	for _, v := range tds {
+		r := strings.NewReader(v.in)
+		cs, err := splitLines(r, 0, int64(len(v.in)), v.n)
+		assert.NoError(t, err, v.desc)
+		var got []string
+		for _, c := range cs {
+			got = append(got, v.in[c.Offset:c.Offset+c.Size])
+		}
+		assert.Equal(t, v.expect, got, v.desc)
+	}
+}
+
+func TestSplitFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "arth")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	body := strings.Repeat("12345\n", 100)
+	fn := filepath.Join(dir, "in.txt")
+	assert.NoError(t, ioutil.WriteFile(fn, []byte("h1\nh2\n"+body), 0644))
+	f, err := os.Open(fn)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	// ヘッダを除いて分割し、範囲をつなげると元のデータになる
+	header, cs, err := SplitFile(f, fn, 2, 4, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, "h1\nh2\n", string(header))
+	assert.Equal(t, 4, len(cs))
+	var got []byte
+	for _, c := range cs {
+		b := make([]byte, c.Size)
+		_, err := f.ReadAt(b, c.Offset)
+		assert.NoError(t, err)
+		assert.Equal(t, byte('\n'), b[len(b)-1])
+		got = append(got, b...)
+	}
+	assert.Equal(t, body, string(got))
+
+	// 1つの範囲が最小のバイト数未満にならないように減らす
+	_, cs, err = SplitFile(f, fn, 0, 8, 200)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(cs))
+
+	// 小さいファイル
+	_, cs, err = SplitFile(f, fn, 0, 4, 1000)
+	assert.NoError(t, err)
+	assert.Nil(t, cs)
+
+	// ヘッダのあとにデータがない
+	_, cs, err = SplitFile(f, fn, 200, 4, 10)
+	assert.NoError(t, err)
+	assert.Nil(t, cs)
+
+	// 圧縮されたファイル
+	gz, err := os.Open("../testdata/compressed/bigdata.txt.gz")
+	assert.NoError(t, err)
+	defer gz.Close()
+	_, cs, err = SplitFile(gz, "../testdata/compressed/bigdata.txt.gz", 0, 4, 1)
+	assert.NoError(t, err)
+	assert.Nil(t, cs)
+}
@@ -0,0 +1,107 @@
+package io
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Compression は入力の圧縮形式です。
+type Compression string
+
+const (
+	CompressionNone  Compression = ""
+	CompressionGzip  Compression = "gzip"
+	CompressionBzip2 Compression = "bzip2"
+	CompressionXz    Compression = "xz"
+	CompressionZstd  Compression = "zstd"
+)
+
+// magics は圧縮形式ごとのファイル先頭のマジックバイトです。
+var magics = []struct {
+	compression Compression
+	magic       []byte
+}{
+	{CompressionGzip, []byte{0x1f, 0x8b}},
+	{CompressionBzip2, []byte("BZh")},
+	{CompressionXz, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{CompressionZstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+}
+
+// extensions は圧縮形式ごとのファイルの拡張子です。
+var extensions = map[string]Compression{
+	".gz":   CompressionGzip,
+	".gzip": CompressionGzip,
+	".bz2":  CompressionBzip2,
+	".xz":   CompressionXz,
+	".zst":  CompressionZstd,
+	".zstd": CompressionZstd,
+}
+
+// magicLen はマジックバイトの判定に読む先頭のバイト数です。
+const magicLen = 6
+
+// DetectCompression はファイル先頭のバイト列とファイル名から圧縮形式を判定する。
+// マジックバイトを優先し、一致しなければ拡張子で判定する。
+// 拡張子のみ一致したときは、壊れた圧縮ファイルとして展開時にエラーにする。
+func DetectCompression(head []byte, fn string) Compression {
+	for _, m := range magics {
+		if bytes.HasPrefix(head, m.magic) {
+			return m.compression
+		}
+	}
+	return extensions[strings.ToLower(filepath.Ext(fn))]
+}
+
+// DetectFileCompression はファイルの先頭のバイト列とファイル名から圧縮形式を判定する。
+func DetectFileCompression(fn string) (Compression, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return CompressionNone, err
+	}
+	defer f.Close()
+
+	// 先頭が短いファイルでもエラーにせず、読めた分で判定する
+	head := make([]byte, magicLen)
+	n, _ := io.ReadFull(f, head)
+	return DetectCompression(head[:n], fn), nil
+}
+
+// NewReader は圧縮形式を判定し、展開しながら読み込むReaderを返す。
+// 圧縮されていなければそのまま読み込む。fnは拡張子の判定に使い、標準入力では空文字を渡す。
+// 返したReaderのCloseは展開のリソースのみ解放し、元のReaderは閉じない。
+func NewReader(r io.Reader, fn string) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	// 先頭が短い入力でもエラーにせず、読めた分で判定する
+	head, _ := br.Peek(magicLen)
+
+	switch DetectCompression(head, fn) {
+	case CompressionGzip:
+		return gzip.NewReader(br)
+	case CompressionBzip2:
+		return ioutil.NopCloser(bzip2.NewReader(br)), nil
+	case CompressionXz:
+		xr, err := xz.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(xr), nil
+	case CompressionZstd:
+		// ファイルごとに並列に処理するので、展開は1つのgoroutineで行う
+		zr, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	}
+	return ioutil.NopCloser(br), nil
+}
@@ -0,0 +1,85 @@
+package io
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type TestDetectCompressionData struct {
+	head []byte
+	fn   string
+	out  Compression
+}
+
+func TestDetectCompression(t *testing.T) {
+	tds := []TestDetectCompressionData{
+		TestDetectCompressionData{head: []byte{0x1f, 0x8b, 0x08}, fn: "a.txt", out: CompressionGzip},
+		TestDetectCompressionData{head: []byte("BZh91AY"), fn: "", out: CompressionBzip2},
+		TestDetectCompressionData{head: []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, fn: "", out: CompressionXz},
+		TestDetectCompressionData{head: []byte{0x28, 0xb5, 0x2f, 0xfd}, fn: "", out: CompressionZstd},
+		// マジックバイトを優先する
+		TestDetectCompressionData{head: []byte{0x28, 0xb5, 0x2f, 0xfd}, fn: "a.gz", out: CompressionZstd},
+		// マジックバイトが一致しなければ拡張子で判定する
+		TestDetectCompressionData{head: []byte("1\n2\n"), fn: "a.TXT.GZ", out: CompressionGzip},
+		TestDetectCompressionData{head: []byte("1\n2\n"), fn: "a.zst", out: CompressionZstd},
+		TestDetectCompressionData{head: []byte("1\n2\n"), fn: "a.txt", out: CompressionNone},
+		TestDetectCompressionData{head: nil, fn: "", out: CompressionNone},
+	}
+	for _, v := range tds {
+		assert.Equal(t, v.out, DetectCompression(v.head, v.fn), v.fn)
+	}
+}
+
+func TestDetectFileCompression(t *testing.T) {
+	c, err := DetectFileCompression("../testdata/compressed/bigdata.txt.gz")
+	assert.NoError(t, err)
+	assert.Equal(t, CompressionGzip, c)
+	c, err = DetectFileCompression("../testdata/bigdata.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, CompressionNone, c)
+	_, err = DetectFileCompression("../testdata/not_found.txt")
+	assert.Error(t, err)
+}
+
+func TestNewReader(t *testing.T) {
+	want, err := ioutil.ReadFile("../testdata/bigdata.txt")
+	assert.NoError(t, err)
+
+	for _, fn := range []string{
+		"../testdata/bigdata.txt",
+		"../testdata/compressed/bigdata.txt.gz",
+		"../testdata/compressed/bigdata.txt.bz2",
+		"../testdata/compressed/bigdata.txt.xz",
+		"../testdata/compressed/bigdata.txt.zst",
+		"../testdata/compressed/bigdata_gz.dat",
+	} {
+		b, err := ioutil.ReadFile(fn)
+		assert.NoError(t, err, fn)
+
+		// 拡張子がなくてもマジックバイトで判定する
+		r, err := NewReader(bytes.NewReader(b), "")
+		assert.NoError(t, err, fn)
+		got, err := ioutil.ReadAll(r)
+		assert.NoError(t, err, fn)
+		assert.NoError(t, r.Close(), fn)
+		assert.Equal(t, want, got, fn)
+	}
+
+	// 短い入力
+	r, err := NewReader(bytes.NewReader([]byte("1")), "")
+	assert.NoError(t, err)
+	got, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("1"), got)
+
+	// 拡張子のみ圧縮形式のファイルは壊れたファイルとしてエラー
+	f, err := os.Open("../testdata/compressed/plain.txt.gz")
+	assert.NoError(t, err)
+	defer f.Close()
+	_, err = NewReader(f, f.Name())
+	assert.Error(t, err)
+}
@@ -10,14 +10,21 @@ import (
 )
 
 // WithOpen はファイルを開き、関数を適用する。
-func WithOpen(fn string, f func(r io.Reader) (options.OutValues, error)) (options.OutValues, error) {
+// gzip, bzip2, xz, zstdで圧縮されたファイルは展開しながら読み込む。
+func WithOpen(fn string, f func(r io.Reader) ([]options.OutValues, error)) ([]options.OutValues, error) {
 	if f == nil {
-		return options.OutValues{}, errors.New("適用する関数がnilでした。")
+		return nil, errors.New("適用する関数がnilでした。")
 	}
 
-	r, err := os.Open(fn)
+	fp, err := os.Open(fn)
 	if err != nil {
-		return options.OutValues{}, err
+		return nil, err
+	}
+	defer fp.Close()
+
+	r, err := NewReader(fp, fn)
+	if err != nil {
+		return nil, err
 	}
 	defer r.Close()
 	return f(r)
@@ -2,6 +2,7 @@ package io
 
 import (
 	"io"
+	"io/ioutil"
 	"testing"
 
 	"github.com/jiro4989/arth/internal/options"
@@ -9,17 +10,29 @@ import (
 )
 
 func TestWithOpen(t *testing.T) {
-	WithOpen("", func(r io.Reader) (options.OutValues, error) {
+	WithOpen("", func(r io.Reader) ([]options.OutValues, error) {
 		assert.NotNil(t, r)
-		return options.OutValues{}, nil
+		return nil, nil
 	})
-	WithOpen("../testdata/in/sample.csv", func(r io.Reader) (options.OutValues, error) {
+	WithOpen("../testdata/in/sample.csv", func(r io.Reader) ([]options.OutValues, error) {
 		assert.NotNil(t, r)
-		return options.OutValues{}, nil
+		return nil, nil
 	})
 
+	// 圧縮されたファイルは展開して渡す
+	WithOpen("../testdata/compressed/bigdata.txt.zst", func(r io.Reader) ([]options.OutValues, error) {
+		b, err := ioutil.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, "29\n95\n", string(b[:6]))
+		return nil, nil
+	})
+	_, err := WithOpen("../testdata/compressed/plain.txt.gz", func(r io.Reader) ([]options.OutValues, error) {
+		return nil, nil
+	})
+	assert.Error(t, err)
+
 	d, err := WithOpen("../testdata/normal_num.txtxxxxxxxxxx", nil)
-	assert.Equal(t, d, options.OutValues{})
+	assert.Nil(t, d)
 	assert.Error(t, err)
 }
 
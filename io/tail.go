@@ -0,0 +1,125 @@
+package io
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Tail はファイルをtail -Fのように追跡し、追記された行を読み込む。
+// ファイルが置き換えられたとき(ローテーション)、切り詰められたときは
+// 新しいファイルを先頭から読み込み直す。
+// ファイルが存在しないときは、作成されるまで待つ。
+type Tail struct {
+	name string
+	f    *os.File
+	// info は開いているファイルの情報です。置き換えの判定に使う。
+	info   os.FileInfo
+	offset int64
+	// rest は末尾の改行のない行です。改行が追記されるまで保持する。
+	rest []byte
+}
+
+// NewTail はファイル名のファイルを追跡するTailを生成する。
+// ファイルは最初のReadLinesで開き、先頭から読み込む。
+func NewTail(name string) *Tail {
+	return &Tail{name: name}
+}
+
+// ReadLines は前回の読み込みから追記された、改行で終わる行をまとめて返す。
+// 末尾の改行のない行は、改行が追記されるまで返さない。
+// reopenedは、返した行がファイルを開き直した先頭からの行であるときにtrueになる。
+// 最初にファイルを開いたとき、ローテーションしたとき、切り詰められたときが該当する。
+// ローテーションしたときは、古いファイルの残りをすべて返してから新しいファイルに切り替える。
+// ファイルが存在しないときはエラーにせず、空の結果を返す。
+func (t *Tail) ReadLines() (lines []byte, reopened bool, err error) {
+	if t.f == nil {
+		ok, err := t.open()
+		if !ok || err != nil {
+			return nil, false, err
+		}
+		reopened = true
+	}
+
+	b, err := ioutil.ReadAll(t.f)
+	if err != nil {
+		return nil, false, err
+	}
+	t.offset += int64(len(b))
+
+	// 追記がなければ、置き換え、切り詰めを判定する
+	// 古いファイルの残りを読み切ってから判定するので、ローテーションの前の行も漏らさない
+	if len(b) == 0 && !reopened {
+		info, err := os.Stat(t.name)
+		if os.IsNotExist(err) {
+			// 移動されたあと、新しいファイルが作成されるまでは古いファイルを読む
+			return nil, false, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+
+		if !os.SameFile(t.info, info) {
+			// 古いファイルの改行のない最後の行は、行として返す
+			if 0 < len(t.rest) {
+				l := append(t.rest, '\n')
+				t.Close()
+				return l, false, nil
+			}
+			t.Close()
+			return t.ReadLines()
+		}
+
+		if info.Size() < t.offset {
+			if _, err := t.f.Seek(0, io.SeekStart); err != nil {
+				return nil, false, err
+			}
+			t.offset = 0
+			t.rest = nil
+			lines, _, err := t.ReadLines()
+			return lines, true, err
+		}
+	}
+
+	b = append(t.rest, b...)
+	i := bytes.LastIndexByte(b, '\n')
+	if i < 0 {
+		t.rest = b
+		return nil, reopened, nil
+	}
+	t.rest = append([]byte(nil), b[i+1:]...)
+	return b[:i+1], reopened, nil
+}
+
+// open はファイルを開く。ファイルが存在しないときはfalseを返す。
+func (t *Tail) open() (bool, error) {
+	f, err := os.Open(t.name)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return false, err
+	}
+	t.f = f
+	t.info = info
+	t.offset = 0
+	t.rest = nil
+	return true, nil
+}
+
+// Close は開いているファイルを閉じる。再度ReadLinesを呼ぶとファイルを開き直す。
+func (t *Tail) Close() error {
+	if t.f == nil {
+		return nil
+	}
+	err := t.f.Close()
+	t.f = nil
+	t.info = nil
+	return err
+}
@@ -0,0 +1,108 @@
+package io
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// appendFile はファイルに文字列を追記する。
+func appendFile(t *testing.T, fn, s string) {
+	f, err := os.OpenFile(fn, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	assert.NoError(t, err)
+	defer f.Close()
+	_, err = f.WriteString(s)
+	assert.NoError(t, err)
+}
+
+// readLines はTailの読み込み結果を文字列にする。
+func readLines(t *testing.T, tl *Tail) (string, bool) {
+	b, reopened, err := tl.ReadLines()
+	assert.NoError(t, err)
+	return string(b), reopened
+}
+
+func TestTailReadLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "arth")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "app.log")
+
+	tl := NewTail(fn)
+	defer tl.Close()
+
+	// ファイルが作成されるまで待つ
+	s, reopened := readLines(t, tl)
+	assert.Equal(t, "", s)
+	assert.False(t, reopened)
+
+	// 最初に開いたときは先頭から読む。改行のない行は保持する
+	appendFile(t, fn, "1\n2\n3")
+	s, reopened = readLines(t, tl)
+	assert.Equal(t, "1\n2\n", s)
+	assert.True(t, reopened)
+
+	s, reopened = readLines(t, tl)
+	assert.Equal(t, "", s)
+	assert.False(t, reopened)
+
+	appendFile(t, fn, "0\n4\n")
+	s, reopened = readLines(t, tl)
+	assert.Equal(t, "30\n4\n", s)
+	assert.False(t, reopened)
+
+	// ローテーション。古いファイルの残りを読んでから新しいファイルを先頭から読む
+	appendFile(t, fn, "5")
+	assert.NoError(t, os.Rename(fn, fn+".1"))
+	s, _ = readLines(t, tl)
+	assert.Equal(t, "", s)
+	appendFile(t, fn+".1", "\n6\n")
+	s, reopened = readLines(t, tl)
+	assert.Equal(t, "5\n6\n", s)
+	assert.False(t, reopened)
+
+	// 新しいファイルが作成されるまでは古いファイルを読む
+	s, _ = readLines(t, tl)
+	assert.Equal(t, "", s)
+
+	appendFile(t, fn, "7\n")
+	s, reopened = readLines(t, tl)
+	assert.Equal(t, "7\n", s)
+	assert.True(t, reopened)
+
+	// 切り詰め
+	appendFile(t, fn, "8\n9\n")
+	s, _ = readLines(t, tl)
+	assert.Equal(t, "8\n9\n", s)
+	assert.NoError(t, os.Truncate(fn, 0))
+	appendFile(t, fn, "10\n")
+	s, reopened = readLines(t, tl)
+	assert.Equal(t, "10\n", s)
+	assert.True(t, reopened)
+}
+
+func TestTailReadLinesRotatePartial(t *testing.T) {
+	dir, err := ioutil.TempDir("", "arth")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "app.log")
+
+	appendFile(t, fn, "1\n2")
+	tl := NewTail(fn)
+	defer tl.Close()
+	s, _ := readLines(t, tl)
+	assert.Equal(t, "1\n", s)
+
+	// 古いファイルの改行のない最後の行は、行として返す
+	assert.NoError(t, os.Rename(fn, fn+".1"))
+	appendFile(t, fn, "3\n")
+	s, reopened := readLines(t, tl)
+	assert.Equal(t, "2\n", s)
+	assert.False(t, reopened)
+	s, reopened = readLines(t, tl)
+	assert.Equal(t, "3\n", s)
+	assert.True(t, reopened)
+}
@@ -4,14 +4,19 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"os"
 	"runtime"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/jiro4989/arth/internal/options"
 	arthio "github.com/jiro4989/arth/io"
 	arthmath "github.com/jiro4989/arth/math"
+	"github.com/jiro4989/arth/stats"
 )
 
 // エラー出力ログ
@@ -21,23 +26,132 @@ func init() {
 	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
 }
 
+const (
+	// exitCodeOK は正常終了の終了コードです。
+	exitCodeOK = 0
+	// exitCodeInputError は一部の入力の処理、あるいは出力に失敗したときの終了コードです。
+	exitCodeInputError = 1
+	// exitCodeUsageError はオプション引数が不正なときの終了コードです。
+	exitCodeUsageError = options.ExitCodeUsageError
+	// exitCodeAssertionError は閾値の条件を満たさない統計値、
+	// あるいは閾値を超えて悪化した統計値があったときの終了コードです。
+	exitCodeAssertionError = 3
+)
+
 func main() {
+	if code := run(); code != exitCodeOK {
+		os.Exit(code)
+	}
+}
+
+// run はオプション引数を解析して入力データを処理し、終了コードを返す。
+// 処理に失敗した入力があっても、処理できた入力の結果は出力する。
+// 入力の処理に失敗したときは、閾値の条件の判定結果より優先して終了コードを返す。
+func run() int {
 	// オプション引数の解析
 	opts, args := options.Parse(Version)
+	if opts.Compare {
+		return runCompare(args, opts)
+	}
+	if opts.FollowFlag {
+		return runFollow(args, opts)
+	}
 
-	// 入力データの処理
-	ovs, err := processInput(args, opts)
+	// 入力データ、あるいは集計の状態ファイルの処理
+	code := exitCodeOK
+	var ovs []options.OutValues
+	var err error
+	if opts.Merge {
+		// 出力の列は状態ファイルの集計の指定に従う
+		var spec stateSpec
+		ovs, spec, err = processMerge(args, assertionOptions(opts))
+		o, aerr := spec.apply(opts)
+		if aerr != nil && err == nil {
+			err = aerr
+		}
+		opts = o
+	} else {
+		ovs, err = processInput(args, assertionOptions(opts))
+	}
 	if err != nil {
-		panic(err)
+		logger.Println(err)
+		code = exitCodeInputError
+	}
+
+	// 閾値の条件の判定
+	if vls := options.CheckAssertions(ovs, opts); 0 < len(vls) {
+		for _, v := range vls {
+			logger.Println(v)
+		}
+		if code == exitCodeOK {
+			code = exitCodeAssertionError
+		}
+	}
+
+	// 棒グラフの幅の指定がなければ、標準出力の端末の幅に合わせる
+	if opts.PlotFlag && opts.Width < 1 && opts.OutFile == "" {
+		opts.Width = terminalWidth()
 	}
 
 	// 出力用に整形
-	lines := options.Format(ovs, opts)
+	lines, err := options.Format(ovs, opts)
+	if err != nil {
+		logger.Println(err)
+		return exitCodeInputError
+	}
 
 	// 標準出力、あるいはファイル出力
 	if err := out(lines, opts); err != nil {
-		panic(err)
+		logger.Println(err)
+		return exitCodeInputError
+	}
+	return code
+}
+
+// runCompare は基準と候補の2つの入力を処理して統計値の差分を出力し、終了コードを返す。
+// 閾値の指定があり、閾値を超えて悪化した統計値があれば標準エラー出力に出力する。
+func runCompare(args []string, opts options.Options) int {
+	cmps, err := processCompare(args, opts)
+	if err != nil {
+		logger.Println(err)
+		return exitCodeInputError
+	}
+
+	lines, err := options.FormatCompare(cmps, opts)
+	if err != nil {
+		logger.Println(err)
+		return exitCodeInputError
+	}
+	if err := out(lines, opts); err != nil {
+		logger.Println(err)
+		return exitCodeInputError
+	}
+
+	if rs := options.Regressions(cmps, opts.FailOnRegression); 0 < len(rs) {
+		for _, v := range rs {
+			logger.Printf("regression: %v threshold=%s%%", v, strconv.FormatFloat(opts.FailOnRegression.Percent, 'f', -1, 64))
+		}
+		return exitCodeAssertionError
 	}
+	return exitCodeOK
+}
+
+// processCompare は基準と候補の2つの入力をそれぞれ処理して比較する。
+// どちらかの処理に失敗したときは比較できないのでエラーを返す。
+func processCompare(args []string, opts options.Options) ([]options.Comparison, error) {
+	ovss := make([][]options.OutValues, len(args))
+	for i := range args {
+		o := opts
+		if 0 < len(opts.SeparatableFilePath) {
+			o.SeparatableFilePath = opts.SeparatableFilePath[i : i+1]
+		}
+		ovs, err := processMultiInput(args[i:i+1], o)
+		if err != nil {
+			return nil, err
+		}
+		ovss[i] = ovs
+	}
+	return options.Compare(ovss[0], ovss[1], opts), nil
 }
 
 // processInput は引数、オプションを判定して計算し、出力する文字列を生成する。
@@ -45,30 +159,123 @@ func main() {
 // 引数指定がある場合はファイル名としてファイル読み込みを実施
 func processInput(args []string, opts options.Options) ([]options.OutValues, error) {
 	if 1 <= len(opts.SeparatableFilePath) {
-		return processMultiInput(args, opts), nil
+		return processMultiInput(args, opts)
 	}
 
 	if len(args) < 1 {
 		return processStdin(opts)
 	}
 
-	return processMultiInput(args, opts), nil
+	return processMultiInput(args, opts)
 }
 
 // processStdin は標準入力のデータを処理する。
+// 圧縮されたデータは展開しながら読み込む。
+// 状態ファイルの指定があれば、集計の状態も出力する。
 func processStdin(opts options.Options) ([]options.OutValues, error) {
-	r := os.Stdin
-	conf := arthmath.MinMaxSumAvgConfig{
-		NeedValues:       needValues(opts),
-		Delimiter:        opts.InputDelimiter,
-		FieldIndex:       1,
-		IgnoreHeaderRows: opts.IgnoreHeaderRows,
+	r, err := arthio.NewReader(os.Stdin, "")
+	if err != nil {
+		return nil, err
 	}
-	ov, err := calcOutValues(r, opts, conf)
+	defer r.Close()
+	conf := newConfig(opts, options.SeparatableFilePath{FieldIndex: 1})
+	as, err := accumulateAll(r, opts, conf)
 	if err != nil {
 		return nil, err
 	}
-	return []options.OutValues{ov}, nil
+	if opts.EmitState != "" {
+		if err := writeState(opts.EmitState, as, newStateSpec(as, opts)); err != nil {
+			return nil, err
+		}
+	}
+	return newOutValues(as, opts)
+}
+
+// newConfig はオプションとフィールド指定から集計の設定を生成する。
+// フィールド指定に複数のフィールドがなければ、--fieldsの指定を使う。
+func newConfig(opts options.Options, spath options.SeparatableFilePath) arthmath.MinMaxSumAvgConfig {
+	fs := spath.Fields
+	if len(fs) < 1 {
+		fs = opts.Fields
+	}
+	fields := make([]arthmath.Field, len(fs))
+	for i, f := range fs {
+		fields[i] = arthmath.Field{Index: f.Index, Name: f.Name}
+	}
+
+	// JSONの入力ではフィールドをキーのパスで指定する
+	if opts.JSONField != "" {
+		return arthmath.MinMaxSumAvgConfig{
+			NeedValues:       needValues(opts) && !opts.ApproxFlag,
+			FieldName:        opts.JSONField,
+			IgnoreHeaderRows: opts.IgnoreHeaderRows,
+			GroupFieldName:   jsonPath(opts.GroupBy),
+			Approx:           approx(opts),
+			JSONField:        opts.JSONField,
+			Unit:             unit(opts),
+			TimeFieldName:    jsonPath(opts.TimeField),
+			TimeFormat:       opts.TimeFormat.TimeFormat,
+			Window:           opts.Window,
+		}
+	}
+
+	return arthmath.MinMaxSumAvgConfig{
+		NeedValues:       needValues(opts) && !opts.ApproxFlag,
+		Delimiter:        opts.InputDelimiter,
+		FieldIndex:       spath.FieldIndex,
+		FieldName:        spath.FieldName,
+		Fields:           fields,
+		IgnoreHeaderRows: opts.IgnoreHeaderRows,
+		GroupFieldIndex:  opts.GroupBy.Index,
+		GroupFieldName:   opts.GroupBy.Name,
+		CSV:              opts.CSVFlag,
+		Approx:           approx(opts),
+		Unit:             unit(opts),
+		TimeFieldIndex:   opts.TimeField.Index,
+		TimeFieldName:    opts.TimeField.Name,
+		TimeFormat:       opts.TimeFormat.TimeFormat,
+		Window:           opts.Window,
+	}
+}
+
+// jsonPath はフィールド指定をJSONのキーのパスに変換する。
+// 数値で指定されたときは数値をキー名として扱う。
+func jsonPath(f options.Field) string {
+	if 0 < f.Index {
+		return strconv.Itoa(f.Index)
+	}
+	return f.Name
+}
+
+// unit はオプションで指定された入力の単位を返す。指定がなければnilを返す。
+func unit(opts options.Options) *arthmath.Unit {
+	if !opts.Unit.Specified() {
+		return nil
+	}
+	u := opts.Unit.Unit
+	return &u
+}
+
+// fileError は入力ファイルの処理中に発生したエラーです。
+type fileError struct {
+	fileName string
+	err      error
+}
+
+func (e fileError) Error() string {
+	return fmt.Sprintf("%s: %v", e.fileName, e.err)
+}
+
+// inputError は処理に失敗した入力ファイルのエラーの一覧です。
+// 入力ファイルの指定順に保持する。
+type inputError []fileError
+
+func (e inputError) Error() string {
+	ss := make([]string, len(e))
+	for i, v := range e {
+		ss[i] = v.Error()
+	}
+	return strings.Join(ss, "\n")
 }
 
 // indexedFileName は処理し始めた順番を保持するファイル名。
@@ -79,18 +286,27 @@ type indexedFileName struct {
 
 // processMultiInput は複数の入力ファイルを処理する。
 // CPUの数だけワーカースレッドを起動し、並列でデータを処理する。
-// FIXME goroutineの途中にエラーが発生してもエラーを返さない。
-// ログ出力はするが
-func processMultiInput(fns []string, opts options.Options) []options.OutValues {
+// 入力ファイルがCPUの数より少ないときは、余ったCPUで大きなファイルを分割して並列に集計する。
+// 合計の行、集計の状態の出力は、処理できたファイルのみを併合した集計結果から行う。
+// 処理に失敗したファイルは出力データに含めず、ファイルごとのエラーをinputErrorで返す。
+// 失敗したファイルがあっても、他のファイルの処理は継続する。
+func processMultiInput(fns []string, opts options.Options) ([]options.OutValues, error) {
 	var wg sync.WaitGroup
 	q := make(chan indexedFileName, len(fns))
 
 	// CPUの数だけワーカースレッドを起動
 	// 並列でファイルを開いて処理し、出力データ配列に追加する
-	ovs := make([]options.OutValues, len(fns))
+	// 集計キー指定があるとファイルごとに複数の出力データになる
+	ovss := make([][]options.OutValues, len(fns))
+	ass := make([][]accumulated, len(fns))
+	errs := make([]error, len(fns))
+	workers := 1
+	if 0 < len(fns) && len(fns) < runtime.NumCPU() {
+		workers = runtime.NumCPU() / len(fns)
+	}
 	for i := 0; i < runtime.NumCPU(); i++ {
 		wg.Add(1)
-		go func(ovs []options.OutValues) {
+		go func(ovss [][]options.OutValues) {
 			defer wg.Done()
 			for {
 				// 入力ファイル名を受け取る
@@ -100,32 +316,33 @@ func processMultiInput(fns []string, opts options.Options) []options.OutValues {
 				}
 
 				fn := ifn.fileName
-				ov, err := arthio.WithOpen(fn, func(r io.Reader) (options.OutValues, error) {
-					var n int
-					spath := opts.SeparatableFilePath
-					if len(spath) < 1 {
-						n = 1
-					} else {
-						n = spath[ifn.index].FieldIndex
-					}
-					conf := arthmath.MinMaxSumAvgConfig{
-						NeedValues:       needValues(opts),
-						Delimiter:        opts.InputDelimiter,
-						FieldIndex:       n,
-						IgnoreHeaderRows: opts.IgnoreHeaderRows,
+				spath := options.SeparatableFilePath{FieldIndex: 1}
+				if 0 < len(opts.SeparatableFilePath) {
+					spath = opts.SeparatableFilePath[ifn.index]
+				}
+				conf := newConfig(opts, spath)
+				as, err := accumulateFile(fn, opts, conf, workers)
+				var ovs []options.OutValues
+				if err == nil {
+					// 合計の行、集計の状態の出力のために集計結果を保持する
+					if opts.TotalFlag || opts.EmitState != "" {
+						ass[ifn.index] = as
 					}
-					return calcOutValues(r, opts, conf)
-				})
-				if err != nil {
-					// 処理を計測してほしいのでpanicしない
-					logger.Println(err)
+					ovs, err = newOutValues(as, opts)
 				}
-				ov.FileName = fn // 並列処理の方ではファイル名がわかるのでセット
-
 				i := ifn.index
-				ovs[i] = ov
+				if err != nil {
+					// 他のファイルの処理は継続してほしいので、エラーは保持だけする
+					errs[i] = err
+					continue
+				}
+				// 並列処理の方ではファイル名がわかるのでセット
+				for j := range ovs {
+					ovs[j].FileName = fn
+				}
+				ovss[i] = ovs
 			}
-		}(ovs)
+		}(ovss)
 	}
 
 	// 処理対象のファイルパスをキューに送信
@@ -139,50 +356,294 @@ func processMultiInput(fns []string, opts options.Options) []options.OutValues {
 	close(q)
 	wg.Wait()
 
-	return ovs
+	ovs := make([]options.OutValues, 0, len(fns))
+	var ierr inputError
+	var succeeded [][]accumulated
+	for i, v := range ovss {
+		if errs[i] != nil {
+			ierr = append(ierr, fileError{fileName: fns[i], err: errs[i]})
+			continue
+		}
+		ovs = append(ovs, v...)
+		succeeded = append(succeeded, ass[i])
+	}
+
+	// 併合した集計結果は最初の入力のAccumulatorに追加するので、
+	// 入力ごとの出力データを計算したあとに併合する
+	var merged []accumulated
+	if opts.TotalFlag || opts.EmitState != "" {
+		var err error
+		merged, err = mergeAccumulated(succeeded, opts)
+		if err != nil {
+			// 併合できなければ合計の行も集計の状態も出力しない
+			ierr = append(ierr, fileError{fileName: options.TotalFileName, err: err})
+			succeeded = nil
+		}
+	}
+	if opts.EmitState != "" && 0 < len(succeeded) {
+		if err := writeState(opts.EmitState, merged, newStateSpec(merged, opts)); err != nil {
+			ierr = append(ierr, fileError{fileName: opts.EmitState, err: err})
+		}
+	}
+
+	// 処理できた入力のみを併合した合計の行を追加する
+	if opts.TotalFlag && 0 < len(succeeded) {
+		tovs, err := totalOutValues(merged, opts)
+		if err != nil {
+			ierr = append(ierr, fileError{fileName: options.TotalFileName, err: err})
+		}
+		ovs = append(ovs, tovs...)
+	}
+	if 0 < len(ierr) {
+		return ovs, ierr
+	}
+	return ovs, nil
+}
+
+// assertionOptions は閾値の条件の判定に必要な統計値も算出するオプションを返す。
+// 出力はもとのオプションで整形するため、条件のための統計値は出力しない。
+func assertionOptions(opts options.Options) options.Options {
+	if len(opts.Assertions) < 1 {
+		return opts
+	}
+
+	ps := make(options.Percentiles, len(opts.Percentiles))
+	copy(ps, opts.Percentiles)
+	for _, a := range opts.Assertions {
+		switch a.Stat {
+		case options.HeaderMedian:
+			opts.MedianFlag = true
+		case options.HeaderPercentile:
+			if !ps.Contains(a.Percentile) {
+				ps = append(ps, a.Percentile)
+			}
+		case options.HeaderVariance, options.HeaderSampleVariance:
+			opts.VarianceFlag = true
+		case options.HeaderStdDev, options.HeaderSampleStdDev:
+			opts.StdDevFlag = true
+		}
+	}
+	opts.Percentiles = ps
+	return opts
 }
 
+// needValues は集計にデータの保持、あるいは近似が必要か否かを返す。
 func needValues(opts options.Options) bool {
-	return opts.MedianFlag || 0 < opts.Percentile
+	return statsOptions(opts).NeedValues()
 }
 
-// calcOutValues は入力から出力データを計算する。
-// オプションMedianFlagが存在するとき、ソートとソートデータの保持により
-// メモリ消費と計算時間が増加する。
-// オプションSortedFlagが存在するとき、入力がすでにソート済みとして
-// ソート処理をスキップする。
-func calcOutValues(r io.Reader, opts options.Options, conf arthmath.MinMaxSumAvgConfig) (options.OutValues, error) {
-	ov := options.OutValues{} // 出力データ
-	ns := make([]float64, 0)  // 読み込んだ数値配列
-	var err error
-	ov.Count, ov.Min, ov.Max, ov.Sum, ov.Average,
-		ns, err = arthmath.MinMaxSumAvg(r, conf)
+// approx はデータを保持せずに、スケッチで中央値、パーセンタイル値を近似するか否かを返す。
+// 集計の状態を出力するときは、データを保持する必要がなければスケッチのみを集計するので、
+// データ数によらず一定のメモリで状態ファイルのスケッチを生成できる。
+func approx(opts options.Options) bool {
+	if opts.EmitState != "" && !needValues(opts) {
+		return true
+	}
+	return opts.ApproxFlag && needValues(opts)
+}
+
+// quantileMethod はオプションで指定された中央値、パーセンタイル値の算出方法を返す。
+func quantileMethod(opts options.Options) arthmath.QuantileMethod {
+	return arthmath.QuantileMethod(opts.QuantileMethod)
+}
+
+// statsOptions はオプションで指定された統計値を算出する集計の指定を返す。
+// ヒストグラム、スパークラインは階級を決めるためにデータを保持する。
+func statsOptions(opts options.Options) stats.Options {
+	return stats.Options{
+		Median:      opts.MedianFlag,
+		Percentiles: []float64(opts.Percentiles),
+		Variance:    opts.VarianceFlag || opts.StdDevFlag,
+		Method:      quantileMethod(opts),
+		Approx:      opts.ApproxFlag,
+		KeepValues:  opts.HistogramFlag || opts.SparklineFlag,
+		Sorted:      opts.SortedFlag,
+	}
+}
+
+// accumulated は1つの出力データに対応する集計途中の結果です。
+// --total、mergeで複数の入力を併合するため、出力データに変換する前の集計結果を保持する。
+type accumulated struct {
+	fieldIndex int
+	fieldName  string
+	groupKey   string
+	window     time.Time
+	acc        *stats.Accumulator
+}
+
+// accumulateAll は入力を集計し、出力データごとの集計結果を返す。
+func accumulateAll(r io.Reader, opts options.Options, conf arthmath.MinMaxSumAvgConfig) ([]accumulated, error) {
+	so := statsOptions(opts)
+	if 1 < len(conf.Fields) {
+		return accumulateFields(r, so, conf)
+	}
+	if len(conf.Fields) == 1 {
+		conf.FieldIndex = conf.Fields[0].Index
+		conf.FieldName = conf.Fields[0].Name
+		conf.Fields = nil
+	}
+
+	if 0 < opts.Window {
+		return accumulateWindow(r, so, conf)
+	}
+	if opts.GroupBy.Specified() {
+		return accumulateGroup(r, so, conf)
+	}
+
+	a, err := arthmath.Accumulate(r, conf)
+	if err != nil {
+		return nil, err
+	}
+	return []accumulated{accumulated{fieldIndex: conf.FieldIndex, fieldName: conf.FieldName, acc: stats.Wrap(a, so)}}, nil
+}
+
+// accumulateGroup は入力を集計キーごとに集計する。
+// 集計結果は集計キーの出現順に返す。
+func accumulateGroup(r io.Reader, so stats.Options, conf arthmath.MinMaxSumAvgConfig) ([]accumulated, error) {
+	keys, accs, err := arthmath.GroupMinMaxSumAvg(r, conf)
 	if err != nil {
-		return ov, err
+		return nil, err
 	}
 
-	// SortedFlagとsortedがfalse、ソートを実行
-	// ソート済みならソートをスキップ(高速化)
-	sortFunc := func() {
-		if !opts.SortedFlag {
-			sort.Float64s(ns)
-			opts.SortedFlag = true
+	as := make([]accumulated, len(keys))
+	for i, k := range keys {
+		as[i] = accumulated{
+			fieldIndex: conf.FieldIndex,
+			fieldName:  conf.FieldName,
+			groupKey:   k,
+			acc:        stats.Wrap(accs[k], so),
 		}
 	}
+	return as, nil
+}
 
-	// 中央値
-	if opts.MedianFlag {
-		sortFunc()
-		ov.Median = arthmath.Median(ns)
+// accumulateWindow は入力を時間窓ごとに集計する。
+// 集計結果は時間窓の開始時刻の昇順に返す。
+func accumulateWindow(r io.Reader, so stats.Options, conf arthmath.MinMaxSumAvgConfig) ([]accumulated, error) {
+	ws, accs, err := arthmath.WindowMinMaxSumAvg(r, conf)
+	if err != nil {
+		return nil, err
 	}
 
-	// パーセンタイル値
-	if 0 < opts.Percentile {
-		sortFunc()
-		ov.Percentile = arthmath.Percentile(ns, opts.Percentile)
+	as := make([]accumulated, len(ws))
+	for i, w := range ws {
+		as[i] = accumulated{
+			fieldIndex: conf.FieldIndex,
+			fieldName:  conf.FieldName,
+			window:     w,
+			acc:        stats.Wrap(accs[i], so),
+		}
+	}
+	return as, nil
+}
+
+// accumulateFields は入力の複数のフィールドを1回の読み込みで集計する。
+// 集計結果はフィールドの指定順に、集計キーの指定があれば集計キーの出現順に返す。
+func accumulateFields(r io.Reader, so stats.Options, conf arthmath.MinMaxSumAvgConfig) ([]accumulated, error) {
+	fields, keys, accs, err := arthmath.FieldsMinMaxSumAvg(r, conf)
+	if err != nil {
+		return nil, err
 	}
 
-	return ov, nil
+	as := make([]accumulated, 0, len(fields)*len(keys))
+	for i, f := range fields {
+		for _, k := range keys {
+			as = append(as, accumulated{
+				fieldIndex: f.Index,
+				fieldName:  f.Name,
+				groupKey:   k,
+				acc:        stats.Wrap(accs[k][i], so),
+			})
+		}
+	}
+	return as, nil
+}
+
+// mergeKey は併合する集計結果の組み合わせです。
+type mergeKey struct {
+	fieldIndex int
+	fieldName  string
+	groupKey   string
+	window     int64
+}
+
+// totalOutValues はmergeAccumulatedで入力ごとの集計結果を併合した、合計の行を返す。
+// 中央値、パーセンタイル値は入力ごとの値の平均ではなく、すべての入力のデータから算出する。
+func totalOutValues(merged []accumulated, opts options.Options) ([]options.OutValues, error) {
+	ovs, err := newOutValues(merged, opts)
+	if err != nil {
+		return nil, err
+	}
+	for i := range ovs {
+		ovs[i].FileName = options.TotalFileName
+	}
+	return ovs, nil
+}
+
+// mergeAccumulated は集計結果を、フィールドと集計キー、時間窓ごとに併合する。
+// 併合した集計結果は最初に現れた組み合わせのAccumulatorに追加する。
+// 1つのフィールドのみを集計するときは、フィールドの指定が異なっても併合する。
+// 時間窓の指定があるときは、開始時刻の昇順に返す。
+// 中央値、パーセンタイル値の算出に必要なデータ、スケッチがない集計結果があるときはエラーを返す。
+func mergeAccumulated(ass [][]accumulated, opts options.Options) ([]accumulated, error) {
+	multi := opts.MultiFields()
+	idx := make(map[mergeKey]int)
+	var merged []accumulated
+	for _, as := range ass {
+		for _, v := range as {
+			k := mergeKey{groupKey: v.groupKey, window: v.window.UnixNano()}
+			if multi {
+				k.fieldIndex = v.fieldIndex
+				k.fieldName = v.fieldName
+			}
+			i, ok := idx[k]
+			if !ok {
+				idx[k] = len(merged)
+				merged = append(merged, v)
+				continue
+			}
+			if err := merged[i].acc.Merge(v.acc); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if 0 < opts.Window {
+		sort.SliceStable(merged, func(i, j int) bool {
+			return merged[i].window.Before(merged[j].window)
+		})
+	}
+	return merged, nil
+}
+
+// newOutValues は集計結果から出力データを計算する。
+// 統計値はstatsパッケージで算出するので、ライブラリとして使ったときと同じ結果になる。
+func newOutValues(as []accumulated, opts options.Options) ([]options.OutValues, error) {
+	ovs := make([]options.OutValues, len(as))
+	for i, v := range as {
+		r := v.acc.Result()
+		ov := options.OutValues{
+			FieldIndex:     v.fieldIndex,
+			FieldName:      v.fieldName,
+			GroupKey:       v.groupKey,
+			Window:         v.window,
+			Count:          r.Count,
+			Min:            r.Min,
+			Max:            r.Max,
+			Sum:            r.Sum,
+			Average:        r.Average,
+			Median:         r.Median,
+			Percentiles:    r.Percentiles,
+			Variance:       r.Variance,
+			SampleVariance: r.SampleVariance,
+			StdDev:         r.StdDev,
+			SampleStdDev:   r.SampleStdDev,
+		}
+		if err := setHistogram(&ov, v.acc.Values(), opts); err != nil {
+			return nil, err
+		}
+		ovs[i] = ov
+	}
+	return ovs, nil
 }
 
 // out は行配列をオプションに応じて出力する。
@@ -198,3 +659,39 @@ func out(lines []string, opts options.Options) error {
 
 	return arthio.WriteFile(opts.OutFile, lines)
 }
+
+// setHistogram はオプションで指定された階級でヒストグラムを出力データにセットする。
+// スパークラインも同じ階級のヒストグラムから描く。
+// 境界値の指定があるときは、範囲外の値も数えるように両端に無限大までの階級を追加する。
+func setHistogram(ov *options.OutValues, ns []float64, opts options.Options) error {
+	if !opts.HistogramFlag && !opts.SparklineFlag {
+		return nil
+	}
+
+	n := opts.Bins.Count
+	if n < 1 {
+		n = options.DefaultBinCount
+	}
+	var edges []float64
+	switch {
+	case opts.Bins.Edges != nil:
+		edges = append(edges, math.Inf(-1))
+		edges = append(edges, opts.Bins.Edges...)
+		edges = append(edges, math.Inf(1))
+	case opts.BinScale == options.BinScaleLog:
+		es, err := arthmath.LogEdges(ns, n)
+		if err != nil {
+			return err
+		}
+		edges = es
+	default:
+		edges = arthmath.LinearEdges(ns, n)
+	}
+
+	bs := arthmath.Histogram(ns, edges)
+	ov.Histogram = make([]options.Bucket, len(bs))
+	for i, b := range bs {
+		ov.Histogram[i] = options.Bucket{Lower: b.Lower, Upper: b.Upper, Count: b.Count}
+	}
+	return nil
+}
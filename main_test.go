@@ -3,12 +3,20 @@ package main
 import (
 	"bytes"
 	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/jiro4989/arth/internal/options"
 	arthmath "github.com/jiro4989/arth/math"
+	"github.com/jiro4989/arth/stats"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -53,6 +61,29 @@ func TestMain(t *testing.T) {
 				"testdata/bigdata.txt",
 			},
 		},
+		TestMainData{
+			args: []string{
+				"main.go",
+				"-p", "50,90,99.9",
+				"testdata/bigdata.txt",
+			},
+		},
+		TestMainData{
+			args: []string{
+				"main.go",
+				"-d", ",",
+				"-g", "endpoint",
+				"-f", "2:testdata/endpoint.csv",
+			},
+		},
+		TestMainData{
+			args: []string{
+				"main.go",
+				"-d", ",",
+				"-H",
+				"-f", "2-3:testdata/multi_field.csv",
+			},
+		},
 		TestMainData{
 			args: []string{
 				"main.go",
@@ -86,247 +117,1688 @@ func TestProcessInput(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, []options.OutValues{
 		options.OutValues{
-			FileName: "testdata/bigdata.txt",
-			Count:    100,
-			Min:      1,
-			Max:      100,
-			Sum:      5050,
-			Average:  50.5,
-			Median:   50,
+			FileName:   "testdata/bigdata.txt",
+			FieldIndex: 1,
+			Count:      100,
+			Min:        1,
+			Max:        100,
+			Sum:        5050,
+			Average:    50.5,
+			Median:     50,
 		},
 	}, o)
 
 	os.Stdin, err = os.Open("testdata/normal_num.txt")
 	assert.NoError(t, err)
 
-	args = []string{}
-	o, err = processInput(args, opts)
-	assert.NoError(t, err)
-	assert.Equal(t, []options.OutValues{
-		options.OutValues{
-			Count:   5,
-			Min:     1,
-			Max:     5,
-			Sum:     15,
-			Average: 3,
-			Median:  3,
-		},
-	}, o)
+	args = []string{}
+	o, err = processInput(args, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []options.OutValues{
+		options.OutValues{
+			FieldIndex: 1,
+			Count:      5,
+			Min:        1,
+			Max:        5,
+			Sum:        15,
+			Average:    3,
+			Median:     3,
+		},
+	}, o)
+}
+
+func TestProcessStdin(t *testing.T) {
+	opts := options.Options{
+		CountFlag:      true,
+		MinFlag:        true,
+		MaxFlag:        true,
+		SumFlag:        true,
+		AverageFlag:    true,
+		MedianFlag:     true,
+		SortedFlag:     false,
+		HeaderFlag:     false,
+		InputDelimiter: "\t",
+		OutFile:        "",
+	}
+
+	var err error
+	os.Stdin, err = os.Open("testdata/normal_num.txt")
+	assert.NoError(t, err)
+
+	o, err := processStdin(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []options.OutValues{
+		options.OutValues{
+			FieldIndex: 1,
+			Count:      5,
+			Min:        1,
+			Max:        5,
+			Sum:        15,
+			Average:    3,
+			Median:     3,
+		},
+	}, o)
+}
+
+func TestProcessStdinCompressed(t *testing.T) {
+	opts := options.Options{CountFlag: true, SumFlag: true, InputDelimiter: "\t"}
+
+	var err error
+	os.Stdin, err = os.Open("testdata/compressed/bigdata.txt.gz")
+	assert.NoError(t, err)
+
+	o, err := processStdin(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, o[0].Count)
+	assert.Equal(t, 5050.0, o[0].Sum)
+}
+
+func TestProcessMultiInputCompressed(t *testing.T) {
+	opts := options.Options{CountFlag: true, SumFlag: true, InputDelimiter: "\t"}
+	fns := []string{
+		"testdata/compressed/bigdata.txt.gz",
+		"testdata/compressed/bigdata.txt.bz2",
+		"testdata/compressed/bigdata.txt.xz",
+		"testdata/compressed/bigdata.txt.zst",
+	}
+	o, err := processMultiInput(fns, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, len(fns), len(o))
+	for i, v := range o {
+		assert.Equal(t, fns[i], v.FileName)
+		assert.Equal(t, 100, v.Count, v.FileName)
+		assert.Equal(t, 5050.0, v.Sum, v.FileName)
+	}
+
+	// 壊れた圧縮ファイルは処理に失敗する
+	o, err = processMultiInput([]string{"testdata/compressed/plain.txt.gz", "testdata/normal_num.txt"}, opts)
+	assert.Error(t, err)
+	assert.Equal(t, 1, len(o))
+}
+
+func TestProcessMultiInputJSON(t *testing.T) {
+	opts := options.Options{
+		CountFlag: true,
+		SumFlag:   true,
+		JSONField: "timing.total",
+		GroupBy:   options.Field{Name: "path"},
+	}
+	o, err := processMultiInput([]string{"testdata/requests.ndjson"}, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []options.OutValues{
+		options.OutValues{
+			FileName:  "testdata/requests.ndjson",
+			FieldName: "timing.total",
+			GroupKey:  "/a",
+			Count:     3,
+			Min:       5,
+			Max:       20,
+			Sum:       35,
+			Average:   35.0 / 3,
+		},
+		options.OutValues{
+			FileName:  "testdata/requests.ndjson",
+			FieldName: "timing.total",
+			GroupKey:  "/b",
+			Count:     2,
+			Min:       15,
+			Max:       45,
+			Sum:       60,
+			Average:   30,
+		},
+	}, o)
+
+	// 数値の集計キーのフィールド番号はキー名として扱う
+	conf := newConfig(options.Options{JSONField: "a", GroupBy: options.Field{Index: 1}}, options.SeparatableFilePath{FieldIndex: 1})
+	assert.Equal(t, "1", conf.GroupFieldName)
+	assert.Equal(t, 0, conf.GroupFieldIndex)
+}
+
+func TestProcessMultiInputUnit(t *testing.T) {
+	var u options.Unit
+	assert.NoError(t, u.UnmarshalFlag("ms"))
+	opts := options.Options{
+		MinFlag:         true,
+		MaxFlag:         true,
+		MedianFlag:      true,
+		Unit:            u,
+		HumanFlag:       true,
+		InputDelimiter:  "\t",
+		OutputDelimiter: "\t",
+	}
+	o, err := processMultiInput([]string{"testdata/duration.txt"}, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, o[0].Count)
+	assert.Equal(t, 0.34, o[0].Min)
+	assert.Equal(t, 90000.0, o[0].Max)
+	lines, err := options.Format(o, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"testdata/duration.txt\t340µs\t1.5m\t250ms"}, lines)
+
+	// 単位の指定がなければnil
+	assert.Nil(t, newConfig(options.Options{}, options.SeparatableFilePath{FieldIndex: 1}).Unit)
+}
+
+func TestProcessMultiInputTotal(t *testing.T) {
+	opts := options.Options{
+		CountFlag:      true,
+		MedianFlag:     true,
+		Percentiles:    options.Percentiles{95},
+		VarianceFlag:   true,
+		TotalFlag:      true,
+		InputDelimiter: "\t",
+	}
+	o, err := processMultiInput([]string{"testdata/normal_num.txt", "testdata/bigdata.txt"}, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(o))
+
+	// すべての入力を連結して集計した結果と同じになる
+	all := opts
+	all.TotalFlag = false
+	f, err := os.Open("testdata/normal_num.txt")
+	assert.NoError(t, err)
+	defer f.Close()
+	b, err := os.Open("testdata/bigdata.txt")
+	assert.NoError(t, err)
+	defer b.Close()
+	as, err := accumulateAll(io.MultiReader(f, b), all, newConfig(all, options.SeparatableFilePath{FieldIndex: 1}))
+	assert.NoError(t, err)
+	ovs, err := newOutValues(as, all)
+	assert.NoError(t, err)
+	want := ovs[0]
+	want.FileName = options.TotalFileName
+	got := o[2]
+	// 分散は併合の計算順の違いで誤差が出る
+	assert.InDelta(t, want.Variance, got.Variance, 1e-9)
+	assert.InDelta(t, want.SampleVariance, got.SampleVariance, 1e-9)
+	assert.InDelta(t, want.StdDev, got.StdDev, 1e-9)
+	assert.InDelta(t, want.SampleStdDev, got.SampleStdDev, 1e-9)
+	got.Variance, got.SampleVariance = want.Variance, want.SampleVariance
+	got.StdDev, got.SampleStdDev = want.StdDev, want.SampleStdDev
+	assert.Equal(t, want, got)
+	assert.Equal(t, 105, got.Count)
+	assert.Equal(t, 48.0, got.Median)
+	assert.Equal(t, 94.0, got.Percentiles[95])
+
+	// 入力ごとの行は変わらない
+	assert.Equal(t, 3.0, o[0].Median)
+	assert.Equal(t, 50.0, o[1].Median)
+
+	// ソート済みの入力同士を連結したデータはソート済みではない
+	sopts := options.Options{
+		MedianFlag:     true,
+		Percentiles:    options.Percentiles{50},
+		SortedFlag:     true,
+		TotalFlag:      true,
+		InputDelimiter: "\t",
+	}
+	o, err = processMultiInput([]string{"testdata/normal_num.txt", "testdata/normal_num.txt"}, sopts)
+	assert.NoError(t, err)
+	assert.Equal(t, options.TotalFileName, o[2].FileName)
+	assert.Equal(t, 3.0, o[2].Median)
+	assert.Equal(t, 3.0, o[2].Percentiles[50])
+
+	// 集計キーごとに併合し、処理に失敗した入力は含めない
+	opts = options.Options{
+		CountFlag:      true,
+		MedianFlag:     true,
+		TotalFlag:      true,
+		InputDelimiter: ",",
+		GroupBy:        options.Field{Name: "endpoint"},
+		SeparatableFilePath: []options.SeparatableFilePath{
+			options.SeparatableFilePath{FieldName: "latency", FilePath: "testdata/endpoint.csv"},
+			options.SeparatableFilePath{FieldName: "latency", FilePath: "testdata/not_found.txt"},
+			options.SeparatableFilePath{FieldName: "latency", FilePath: "testdata/multi_field.csv"},
+		},
+	}
+	o, err = processMultiInput([]string{"testdata/endpoint.csv", "testdata/not_found.txt", "testdata/multi_field.csv"}, opts)
+	assert.Error(t, err)
+	assert.Equal(t, 9, len(o))
+	var keys []string
+	var counts []int
+	for _, v := range o[6:] {
+		assert.Equal(t, options.TotalFileName, v.FileName)
+		keys = append(keys, v.GroupKey)
+		counts = append(counts, v.Count)
+	}
+	assert.Equal(t, []string{"/a", "/b", "/c"}, keys)
+	assert.Equal(t, []int{5, 3, 2}, counts)
+	assert.Equal(t, 20.0, o[6].Median)
+}
+
+func TestProcessMultiInputWindow(t *testing.T) {
+	opts := options.Options{
+		CountFlag:      true,
+		Percentiles:    options.Percentiles{95},
+		TotalFlag:      true,
+		InputDelimiter: ",",
+		CSVFlag:        true,
+		TimeField:      options.Field{Name: "time"},
+		Window:         20 * time.Second,
+		SeparatableFilePath: []options.SeparatableFilePath{
+			options.SeparatableFilePath{FieldName: "latency_ms", FilePath: "testdata/loadtest.csv"},
+			options.SeparatableFilePath{FieldName: "latency_ms", FilePath: "testdata/loadtest.csv"},
+		},
+	}
+	o, err := processMultiInput([]string{"testdata/loadtest.csv", "testdata/loadtest.csv"}, opts)
+	assert.NoError(t, err)
+	// 入力ごとに時間窓の行、そのあとに時間窓ごとの合計の行
+	assert.Equal(t, 6, len(o))
+	w := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	for i, v := range o {
+		assert.True(t, w.Add(time.Duration(i%2)*20*time.Second).Equal(v.Window), v.Window.String())
+	}
+	assert.Equal(t, 20, o[0].Count)
+	assert.Equal(t, 40, o[4].Count)
+	assert.Equal(t, options.TotalFileName, o[5].FileName)
+	assert.Equal(t, o[1].Percentiles[95], o[5].Percentiles[95])
+
+	// JSONの入力では時刻のフィールドをキーのパスとして扱う
+	var tf options.TimeFormat
+	assert.NoError(t, tf.UnmarshalFlag("unixms"))
+	opts = options.Options{JSONField: "latency", TimeField: options.Field{Index: 3}, TimeFormat: tf, Window: time.Second}
+	conf := newConfig(opts, options.SeparatableFilePath{FieldIndex: 1})
+	assert.Equal(t, "3", conf.TimeFieldName)
+	assert.Equal(t, 0, conf.TimeFieldIndex)
+	assert.Equal(t, time.Second, conf.Window)
+}
+
+func TestProcessMerge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "arth")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	opts := options.Options{
+		CountFlag:      true,
+		MinFlag:        true,
+		MaxFlag:        true,
+		SumFlag:        true,
+		AverageFlag:    true,
+		MedianFlag:     true,
+		Percentiles:    options.Percentiles{95},
+		VarianceFlag:   true,
+		InputDelimiter: "\t",
+	}
+	// 入力ごとに集計の状態を出力する
+	fns := []string{"testdata/normal_num.txt", "testdata/bigdata.txt"}
+	var states []string
+	for i, fn := range fns {
+		o := opts
+		o.EmitState = filepath.Join(dir, strconv.Itoa(i)+".bin")
+		_, err := processMultiInput([]string{fn}, o)
+		assert.NoError(t, err)
+		states = append(states, o.EmitState)
+	}
+	o, spec, err := processMerge(states, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, stateSpec{}, spec)
+	assert.Equal(t, 1, len(o))
+
+	// すべての入力を連結して集計した結果と同じになる
+	f, err := os.Open(fns[0])
+	assert.NoError(t, err)
+	defer f.Close()
+	b, err := os.Open(fns[1])
+	assert.NoError(t, err)
+	defer b.Close()
+	as, err := accumulateAll(io.MultiReader(f, b), opts, newConfig(opts, options.SeparatableFilePath{FieldIndex: 1}))
+	assert.NoError(t, err)
+	ovs, err := newOutValues(as, opts)
+	assert.NoError(t, err)
+	want := ovs[0]
+	got := o[0]
+	assert.Equal(t, "", got.FileName)
+	assert.Equal(t, want.Count, got.Count)
+	assert.Equal(t, want.Min, got.Min)
+	assert.Equal(t, want.Max, got.Max)
+	assert.Equal(t, want.Sum, got.Sum)
+	assert.Equal(t, want.Average, got.Average)
+	assert.InDelta(t, want.Variance, got.Variance, 1e-9)
+	assert.InDelta(t, want.SampleStdDev, got.SampleStdDev, 1e-9)
+	// 中央値、パーセンタイル値はスケッチから近似する
+	assert.InDelta(t, want.Median, got.Median, 2)
+	assert.InDelta(t, want.Percentiles[95], got.Percentiles[95], 2)
+
+	// 併合した状態をさらに併合できる
+	all := opts
+	all.EmitState = filepath.Join(dir, "all.bin")
+	_, _, err = processMerge(states, all)
+	assert.NoError(t, err)
+	o2, _, err := processMerge([]string{all.EmitState}, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, o, o2)
+
+	// 集計キーごとに併合し、読み込めないファイル、集計の指定が異なるファイルは併合しない
+	gopts := options.Options{
+		CountFlag:      true,
+		MedianFlag:     true,
+		InputDelimiter: ",",
+		GroupBy:        options.Field{Name: "endpoint"},
+		EmitState:      filepath.Join(dir, "group.bin"),
+		SeparatableFilePath: []options.SeparatableFilePath{
+			options.SeparatableFilePath{FieldName: "latency", FilePath: "testdata/endpoint.csv"},
+			options.SeparatableFilePath{FieldName: "latency", FilePath: "testdata/multi_field.csv"},
+		},
+	}
+	_, err = processMultiInput([]string{"testdata/endpoint.csv", "testdata/multi_field.csv"}, gopts)
+	assert.NoError(t, err)
+	o, spec, err = processMerge([]string{gopts.EmitState, "testdata/endpoint.csv", states[0], gopts.EmitState}, opts)
+	assert.Error(t, err)
+	assert.Equal(t, 2, len(err.(inputError)))
+	assert.Equal(t, "testdata/endpoint.csv", err.(inputError)[0].fileName)
+	assert.Equal(t, states[0], err.(inputError)[1].fileName)
+	assert.Equal(t, gopts.GroupBy, spec.groupBy())
+	var keys []string
+	var counts []int
+	for _, v := range o {
+		keys = append(keys, v.GroupKey)
+		counts = append(counts, v.Count)
+	}
+	assert.Equal(t, []string{"/a", "/b", "/c"}, keys)
+	assert.Equal(t, []int{10, 6, 4}, counts)
+
+	// 出力の列は状態ファイルの集計の指定に従う
+	mopts, err := spec.apply(opts)
+	assert.NoError(t, err)
+	assert.True(t, mopts.GroupBy.Specified())
+
+	// 複数フィールドの指定も状態ファイルから復元する
+	fopts := options.Options{
+		CountFlag:      true,
+		InputDelimiter: ",",
+		EmitState:      filepath.Join(dir, "fields.bin"),
+		SeparatableFilePath: []options.SeparatableFilePath{
+			options.SeparatableFilePath{
+				Fields:   options.Fields{options.Field{Index: 2}, options.Field{Name: "bytes"}},
+				FilePath: "testdata/multi_field.csv",
+			},
+		},
+	}
+	_, err = processMultiInput([]string{"testdata/multi_field.csv"}, fopts)
+	assert.NoError(t, err)
+	o, spec, err = processMerge([]string{fopts.EmitState}, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, options.Fields{options.Field{Index: 2}, options.Field{Index: 3, Name: "bytes"}}, spec.fields())
+	assert.Equal(t, []int{4, 3}, []int{o[0].Count, o[1].Count})
+
+	// フィールド番号とヘッダ名の数が異なる状態ファイル
+	bad := filepath.Join(dir, "bad.bin")
+	assert.NoError(t, writeState(bad, nil, stateSpec{FieldIndexes: []int{1, 2}, FieldNames: []string{""}}))
+	_, _, err = processMerge([]string{bad}, opts)
+	assert.Error(t, err)
+}
+
+type TestAccumulateFileData struct {
+	desc string
+	in   string
+	opts options.Options
+}
+
+func TestAccumulateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "arth")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	write := func(name, header string, line func(i int) string) string {
+		var b strings.Builder
+		b.WriteString(header)
+		for i := 0; i < 300; i++ {
+			b.WriteString(line(i))
+		}
+		fn := filepath.Join(dir, name)
+		assert.NoError(t, ioutil.WriteFile(fn, []byte(b.String()), 0644))
+		return fn
+	}
+	nums := write("nums.txt", "", func(i int) string { return strconv.Itoa(i*37%101) + "\n" })
+	sorted := write("sorted.txt", "", func(i int) string { return strconv.Itoa(i) + "\n" })
+	ignored := write("ignored.txt", "x\ny\nz\n", func(i int) string { return strconv.Itoa(i*7%13) + "\n" })
+	keys := []string{"/a", "/b", "/c", "/d", "/e"}
+	endpoint := write("endpoint.txt", "endpoint,latency,bytes\n", func(i int) string {
+		// 後半になってから現れる集計キーも含める
+		k := keys[i%3]
+		if 200 < i {
+			k = keys[i%5]
+		}
+		return k + "," + strconv.Itoa(i%17) + "," + strconv.Itoa(i*3) + "\n"
+	})
+	loadtest := write("loadtest.txt", "time,latency\n", func(i int) string {
+		return time.Date(2024, 5, 1, 10, 0, i, 0, time.UTC).Format(time.RFC3339) + "," + strconv.Itoa(i%23) + "\n"
+	})
+	ndjson := write("requests.ndjson", "", func(i int) string {
+		return `{"path":"` + keys[i%2] + `","latency_ms":` + strconv.Itoa(i%11) + "}\n"
+	})
+
+	base := options.Options{
+		CountFlag:      true,
+		MinFlag:        true,
+		MaxFlag:        true,
+		SumFlag:        true,
+		AverageFlag:    true,
+		MedianFlag:     true,
+		Percentiles:    options.Percentiles{90, 99},
+		VarianceFlag:   true,
+		InputDelimiter: "\t",
+	}
+	with := func(f func(o *options.Options)) options.Options {
+		o := base
+		f(&o)
+		return o
+	}
+	tds := []TestAccumulateFileData{
+		TestAccumulateFileData{desc: "1フィールド", in: nums, opts: base},
+		TestAccumulateFileData{desc: "ソート済み", in: sorted, opts: with(func(o *options.Options) { o.SortedFlag = true })},
+		TestAccumulateFileData{desc: "ヘッダを無視", in: ignored, opts: with(func(o *options.Options) { o.IgnoreHeaderRows = 3 })},
+		TestAccumulateFileData{desc: "ヒストグラム", in: nums, opts: with(func(o *options.Options) { o.HistogramFlag = true })},
+		TestAccumulateFileData{desc: "ヘッダ名と集計キー", in: endpoint, opts: with(func(o *options.Options) {
+			o.InputDelimiter = ","
+			o.GroupBy = options.Field{Name: "endpoint"}
+			o.SeparatableFilePath = []options.SeparatableFilePath{options.SeparatableFilePath{FieldName: "latency", FilePath: endpoint}}
+		})},
+		TestAccumulateFileData{desc: "複数フィールドと集計キー", in: endpoint, opts: with(func(o *options.Options) {
+			o.InputDelimiter = ","
+			o.IgnoreHeaderRows = 1
+			o.GroupBy = options.Field{Index: 1}
+			o.Fields = options.Fields{options.Field{Index: 2}, options.Field{Index: 3}}
+		})},
+		TestAccumulateFileData{desc: "時間窓", in: loadtest, opts: with(func(o *options.Options) {
+			o.InputDelimiter = ","
+			o.TimeField = options.Field{Name: "time"}
+			o.Window = 30 * time.Second
+			o.SeparatableFilePath = []options.SeparatableFilePath{options.SeparatableFilePath{FieldName: "latency", FilePath: loadtest}}
+		})},
+		TestAccumulateFileData{desc: "JSON", in: ndjson, opts: with(func(o *options.Options) {
+			o.JSONField = "latency_ms"
+			o.GroupBy = options.Field{Name: "path"}
+		})},
+	}
+
+	defer func(n int64) { chunkSize = n }(chunkSize)
+	chunkSize = 64
+	for _, v := range tds {
+		spath := options.SeparatableFilePath{FieldIndex: 1}
+		if 0 < len(v.opts.SeparatableFilePath) {
+			spath = v.opts.SeparatableFilePath[0]
+		}
+		conf := newConfig(v.opts, spath)
+
+		// 分割して並列に集計しても、順に集計した場合と同じ結果になる
+		as, err := accumulateFile(v.in, v.opts, conf, 1)
+		assert.NoError(t, err, v.desc)
+		want, err := newOutValues(as, v.opts)
+		assert.NoError(t, err, v.desc)
+		as, err = accumulateFile(v.in, v.opts, conf, 4)
+		assert.NoError(t, err, v.desc)
+		got, err := newOutValues(as, v.opts)
+		assert.NoError(t, err, v.desc)
+
+		assert.Equal(t, len(want), len(got), v.desc)
+		for i := range got {
+			// 分散は併合の計算順の違いで誤差が出る
+			assert.InDelta(t, want[i].Variance, got[i].Variance, 1e-9, v.desc)
+			assert.InDelta(t, want[i].SampleVariance, got[i].SampleVariance, 1e-9, v.desc)
+			assert.InDelta(t, want[i].StdDev, got[i].StdDev, 1e-9, v.desc)
+			got[i].Variance, got[i].SampleVariance = want[i].Variance, want[i].SampleVariance
+			got[i].StdDev, got[i].SampleStdDev = want[i].StdDev, want[i].SampleStdDev
+			// 平均値は併合の計算順の違いで誤差が出うる
+			assert.InDelta(t, want[i].Average, got[i].Average, 1e-9, v.desc)
+			got[i].Average = want[i].Average
+		}
+		assert.Equal(t, want, got, v.desc)
+	}
+
+	// ヘッダ名が見つからないときは、分割してもエラーにする
+	opts := with(func(o *options.Options) { o.InputDelimiter = "," })
+	_, err = accumulateFile(endpoint, opts, newConfig(opts, options.SeparatableFilePath{FieldName: "nope"}), 4)
+	assert.Error(t, err)
+}
+
+func TestFollow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "arth")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "app.csv")
+	write := func(s string) {
+		f, err := os.OpenFile(fn, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		assert.NoError(t, err)
+		defer f.Close()
+		_, err = f.WriteString(s)
+		assert.NoError(t, err)
+	}
+
+	for _, mode := range []string{options.FollowModeCumulative, options.FollowModeInterval} {
+		assert.NoError(t, ioutil.WriteFile(fn, []byte("time,latency\nt,10\nt,20\n"), 0644))
+		opts := options.Options{
+			CountFlag:       true,
+			MaxFlag:         true,
+			MedianFlag:      true,
+			SortedFlag:      true,
+			NoFileNameFlag:  true,
+			InputDelimiter:  ",",
+			OutputDelimiter: "\t",
+			FollowMode:      mode,
+			SeparatableFilePath: []options.SeparatableFilePath{
+				options.SeparatableFilePath{FieldName: "latency", FilePath: fn},
+			},
+		}
+		tick := make(chan time.Time)
+		stop := make(chan struct{})
+		outs := make(chan []string)
+		code := make(chan int)
+		go func() {
+			code <- follow([]string{fn}, opts, tick, stop, func(lines []string, _ options.Options) error {
+				outs <- lines
+				return nil
+			})
+		}()
+
+		// 開始時に既存の行を集計して出力する
+		assert.Equal(t, []string{"2\t20\t10"}, <-outs, mode)
+
+		// 追記された行。ヘッダは付け直して解決する
+		write("t,5\nt,")
+		tick <- time.Now()
+		if mode == options.FollowModeCumulative {
+			assert.Equal(t, []string{"3\t20\t10"}, <-outs, mode)
+		} else {
+			assert.Equal(t, []string{"1\t5\t5"}, <-outs, mode)
+		}
+
+		// ローテーション。新しいファイルのヘッダを読み直す
+		write("1\n")
+		assert.NoError(t, os.Rename(fn, fn+".1"))
+		write("time,latency\nt,30\n")
+		tick <- time.Now()
+		if mode == options.FollowModeCumulative {
+			assert.Equal(t, []string{"4\t20\t5"}, <-outs, mode)
+		} else {
+			assert.Equal(t, []string{"1\t1\t1"}, <-outs, mode)
+		}
+
+		// 中断されたら、それまでに追記された行を出力して終了する
+		close(stop)
+		if mode == options.FollowModeCumulative {
+			assert.Equal(t, []string{"5\t30\t10"}, <-outs, mode)
+		} else {
+			assert.Equal(t, []string{"1\t30\t30"}, <-outs, mode)
+		}
+		assert.Equal(t, exitCodeOK, <-code, mode)
+		assert.NoError(t, os.Remove(fn+".1"))
+	}
+
+	// 存在しないヘッダ名のファイルは追跡をやめる
+	assert.NoError(t, ioutil.WriteFile(fn, []byte("time,latency\nt,10\n"), 0644))
+	opts := options.Options{
+		CountFlag:      true,
+		InputDelimiter: ",",
+		SeparatableFilePath: []options.SeparatableFilePath{
+			options.SeparatableFilePath{FieldName: "elapsed", FilePath: fn},
+		},
+	}
+	stop := make(chan struct{})
+	close(stop)
+	var lines [][]string
+	c := follow([]string{fn}, opts, nil, stop, func(l []string, _ options.Options) error {
+		lines = append(lines, l)
+		return nil
+	})
+	assert.Equal(t, exitCodeInputError, c)
+	assert.Equal(t, [][]string{[]string{}, []string{}}, lines)
+}
+
+func TestFollowCSV(t *testing.T) {
+	dir, err := ioutil.TempDir("", "arth")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "app.csv")
+	write := func(s string) {
+		f, err := os.OpenFile(fn, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		assert.NoError(t, err)
+		defer f.Close()
+		_, err = f.WriteString(s)
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, ioutil.WriteFile(fn, []byte("request,ms\n\"GET /a,b\",10\n"), 0644))
+	opts := options.Options{
+		CountFlag:       true,
+		SumFlag:         true,
+		NoFileNameFlag:  true,
+		CSVFlag:         true,
+		InputDelimiter:  ",",
+		OutputDelimiter: "\t",
+		FollowMode:      options.FollowModeCumulative,
+		SeparatableFilePath: []options.SeparatableFilePath{
+			options.SeparatableFilePath{FieldName: "ms", FilePath: fn},
+		},
+	}
+	tick := make(chan time.Time)
+	stop := make(chan struct{})
+	outs := make(chan []string)
+	code := make(chan int)
+	go func() {
+		code <- follow([]string{fn}, opts, tick, stop, func(lines []string, _ options.Options) error {
+			outs <- lines
+			return nil
+		})
+	}()
+	assert.Equal(t, []string{"1\t10"}, <-outs)
+
+	// 改行を含むレコードの途中までは集計しない
+	write("\"GET /multi\n")
+	tick <- time.Now()
+	assert.Equal(t, []string{"1\t10"}, <-outs)
+
+	// 残りが追記されたら1つのレコードとして集計する
+	write("line\",30\n\"GET \"\"q\"\"\",5\n")
+	tick <- time.Now()
+	assert.Equal(t, []string{"3\t45"}, <-outs)
+
+	close(stop)
+	assert.Equal(t, []string{"3\t45"}, <-outs)
+	assert.Equal(t, exitCodeOK, <-code)
+}
+
+func TestFollowCompressed(t *testing.T) {
+	// 圧縮されたファイルは追跡しない
+	opts := options.Options{CountFlag: true}
+	stop := make(chan struct{})
+	close(stop)
+	var lines [][]string
+	c := follow([]string{"testdata/compressed/bigdata.txt.gz"}, opts, nil, stop, func(l []string, _ options.Options) error {
+		lines = append(lines, l)
+		return nil
+	})
+	assert.Equal(t, exitCodeInputError, c)
+	assert.Equal(t, [][]string{[]string{}, []string{}}, lines)
+}
+
+type TestCSVRecordsEndData struct {
+	desc  string
+	in    string
+	comma string
+	out   int
+}
+
+func TestCSVRecordsEnd(t *testing.T) {
+	tds := []TestCSVRecordsEndData{
+		TestCSVRecordsEndData{desc: "完結したレコード", in: "a,1\nb,2\n", comma: ",", out: 8},
+		TestCSVRecordsEndData{desc: "空", in: "", comma: ",", out: 0},
+		TestCSVRecordsEndData{desc: "クォート中の改行", in: "a,1\n\"b\nc\",2\n", comma: ",", out: 12},
+		TestCSVRecordsEndData{desc: "クォート中の改行の途中", in: "a,1\n\"b\n", comma: ",", out: 4},
+		TestCSVRecordsEndData{desc: "2つ目のフィールドのクォート", in: "a,\"b\n", comma: ",", out: 0},
+		TestCSVRecordsEndData{desc: "エスケープされたクォート", in: "\"a\"\"\n\"\"\",1\n", comma: ",", out: 11},
+		TestCSVRecordsEndData{desc: "フィールドの途中のクォートはクォートとみなさない", in: "a\"b,1\nc,2\n", comma: ",", out: 10},
+		TestCSVRecordsEndData{desc: "タブ区切り", in: "a\t\"b\n", comma: "\t", out: 0},
+		TestCSVRecordsEndData{desc: "他の区切り文字の後ろのクォート", in: "a,\"b\n", comma: "\t", out: 5},
+	}
+	for _, v := range tds {
+		assert.Equal(t, v.out, csvRecordsEnd([]byte(v.in), v.comma), v.desc)
+	}
+}
+
+func TestStatsAgreement(t *testing.T) {
+	// コマンドとstatsパッケージの集計結果は一致する
+	opts := options.Options{
+		CountFlag:      true,
+		MedianFlag:     true,
+		Percentiles:    options.Percentiles{90, 99.9},
+		StdDevFlag:     true,
+		QuantileMethod: string(arthmath.QuantileLinear),
+		InputDelimiter: "\t",
+	}
+	o, err := processMultiInput([]string{"testdata/bigdata.txt"}, opts)
+	assert.NoError(t, err)
+
+	b, err := ioutil.ReadFile("testdata/bigdata.txt")
+	assert.NoError(t, err)
+	a := stats.New(statsOptions(opts))
+	for _, l := range strings.Fields(string(b)) {
+		n, err := strconv.ParseFloat(l, 64)
+		assert.NoError(t, err)
+		a.Add(n)
+	}
+	r := a.Result()
+	assert.Equal(t, options.OutValues{
+		FileName:       "testdata/bigdata.txt",
+		FieldIndex:     1,
+		Count:          r.Count,
+		Min:            r.Min,
+		Max:            r.Max,
+		Sum:            r.Sum,
+		Average:        r.Average,
+		Median:         r.Median,
+		Percentiles:    r.Percentiles,
+		Variance:       r.Variance,
+		SampleVariance: r.SampleVariance,
+		StdDev:         r.StdDev,
+		SampleStdDev:   r.SampleStdDev,
+	}, o[0])
+	assert.Equal(t, 50.5, r.Median)
+}
+
+type TestProcessMultiInputData struct {
+	args []string
+	opts options.Options
+	out  []options.OutValues
+}
+
+func TestProcessMultiInput(t *testing.T) {
+	tds := []TestProcessMultiInputData{
+		TestProcessMultiInputData{
+			args: []string{
+				"testdata/bigdata.txt",
+				"testdata/normal_num.txt",
+			},
+			opts: options.Options{
+				CountFlag:      true,
+				MinFlag:        true,
+				MaxFlag:        true,
+				SumFlag:        true,
+				AverageFlag:    true,
+				MedianFlag:     true,
+				SortedFlag:     false,
+				HeaderFlag:     false,
+				InputDelimiter: "\t",
+				OutFile:        "",
+			},
+			out: []options.OutValues{
+				options.OutValues{
+					FileName:   "testdata/bigdata.txt",
+					FieldIndex: 1,
+					Count:      100,
+					Min:        1,
+					Max:        100,
+					Sum:        5050,
+					Average:    50.5,
+					Median:     50,
+				},
+				options.OutValues{
+					FileName:   "testdata/normal_num.txt",
+					FieldIndex: 1,
+					Count:      5,
+					Min:        1,
+					Max:        5,
+					Sum:        15,
+					Average:    3,
+					Median:     3,
+				},
+			},
+		},
+		TestProcessMultiInputData{
+			args: []string{
+				"testdata/bigdata.txt",
+				"testdata/normal_num.txt",
+			},
+			opts: options.Options{
+				CountFlag:      true,
+				MinFlag:        true,
+				MaxFlag:        true,
+				SumFlag:        true,
+				AverageFlag:    true,
+				MedianFlag:     true,
+				SortedFlag:     false,
+				HeaderFlag:     false,
+				Percentiles:    options.Percentiles{95},
+				InputDelimiter: "\t",
+				OutFile:        "",
+			},
+			out: []options.OutValues{
+				options.OutValues{
+					FileName:    "testdata/bigdata.txt",
+					FieldIndex:  1,
+					Count:       100,
+					Min:         1,
+					Max:         100,
+					Sum:         5050,
+					Average:     50.5,
+					Median:      50,
+					Percentiles: map[float64]float64{95: 95},
+				},
+				options.OutValues{
+					FileName:    "testdata/normal_num.txt",
+					FieldIndex:  1,
+					Count:       5,
+					Min:         1,
+					Max:         5,
+					Sum:         15,
+					Average:     3,
+					Median:      3,
+					Percentiles: map[float64]float64{95: 4},
+				},
+			},
+		},
+		TestProcessMultiInputData{
+			args: []string{
+				"testdata/bigdata.txt",
+				"testdata/normal_num.txt",
+			},
+			opts: options.Options{
+				CountFlag:      true,
+				MinFlag:        true,
+				MaxFlag:        true,
+				SumFlag:        true,
+				AverageFlag:    true,
+				MedianFlag:     false,
+				SortedFlag:     false,
+				HeaderFlag:     false,
+				Percentiles:    options.Percentiles{95},
+				InputDelimiter: "\t",
+				OutFile:        "",
+			},
+			out: []options.OutValues{
+				options.OutValues{
+					FileName:    "testdata/bigdata.txt",
+					FieldIndex:  1,
+					Count:       100,
+					Min:         1,
+					Max:         100,
+					Sum:         5050,
+					Average:     50.5,
+					Percentiles: map[float64]float64{95: 95},
+				},
+				options.OutValues{
+					FileName:    "testdata/normal_num.txt",
+					FieldIndex:  1,
+					Count:       5,
+					Min:         1,
+					Max:         5,
+					Sum:         15,
+					Average:     3,
+					Percentiles: map[float64]float64{95: 4},
+				},
+			},
+		},
+		TestProcessMultiInputData{
+			args: []string{
+				"testdata/sample.csv",
+			},
+			opts: options.Options{
+				CountFlag:      true,
+				MinFlag:        true,
+				MaxFlag:        true,
+				SumFlag:        true,
+				AverageFlag:    true,
+				MedianFlag:     false,
+				SortedFlag:     false,
+				HeaderFlag:     false,
+				Percentiles:    options.Percentiles{95},
+				InputDelimiter: ",",
+				SeparatableFilePath: []options.SeparatableFilePath{
+					options.SeparatableFilePath{
+						FieldIndex: 2,
+						FilePath:   "testdata/sample.csv",
+					},
+				},
+			},
+			out: []options.OutValues{
+				options.OutValues{
+					FileName:    "testdata/sample.csv",
+					FieldIndex:  2,
+					Count:       5,
+					Min:         70,
+					Max:         90,
+					Sum:         400,
+					Average:     80,
+					Percentiles: map[float64]float64{95: 88},
+				},
+			},
+		},
+	}
+	for _, v := range tds {
+		o, err := processMultiInput(v.args, v.opts)
+		assert.NoError(t, err)
+		assert.Equal(t, v.out, o)
+	}
+}
+
+func TestProcessMultiInputFieldName(t *testing.T) {
+	opts := options.Options{
+		CountFlag:      true,
+		SumFlag:        true,
+		InputDelimiter: ",",
+		SeparatableFilePath: []options.SeparatableFilePath{
+			options.SeparatableFilePath{
+				FieldName: "score",
+				FilePath:  "testdata/sample.csv",
+			},
+			options.SeparatableFilePath{
+				FieldName: "elapsed",
+				FilePath:  "testdata/sample.csv",
+			},
+		},
+	}
+	o, err := processMultiInput([]string{"testdata/sample.csv", "testdata/sample.csv"}, opts)
+	// 存在しないヘッダ名はエラーになり、出力データに含まれない
+	assert.EqualError(t, err, "testdata/sample.csv: field is not found in header. name=elapsed available=[name, score, ok]")
+	assert.Equal(t, []options.OutValues{
+		options.OutValues{
+			FileName:  "testdata/sample.csv",
+			FieldName: "score",
+			Count:     5,
+			Min:       70,
+			Max:       90,
+			Sum:       400,
+			Average:   80,
+		},
+	}, o)
+}
+
+func TestProcessMultiInputCSV(t *testing.T) {
+	opts := options.Options{
+		CountFlag:      true,
+		SumFlag:        true,
+		InputDelimiter: ",",
+		CSVFlag:        true,
+		GroupBy:        options.Field{Name: "request"},
+		SeparatableFilePath: []options.SeparatableFilePath{
+			options.SeparatableFilePath{
+				FieldName: "ms",
+				FilePath:  "testdata/quoted.csv",
+			},
+		},
+	}
+	o, err := processMultiInput([]string{"testdata/quoted.csv"}, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(o))
+	for i, v := range []struct {
+		group string
+		count int
+		sum   float64
+	}{
+		{"GET /a,b", 2, 50},
+		{`POST /say "hi"`, 1, 20},
+		{"GET /multi\nline", 1, 30},
+	} {
+		assert.Equal(t, v.group, o[i].GroupKey)
+		assert.Equal(t, v.count, o[i].Count)
+		assert.Equal(t, v.sum, o[i].Sum)
+	}
+
+	// 区切り文字、ダブルクォート、改行を含む集計キーはダブルクォートで囲んで出力する
+	opts.NoFileNameFlag = true
+	opts.OutputDelimiter = ","
+	lines, err := options.Format(o, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`"GET /a,b",2,50`,
+		`"POST /say ""hi""",1,20`,
+		"\"GET /multi\nline\",1,30",
+	}, lines)
+}
+
+func TestProcessMultiInputMultiFields(t *testing.T) {
+	opts := options.Options{
+		CountFlag:      true,
+		SumFlag:        true,
+		MedianFlag:     true,
+		InputDelimiter: ",",
+		SeparatableFilePath: []options.SeparatableFilePath{
+			options.SeparatableFilePath{
+				Fields:   options.Fields{options.Field{Index: 2}, options.Field{Name: "bytes"}},
+				FilePath: "testdata/multi_field.csv",
+			},
+			options.SeparatableFilePath{
+				FieldIndex: 2,
+				FilePath:   "testdata/sample.csv",
+			},
+		},
+	}
+	o, err := processMultiInput([]string{"testdata/multi_field.csv", "testdata/sample.csv"}, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []options.OutValues{
+		options.OutValues{
+			FileName:   "testdata/multi_field.csv",
+			FieldIndex: 2,
+			Count:      4,
+			Min:        5,
+			Max:        100,
+			Sum:        145,
+			Average:    36.25,
+			Median:     10,
+		},
+		options.OutValues{
+			FileName:   "testdata/multi_field.csv",
+			FieldIndex: 3,
+			FieldName:  "bytes",
+			Count:      3,
+			Min:        50,
+			Max:        300,
+			Sum:        450,
+			Average:    150,
+			Median:     100,
+		},
+		options.OutValues{
+			FileName:   "testdata/sample.csv",
+			FieldIndex: 2,
+			Count:      5,
+			Min:        70,
+			Max:        90,
+			Sum:        400,
+			Average:    80,
+			Median:     77,
+		},
+	}, o)
+
+	// --fieldsは-fのないファイルすべてに適用される。集計キーとの併用
+	opts.SeparatableFilePath = nil
+	opts.Fields = options.Fields{options.Field{Name: "latency"}, options.Field{Name: "bytes"}}
+	opts.GroupBy = options.Field{Name: "endpoint"}
+	o, err = processMultiInput([]string{"testdata/multi_field.csv"}, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, len(o))
+	for i, v := range []struct {
+		field string
+		group string
+		sum   float64
+	}{
+		{"latency", "/a", 40},
+		{"latency", "/b", 100},
+		{"latency", "/c", 5},
+		{"bytes", "/a", 400},
+		{"bytes", "/b", 0},
+		{"bytes", "/c", 50},
+	} {
+		assert.Equal(t, v.field, o[i].FieldLabel())
+		assert.Equal(t, v.group, o[i].GroupKey)
+		assert.Equal(t, v.sum, o[i].Sum)
+	}
+}
+
+func TestProcessMultiInputGroupBy(t *testing.T) {
+	opts := options.Options{
+		CountFlag:      true,
+		MinFlag:        true,
+		MaxFlag:        true,
+		SumFlag:        true,
+		AverageFlag:    true,
+		MedianFlag:     true,
+		InputDelimiter: ",",
+		GroupBy:        options.Field{Name: "endpoint"},
+		SeparatableFilePath: []options.SeparatableFilePath{
+			options.SeparatableFilePath{
+				FieldIndex: 2,
+				FilePath:   "testdata/endpoint.csv",
+			},
+		},
+	}
+	expect := []options.OutValues{
+		options.OutValues{
+			FileName:   "testdata/endpoint.csv",
+			FieldIndex: 2,
+			GroupKey:   "/a",
+			Count:      3,
+			Min:        10,
+			Max:        30,
+			Sum:        60,
+			Average:    20,
+			Median:     20,
+		},
+		options.OutValues{
+			FileName:   "testdata/endpoint.csv",
+			FieldIndex: 2,
+			GroupKey:   "/b",
+			Count:      2,
+			Min:        100,
+			Max:        300,
+			Sum:        400,
+			Average:    200,
+			Median:     100,
+		},
+		options.OutValues{
+			FileName:   "testdata/endpoint.csv",
+			FieldIndex: 2,
+			GroupKey:   "/c",
+			Count:      1,
+			Min:        5,
+			Max:        5,
+			Sum:        5,
+			Average:    5,
+			Median:     5,
+		},
+	}
+	o, err := processMultiInput([]string{"testdata/endpoint.csv"}, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, expect, o)
+
+	// フィールド番号指定でも同じ結果になる。ヘッダ行は-Iで無視する
+	opts.GroupBy = options.Field{Index: 1}
+	opts.IgnoreHeaderRows = 1
+	o, err = processMultiInput([]string{"testdata/endpoint.csv"}, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, expect, o)
+
+	// 集計キーの列を変えると集計単位が変わる
+	opts.GroupBy = options.Field{Name: "status"}
+	opts.IgnoreHeaderRows = 0
+	o, err = processMultiInput([]string{"testdata/endpoint.csv"}, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(o))
+	assert.Equal(t, "200", o[0].GroupKey)
+	assert.Equal(t, 5, o[0].Count)
+	assert.Equal(t, "500", o[1].GroupKey)
+	assert.Equal(t, 1, o[1].Count)
+}
+
+func TestProcessMultiInputError(t *testing.T) {
+	opts := options.Options{
+		CountFlag:      true,
+		InputDelimiter: "\t",
+	}
+	fns := []string{
+		"testdata/not_found1.txt",
+		"testdata/normal_num.txt",
+		"testdata/not_found2.txt",
+	}
+	o, err := processMultiInput(fns, opts)
+	assert.Error(t, err)
+
+	// 失敗したファイルのエラーを指定順に保持する
+	ierr, ok := err.(inputError)
+	assert.True(t, ok)
+	assert.Equal(t, 2, len(ierr))
+	assert.Equal(t, "testdata/not_found1.txt", ierr[0].fileName)
+	assert.Equal(t, "testdata/not_found2.txt", ierr[1].fileName)
+	assert.True(t, os.IsNotExist(ierr[0].err))
+
+	// 失敗したファイルは出力データに含まれない
+	assert.Equal(t, []options.OutValues{
+		options.OutValues{
+			FileName:   "testdata/normal_num.txt",
+			FieldIndex: 1,
+			Count:      5,
+			Min:        1,
+			Max:        5,
+			Sum:        15,
+			Average:    3,
+		},
+	}, o)
+}
+
+type TestRunData struct {
+	args []string
+	code int
+}
+
+func TestRun(t *testing.T) {
+	tds := []TestRunData{
+		TestRunData{
+			args: []string{"main.go", "testdata/normal_num.txt"},
+			code: exitCodeOK,
+		},
+		TestRunData{ // 一部のファイルの処理に失敗
+			args: []string{"main.go", "testdata/normal_num.txt", "testdata/not_found.txt"},
+			code: exitCodeInputError,
+		},
+		TestRunData{ // 存在しないヘッダ名
+			args: []string{"main.go", "-d", ",", "-f", "elapsed:testdata/sample.csv"},
+			code: exitCodeInputError,
+		},
+		TestRunData{ // 閾値の条件を満たす
+			args: []string{"main.go", "--assert", "p99<=99", "--assert", "count>=100", "testdata/bigdata.txt"},
+			code: exitCodeOK,
+		},
+		TestRunData{ // 閾値の条件を満たさない
+			args: []string{"main.go", "--assert", "p99<99", "testdata/bigdata.txt", "testdata/normal_num.txt"},
+			code: exitCodeAssertionError,
+		},
+		TestRunData{ // 入力の処理の失敗を優先
+			args: []string{"main.go", "--assert", "count>=100", "testdata/normal_num.txt", "testdata/not_found.txt"},
+			code: exitCodeInputError,
+		},
+		TestRunData{ // 比較
+			args: []string{"main.go", "compare", "testdata/normal_num.txt", "testdata/bigdata.txt"},
+			code: exitCodeOK,
+		},
+		TestRunData{ // 閾値を超えて悪化
+			args: []string{"main.go", "compare", "--fail-on-regression", "5%", "testdata/normal_num.txt", "testdata/bigdata.txt"},
+			code: exitCodeAssertionError,
+		},
+		TestRunData{ // 改善は悪化とみなさない
+			args: []string{"main.go", "compare", "--fail-on-regression", "5%", "-x", "testdata/bigdata.txt", "testdata/normal_num.txt"},
+			code: exitCodeOK,
+		},
+		TestRunData{ // 比較する入力の処理に失敗
+			args: []string{"main.go", "compare", "testdata/normal_num.txt", "testdata/not_found.txt"},
+			code: exitCodeInputError,
+		},
+		TestRunData{ // 出力に失敗
+			args: []string{"main.go", "-o", "testdata/not_found/out.txt", "testdata/normal_num.txt"},
+			code: exitCodeInputError,
+		},
+		TestRunData{ // 合計の行も閾値の判定の対象
+			args: []string{"main.go", "--total", "--assert", "count<=104", "testdata/normal_num.txt", "testdata/bigdata.txt"},
+			code: exitCodeAssertionError,
+		},
+		TestRunData{ // 時間窓ごとの閾値の判定
+			args: []string{"main.go", "--csv", "--window", "10s", "--time-field", "time", "--assert", "p95<120", "-f", "latency_ms:testdata/loadtest.csv"},
+			code: exitCodeAssertionError,
+		},
+		TestRunData{ // ヒストグラム
+			args: []string{"main.go", "histogram", "--bins", "10,50", "testdata/bigdata.txt"},
+			code: exitCodeOK,
+		},
+		TestRunData{ // 棒グラフ
+			args: []string{"main.go", "--plot", "--width", "40", "testdata/bigdata.txt"},
+			code: exitCodeOK,
+		},
+		TestRunData{ // スパークライン
+			args: []string{"main.go", "--sparkline", "-c", "testdata/bigdata.txt", "testdata/normal_num.txt"},
+			code: exitCodeOK,
+		},
+		TestRunData{ // 対数の階級に正の値がない
+			args: []string{"main.go", "--histogram", "--bin-scale", "log", "testdata/negative_num.txt"},
+			code: exitCodeInputError,
+		},
+	}
+	for _, v := range tds {
+		os.Args = v.args
+		assert.Equal(t, v.code, run(), strings.Join(v.args, " "))
+	}
+}
+
+func TestRunMerge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "arth")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "a.bin")
+	os.Args = []string{"main.go", "--emit-state", fn, "testdata/normal_num.txt"}
+	assert.Equal(t, exitCodeOK, run())
+	os.Args = []string{"main.go", "merge", fn}
+	assert.Equal(t, exitCodeOK, run())
+
+	// 集計の指定をオプションにセットできない状態ファイル
+	bad := filepath.Join(dir, "bad.bin")
+	assert.NoError(t, writeState(bad, nil, stateSpec{Unit: "parsec"}))
+	os.Args = []string{"main.go", "merge", bad}
+	assert.Equal(t, exitCodeInputError, run())
+}
+
+func TestAssertionOptions(t *testing.T) {
+	// 条件がなければそのまま
+	opts := options.Options{CountFlag: true, Percentiles: options.Percentiles{95}, InputDelimiter: "\t"}
+	assert.Equal(t, opts, assertionOptions(opts))
+
+	// 条件に必要な統計値を算出する
+	for _, v := range []string{"median<1", "p99<1", "p95<1", "samplevariance<1", "stddev<1"} {
+		var a options.Assertion
+		assert.NoError(t, a.UnmarshalFlag(v))
+		opts.Assertions = append(opts.Assertions, a)
+	}
+	o := assertionOptions(opts)
+	assert.True(t, o.MedianFlag)
+	assert.True(t, o.VarianceFlag)
+	assert.True(t, o.StdDevFlag)
+	assert.Equal(t, options.Percentiles{95, 99}, o.Percentiles)
+	// もとのオプションは変更しない
+	assert.False(t, opts.MedianFlag)
+	assert.Equal(t, options.Percentiles{95}, opts.Percentiles)
+
+	// 出力しない統計値も算出される
+	ovs, err := processMultiInput([]string{"testdata/bigdata.txt"}, o)
+	assert.NoError(t, err)
+	assert.Equal(t, 99.0, ovs[0].Percentiles[99])
+	lines, err := options.Format(ovs, options.Options{
+		CountFlag:       true,
+		Percentiles:     options.Percentiles{95},
+		OutputDelimiter: "\t",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"testdata/bigdata.txt\t100\t95"}, lines)
+}
+
+func TestProcessCompare(t *testing.T) {
+	opts := options.Options{
+		CountFlag:      true,
+		AverageFlag:    true,
+		InputDelimiter: ",",
+		GroupBy:        options.Field{Name: "endpoint"},
+		SeparatableFilePath: []options.SeparatableFilePath{
+			options.SeparatableFilePath{FieldName: "latency", FilePath: "testdata/endpoint.csv"},
+			options.SeparatableFilePath{FieldName: "latency", FilePath: "testdata/multi_field.csv"},
+		},
+	}
+	cmps, err := processCompare([]string{"testdata/endpoint.csv", "testdata/multi_field.csv"}, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, len(cmps))
+	assert.Equal(t, options.Comparison{
+		Field:        "latency",
+		GroupKey:     "/b",
+		Stat:         options.HeaderAverage,
+		Baseline:     200,
+		Candidate:    100,
+		HasBaseline:  true,
+		HasCandidate: true,
+	}, cmps[3])
+
+	_, err = processCompare([]string{"testdata/not_found.txt", "testdata/normal_num.txt"}, options.Options{CountFlag: true})
+	assert.Error(t, err)
+}
+
+func TestNewConfigApprox(t *testing.T) {
+	spath := options.SeparatableFilePath{FieldIndex: 1}
+
+	// 近似するときはデータを保持しない
+	conf := newConfig(options.Options{MedianFlag: true, ApproxFlag: true}, spath)
+	assert.True(t, conf.Approx)
+	assert.False(t, conf.NeedValues)
+
+	// 中央値、パーセンタイル値がなければスケッチも不要
+	conf = newConfig(options.Options{CountFlag: true, ApproxFlag: true}, spath)
+	assert.False(t, conf.Approx)
+	assert.False(t, conf.NeedValues)
+
+	// 集計の状態を出力するときは、データを保持せずにスケッチを集計する
+	conf = newConfig(options.Options{CountFlag: true, EmitState: "a.bin"}, spath)
+	assert.True(t, conf.Approx)
+	assert.False(t, conf.NeedValues)
+
+	// 中央値を正確に算出するときはデータを保持し、状態ファイルのスケッチはデータから生成する
+	conf = newConfig(options.Options{MedianFlag: true, EmitState: "a.bin"}, spath)
+	assert.False(t, conf.Approx)
+	assert.True(t, conf.NeedValues)
+}
+
+func TestProcessMultiInputApprox(t *testing.T) {
+	opts := options.Options{
+		CountFlag:      true,
+		MedianFlag:     true,
+		Percentiles:    options.Percentiles{99},
+		ApproxFlag:     true,
+		InputDelimiter: "\t",
+	}
+	o, err := processMultiInput([]string{"testdata/bigdata.txt"}, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, o[0].Count)
+	assert.InDelta(t, 50.5, o[0].Median, 1)
+	assert.InDelta(t, 99, o[0].Percentiles[99], 1)
+}
+
+func TestProcessMultiInputHistogram(t *testing.T) {
+	opts := options.Options{
+		HistogramFlag:  true,
+		Bins:           options.Bins{Count: 4},
+		InputDelimiter: "\t",
+	}
+	o, err := processMultiInput([]string{"testdata/bigdata.txt"}, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []options.Bucket{
+		options.Bucket{Lower: 1, Upper: 25.75, Count: 25},
+		options.Bucket{Lower: 25.75, Upper: 50.5, Count: 25},
+		options.Bucket{Lower: 50.5, Upper: 75.25, Count: 25},
+		options.Bucket{Lower: 75.25, Upper: 100, Count: 25},
+	}, o[0].Histogram)
+
+	// 境界値の範囲外の値は両端の階級に数える
+	opts.Bins = options.Bins{Edges: []float64{10, 50}}
+	o, err = processMultiInput([]string{"testdata/bigdata.txt"}, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []options.Bucket{
+		options.Bucket{Lower: math.Inf(-1), Upper: 10, Count: 9},
+		options.Bucket{Lower: 10, Upper: 50, Count: 40},
+		options.Bucket{Lower: 50, Upper: math.Inf(1), Count: 51},
+	}, o[0].Histogram)
+
+	// 階級の指定がなければ10階級
+	opts.Bins = options.Bins{}
+	opts.BinScale = options.BinScaleLog
+	o, err = processMultiInput([]string{"testdata/bigdata.txt"}, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, len(o[0].Histogram))
+	assert.Equal(t, 1.0, o[0].Histogram[0].Lower)
+	assert.Equal(t, 100.0, o[0].Histogram[9].Upper)
+}
+
+func TestProcessMultiInputSparkline(t *testing.T) {
+	opts := options.Options{
+		CountFlag:       true,
+		SparklineFlag:   true,
+		Bins:            options.Bins{Count: 4},
+		InputDelimiter:  "\t",
+		OutputDelimiter: "\t",
+	}
+	o, err := processMultiInput([]string{"testdata/normal_num.txt"}, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(o[0].Histogram))
+	lines, err := options.Format(o, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"testdata/normal_num.txt\t5\t▄▄▄█"}, lines)
+}
+
+type TestExtremeValuesData struct {
+	fn  string
+	out string
 }
 
-func TestProcessStdin(t *testing.T) {
+// TestExtremeValues は負数、正負混在、無限大、非常に大きい値を含むデータについて、
+// すべての統計値の出力を固定する。
+func TestExtremeValues(t *testing.T) {
 	opts := options.Options{
-		CountFlag:      true,
-		MinFlag:        true,
-		MaxFlag:        true,
-		SumFlag:        true,
-		AverageFlag:    true,
-		MedianFlag:     true,
-		SortedFlag:     false,
-		HeaderFlag:     false,
-		InputDelimiter: "\t",
-		OutFile:        "",
+		NoFileNameFlag:  true,
+		CountFlag:       true,
+		MinFlag:         true,
+		MaxFlag:         true,
+		SumFlag:         true,
+		AverageFlag:     true,
+		MedianFlag:      true,
+		Percentiles:     options.Percentiles{50, 95},
+		StdDevFlag:      true,
+		VarianceFlag:    true,
+		HeaderFlag:      true,
+		InputDelimiter:  "\t",
+		OutputDelimiter: "\t",
 	}
+	header := "count\tmin\tmax\tsum\tavg\tmedian\t50percentile\t95percentile\tvariance\tsamplevariance\tstddev\tsamplestddev"
 
-	var err error
-	os.Stdin, err = os.Open("testdata/normal_num.txt")
-	assert.NoError(t, err)
-
-	o, err := processStdin(opts)
-	assert.NoError(t, err)
-	assert.Equal(t, []options.OutValues{
-		options.OutValues{
-			Count:   5,
-			Min:     1,
-			Max:     5,
-			Sum:     15,
-			Average: 3,
-			Median:  3,
+	tds := []TestExtremeValuesData{
+		TestExtremeValuesData{ // 負数のみ
+			fn:  "testdata/negative_num.txt",
+			out: "5\t-5\t-1\t-15\t-3\t-3\t-4\t-2\t2\t2.5\t1.414214\t1.581139",
 		},
-	}, o)
+		TestExtremeValuesData{ // 正負の混在と-0
+			fn:  "testdata/mixed_sign_num.txt",
+			out: "5\t-2\t3\t2\t0.4\t0\t0\t1\t2.64\t3.3\t1.624808\t1.81659",
+		},
+		TestExtremeValuesData{ // 無限大とNaN(NaNは無視される)
+			fn:  "testdata/inf_num.txt",
+			out: "3\t-2\t+Inf\t+Inf\t+Inf\t1\t-2\t1\tNaN\tNaN\tNaN\tNaN",
+		},
+		TestExtremeValuesData{ // 正負の無限大
+			fn:  "testdata/both_inf_num.txt",
+			out: "3\t-Inf\t+Inf\tNaN\tNaN\t1\t-Inf\t1\tNaN\tNaN\tNaN\tNaN",
+		},
+		TestExtremeValuesData{ // 合計値がオーバーフローする大きな値
+			fn:  "testdata/large_num.txt",
+			out: "3\t1e+308\t1.5e+308\t+Inf\t1.2333333333333333e+308\t1.2e+308\t1e+308\t1.2e+308\t+Inf\t+Inf\t+Inf\t+Inf",
+		},
+		TestExtremeValuesData{ // 合計値がオーバーフローする大きな負の値
+			fn:  "testdata/large_negative_num.txt",
+			out: "3\t-1.5e+308\t-1e+308\t-Inf\t-1.2333333333333333e+308\t-1.2e+308\t-1.5e+308\t-1.2e+308\t+Inf\t+Inf\t+Inf\t+Inf",
+		},
+	}
+	for _, v := range tds {
+		ovs, err := processMultiInput([]string{v.fn}, opts)
+		assert.NoError(t, err)
+		lines, err := options.Format(ovs, opts)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{header, v.out}, lines, v.fn)
+	}
 }
 
-type TestProcessMultiInputData struct {
-	args []string
-	opts options.Options
-	out  []options.OutValues
+type TestExtremeValuesMethodData struct {
+	fn string
+	// quantile は算出方法ごとの中央値、50、95パーセンタイル値です
+	quantile map[string]string
+	approx   string
+	total    string
 }
 
-func TestProcessMultiInput(t *testing.T) {
-	tds := []TestProcessMultiInputData{
-		TestProcessMultiInputData{
-			args: []string{
-				"testdata/bigdata.txt",
-				"testdata/normal_num.txt",
-			},
-			opts: options.Options{
-				CountFlag:      true,
-				MinFlag:        true,
-				MaxFlag:        true,
-				SumFlag:        true,
-				AverageFlag:    true,
-				MedianFlag:     true,
-				SortedFlag:     false,
-				HeaderFlag:     false,
-				InputDelimiter: "\t",
-				OutFile:        "",
-			},
-			out: []options.OutValues{
-				options.OutValues{
-					FileName: "testdata/bigdata.txt",
-					Count:    100,
-					Min:      1,
-					Max:      100,
-					Sum:      5050,
-					Average:  50.5,
-					Median:   50,
-				},
-				options.OutValues{
-					FileName: "testdata/normal_num.txt",
-					Count:    5,
-					Min:      1,
-					Max:      5,
-					Sum:      15,
-					Average:  3,
-					Median:   3,
-				},
+// TestExtremeValuesMethod は極端な値を含むデータについて、中央値、パーセンタイル値の
+// 算出方法ごと、--approx、--totalでもNaNにならず正しく集計できることを確認する。
+func TestExtremeValuesMethod(t *testing.T) {
+	opts := options.Options{
+		NoFileNameFlag:  true,
+		CountFlag:       true,
+		MinFlag:         true,
+		MaxFlag:         true,
+		SumFlag:         true,
+		AverageFlag:     true,
+		MedianFlag:      true,
+		Percentiles:     options.Percentiles{50, 95},
+		StdDevFlag:      true,
+		VarianceFlag:    true,
+		InputDelimiter:  "\t",
+		OutputDelimiter: "\t",
+	}
+
+	tds := []TestExtremeValuesMethodData{
+		TestExtremeValuesMethodData{ // 負数のみ
+			fn: "testdata/negative_num.txt",
+			quantile: map[string]string{
+				"nearest":  "-3\t-3\t-1",
+				"linear":   "-3\t-3\t-1.2",
+				"midpoint": "-3\t-3\t-1.5",
+				"lower":    "-3\t-3\t-2",
+				"higher":   "-3\t-3\t-1",
 			},
+			approx: "5\t-5\t-1\t-15\t-3\t-3\t-3\t-1\t2\t2.5\t1.414214\t1.581139",
+			total:  "10\t-5\t-1\t-30\t-3\t-3\t-3\t-1\t2\t2.222222\t1.414214\t1.490712",
 		},
-		TestProcessMultiInputData{
-			args: []string{
-				"testdata/bigdata.txt",
-				"testdata/normal_num.txt",
-			},
-			opts: options.Options{
-				CountFlag:      true,
-				MinFlag:        true,
-				MaxFlag:        true,
-				SumFlag:        true,
-				AverageFlag:    true,
-				MedianFlag:     true,
-				SortedFlag:     false,
-				HeaderFlag:     false,
-				Percentile:     95,
-				InputDelimiter: "\t",
-				OutFile:        "",
-			},
-			out: []options.OutValues{
-				options.OutValues{
-					FileName:   "testdata/bigdata.txt",
-					Count:      100,
-					Min:        1,
-					Max:        100,
-					Sum:        5050,
-					Average:    50.5,
-					Median:     50,
-					Percentile: 95,
-				},
-				options.OutValues{
-					FileName:   "testdata/normal_num.txt",
-					Count:      5,
-					Min:        1,
-					Max:        5,
-					Sum:        15,
-					Average:    3,
-					Median:     3,
-					Percentile: 4,
-				},
+		TestExtremeValuesMethodData{ // 正負の混在と-0
+			fn: "testdata/mixed_sign_num.txt",
+			quantile: map[string]string{
+				"nearest":  "0\t0\t3",
+				"linear":   "0\t0\t2.6",
+				"midpoint": "0\t0\t2",
+				"lower":    "0\t0\t1",
+				"higher":   "0\t0\t3",
 			},
+			approx: "5\t-2\t3\t2\t0.4\t0\t0\t3\t2.64\t3.3\t1.624808\t1.81659",
+			total:  "10\t-2\t3\t4\t0.4\t0\t0\t3\t2.64\t2.933333\t1.624808\t1.712698",
 		},
-		TestProcessMultiInputData{
-			args: []string{
-				"testdata/bigdata.txt",
-				"testdata/normal_num.txt",
-			},
-			opts: options.Options{
-				CountFlag:      true,
-				MinFlag:        true,
-				MaxFlag:        true,
-				SumFlag:        true,
-				AverageFlag:    true,
-				MedianFlag:     false,
-				SortedFlag:     false,
-				HeaderFlag:     false,
-				Percentile:     95,
-				InputDelimiter: "\t",
-				OutFile:        "",
-			},
-			out: []options.OutValues{
-				options.OutValues{
-					FileName:   "testdata/bigdata.txt",
-					Count:      100,
-					Min:        1,
-					Max:        100,
-					Sum:        5050,
-					Average:    50.5,
-					Percentile: 95,
-				},
-				options.OutValues{
-					FileName:   "testdata/normal_num.txt",
-					Count:      5,
-					Min:        1,
-					Max:        5,
-					Sum:        15,
-					Average:    3,
-					Percentile: 4,
-				},
+		TestExtremeValuesMethodData{ // 無限大とNaN(NaNは無視される)
+			fn: "testdata/inf_num.txt",
+			quantile: map[string]string{
+				"nearest":  "1\t1\t+Inf",
+				"linear":   "1\t1\t+Inf",
+				"midpoint": "1\t1\t+Inf",
+				"lower":    "1\t1\t1",
+				"higher":   "1\t1\t+Inf",
 			},
+			approx: "3\t-2\t+Inf\t+Inf\t+Inf\t1\t1\t+Inf\tNaN\tNaN\tNaN\tNaN",
+			total:  "6\t-2\t+Inf\t+Inf\t+Inf\t1\t1\t+Inf\tNaN\tNaN\tNaN\tNaN",
 		},
-		TestProcessMultiInputData{
-			args: []string{
-				"testdata/sample.csv",
+		TestExtremeValuesMethodData{ // 正負の無限大
+			fn: "testdata/both_inf_num.txt",
+			quantile: map[string]string{
+				"nearest":  "1\t1\t+Inf",
+				"linear":   "1\t1\t+Inf",
+				"midpoint": "1\t1\t+Inf",
+				"lower":    "1\t1\t1",
+				"higher":   "1\t1\t+Inf",
 			},
-			opts: options.Options{
-				CountFlag:      true,
-				MinFlag:        true,
-				MaxFlag:        true,
-				SumFlag:        true,
-				AverageFlag:    true,
-				MedianFlag:     false,
-				SortedFlag:     false,
-				HeaderFlag:     false,
-				Percentile:     95,
-				InputDelimiter: ",",
-				SeparatableFilePath: []options.SeparatableFilePath{
-					options.SeparatableFilePath{
-						FieldIndex: 2,
-						FilePath:   "testdata/sample.csv",
-					},
-				},
+			approx: "3\t-Inf\t+Inf\tNaN\tNaN\t1\t1\t+Inf\tNaN\tNaN\tNaN\tNaN",
+			total:  "6\t-Inf\t+Inf\tNaN\tNaN\t1\t1\t+Inf\tNaN\tNaN\tNaN\tNaN",
+		},
+		TestExtremeValuesMethodData{ // 補間でオーバーフローする大きな値
+			fn: "testdata/large_num.txt",
+			quantile: map[string]string{
+				"nearest":  "1.2e+308\t1.2e+308\t1.5e+308",
+				"linear":   "1.2e+308\t1.2e+308\t1.47e+308",
+				"midpoint": "1.2e+308\t1.2e+308\t1.35e+308",
+				"lower":    "1.2e+308\t1.2e+308\t1.2e+308",
+				"higher":   "1.2e+308\t1.2e+308\t1.5e+308",
 			},
-			out: []options.OutValues{
-				options.OutValues{
-					FileName:   "testdata/sample.csv",
-					Count:      5,
-					Min:        70,
-					Max:        90,
-					Sum:        400,
-					Average:    80,
-					Percentile: 88,
-				},
+			approx: "3\t1e+308\t1.5e+308\t+Inf\t1.2333333333333333e+308\t1.2e+308\t1.2e+308\t1.5e+308\t+Inf\t+Inf\t+Inf\t+Inf",
+			total:  "6\t1e+308\t1.5e+308\t+Inf\t1.2333333333333333e+308\t1.2e+308\t1.2e+308\t1.5e+308\t+Inf\t+Inf\t+Inf\t+Inf",
+		},
+		TestExtremeValuesMethodData{ // 補間でオーバーフローする大きな負の値
+			fn: "testdata/large_negative_num.txt",
+			quantile: map[string]string{
+				"nearest":  "-1.2e+308\t-1.2e+308\t-1e+308",
+				"linear":   "-1.2e+308\t-1.2e+308\t-1.02e+308",
+				"midpoint": "-1.2e+308\t-1.2e+308\t-1.1e+308",
+				"lower":    "-1.2e+308\t-1.2e+308\t-1.2e+308",
+				"higher":   "-1.2e+308\t-1.2e+308\t-1e+308",
 			},
+			approx: "3\t-1.5e+308\t-1e+308\t-Inf\t-1.2333333333333333e+308\t-1.2e+308\t-1.2e+308\t-1e+308\t+Inf\t+Inf\t+Inf\t+Inf",
+			total:  "6\t-1.5e+308\t-1e+308\t-Inf\t-1.2333333333333333e+308\t-1.2e+308\t-1.2e+308\t-1e+308\t+Inf\t+Inf\t+Inf\t+Inf",
 		},
 	}
 	for _, v := range tds {
-		o := processMultiInput(v.args, v.opts)
-		assert.Equal(t, v.out, o)
+		for _, m := range []string{"nearest", "linear", "midpoint", "lower", "higher"} {
+			o := opts
+			o.QuantileMethod = m
+			ovs, err := processMultiInput([]string{v.fn}, o)
+			assert.NoError(t, err)
+			out, err := options.Format(ovs, o)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, len(out), v.fn+" "+m)
+			// 中央値、50、95パーセンタイル値の列のみ比較する
+			cols := strings.Split(out[0], "\t")
+			assert.Equal(t, v.quantile[m], strings.Join(cols[5:8], "\t"), v.fn+" "+m)
+		}
+
+		o := opts
+		o.ApproxFlag = true
+		ovs, err := processMultiInput([]string{v.fn}, o)
+		assert.NoError(t, err)
+		lines, err := options.Format(ovs, o)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{v.approx}, lines, v.fn+" approx")
+
+		// 同じファイルを2回入力し、合計の行を比較する
+		o = opts
+		o.TotalFlag = true
+		ovs, err = processMultiInput([]string{v.fn, v.fn}, o)
+		assert.NoError(t, err)
+		out, err := options.Format(ovs, o)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, len(out), v.fn+" total")
+		assert.Equal(t, v.total, out[len(out)-1], v.fn+" total")
 	}
 }
 
-type TestCalcOutValuesData struct {
+type TestAccumulateAllData struct {
 	r    io.Reader
 	opts options.Options
 	conf arthmath.MinMaxSumAvgConfig
 	out  options.OutValues
 }
 
-func TestCalcOutValues(t *testing.T) {
+func TestAccumulateAll(t *testing.T) {
 	f := func(ss ...string) io.Reader {
 		return bytes.NewBufferString(strings.Join(ss, "\n"))
 	}
 
-	tds := []TestCalcOutValuesData{
-		TestCalcOutValuesData{
+	tds := []TestAccumulateAllData{
+		TestAccumulateAllData{ // 近似。少量のデータは正確に算出できる
+			r: f(
+				"5.0",
+				"1.0",
+				"3.0",
+				"2.0",
+				"4.0",
+			),
+			opts: options.Options{
+				CountFlag:   true,
+				MedianFlag:  true,
+				Percentiles: options.Percentiles{25, 100},
+				ApproxFlag:  true,
+			},
+			conf: arthmath.MinMaxSumAvgConfig{
+				Approx: true,
+			},
+			out: options.OutValues{
+				Count:       5,
+				Min:         1,
+				Max:         5,
+				Sum:         15,
+				Average:     3,
+				Median:      3,
+				Percentiles: map[float64]float64{25: 1.75, 100: 5},
+			},
+		},
+		TestAccumulateAllData{
 			r: f(
 				"1.0",
 				"2.0",
@@ -341,22 +1813,22 @@ func TestCalcOutValues(t *testing.T) {
 				SumFlag:     true,
 				AverageFlag: true,
 				MedianFlag:  true,
-				Percentile:  95,
+				Percentiles: options.Percentiles{95},
 			},
 			conf: arthmath.MinMaxSumAvgConfig{
 				NeedValues: true,
 			},
 			out: options.OutValues{
-				Count:      5,
-				Min:        1,
-				Max:        5,
-				Sum:        15,
-				Average:    3,
-				Median:     3,
-				Percentile: 4,
+				Count:       5,
+				Min:         1,
+				Max:         5,
+				Sum:         15,
+				Average:     3,
+				Median:      3,
+				Percentiles: map[float64]float64{95: 4},
 			},
 		},
-		TestCalcOutValuesData{
+		TestAccumulateAllData{
 			r: f(
 				"1.0",
 				"2.0",
@@ -384,7 +1856,7 @@ func TestCalcOutValues(t *testing.T) {
 				Median:  3,
 			},
 		},
-		TestCalcOutValuesData{
+		TestAccumulateAllData{
 			r: f(
 				"1.0",
 				"2.0",
@@ -393,22 +1865,22 @@ func TestCalcOutValues(t *testing.T) {
 				"5.0",
 			),
 			opts: options.Options{
-				CountFlag:  true,
-				Percentile: 95,
+				CountFlag:   true,
+				Percentiles: options.Percentiles{95},
 			},
 			conf: arthmath.MinMaxSumAvgConfig{
 				NeedValues: true,
 			},
 			out: options.OutValues{
-				Count:      5,
-				Min:        1,
-				Max:        5,
-				Sum:        15,
-				Average:    3,
-				Percentile: 4,
+				Count:       5,
+				Min:         1,
+				Max:         5,
+				Sum:         15,
+				Average:     3,
+				Percentiles: map[float64]float64{95: 4},
 			},
 		},
-		TestCalcOutValuesData{
+		TestAccumulateAllData{
 			r: f(
 				"1.0",
 				"2.0",
@@ -427,7 +1899,7 @@ func TestCalcOutValues(t *testing.T) {
 				Average: 3,
 			},
 		},
-		TestCalcOutValuesData{
+		TestAccumulateAllData{
 			r: f(
 				"1.0",
 				"2.0",
@@ -436,24 +1908,24 @@ func TestCalcOutValues(t *testing.T) {
 				"4.0",
 			),
 			opts: options.Options{
-				SortedFlag: true,
-				MedianFlag: true,
-				Percentile: 95,
+				SortedFlag:  true,
+				MedianFlag:  true,
+				Percentiles: options.Percentiles{95},
 			},
 			conf: arthmath.MinMaxSumAvgConfig{
 				NeedValues: true,
 			},
 			out: options.OutValues{
-				Count:      5,
-				Min:        1,
-				Max:        5,
-				Sum:        15,
-				Average:    3,
-				Median:     5,
-				Percentile: 3,
+				Count:       5,
+				Min:         1,
+				Max:         5,
+				Sum:         15,
+				Average:     3,
+				Median:      5,
+				Percentiles: map[float64]float64{95: 3},
 			},
 		},
-		TestCalcOutValuesData{
+		TestAccumulateAllData{
 			r: f(
 				"1.0",
 				"2.0",
@@ -462,22 +1934,22 @@ func TestCalcOutValues(t *testing.T) {
 				"4.0",
 			),
 			opts: options.Options{
-				SortedFlag: true,
-				Percentile: 95,
+				SortedFlag:  true,
+				Percentiles: options.Percentiles{95},
 			},
 			conf: arthmath.MinMaxSumAvgConfig{
 				NeedValues: true,
 			},
 			out: options.OutValues{
-				Count:      5,
-				Min:        1,
-				Max:        5,
-				Sum:        15,
-				Average:    3,
-				Percentile: 3,
+				Count:       5,
+				Min:         1,
+				Max:         5,
+				Sum:         15,
+				Average:     3,
+				Percentiles: map[float64]float64{95: 3},
 			},
 		},
-		TestCalcOutValuesData{
+		TestAccumulateAllData{
 			r: f(
 				"1.0",
 				"2.0",
@@ -501,7 +1973,7 @@ func TestCalcOutValues(t *testing.T) {
 				Median:  5,
 			},
 		},
-		TestCalcOutValuesData{
+		TestAccumulateAllData{
 			r: f(
 				"1.0,6",
 				"2.0,7",
@@ -520,15 +1992,16 @@ func TestCalcOutValues(t *testing.T) {
 				NeedValues:       true,
 			},
 			out: options.OutValues{
-				Count:   5,
-				Min:     6,
-				Max:     10,
-				Sum:     40,
-				Average: 8,
-				Median:  8,
+				FieldIndex: 2,
+				Count:      5,
+				Min:        6,
+				Max:        10,
+				Sum:        40,
+				Average:    8,
+				Median:     8,
 			},
 		},
-		TestCalcOutValuesData{
+		TestAccumulateAllData{
 			r: f(
 				"1.0,6",
 				"2.0,7",
@@ -547,20 +2020,102 @@ func TestCalcOutValues(t *testing.T) {
 				NeedValues:       true,
 			},
 			out: options.OutValues{
-				Count:   4,
-				Min:     7,
-				Max:     10,
-				Sum:     34,
-				Average: 8.5,
-				Median:  8,
+				FieldIndex: 2,
+				Count:      4,
+				Min:        7,
+				Max:        10,
+				Sum:        34,
+				Average:    8.5,
+				Median:     8,
+			},
+		},
+		TestAccumulateAllData{
+			r: f(
+				"5.0",
+				"3.0",
+				"1.0",
+				"4.0",
+				"2.0",
+			),
+			opts: options.Options{
+				Percentiles: options.Percentiles{50, 90, 99.9},
+			},
+			conf: arthmath.MinMaxSumAvgConfig{
+				NeedValues: true,
+			},
+			out: options.OutValues{
+				Count:   5,
+				Min:     1,
+				Max:     5,
+				Sum:     15,
+				Average: 3,
+				Percentiles: map[float64]float64{
+					50:   2,
+					90:   4,
+					99.9: 4,
+				},
+			},
+		},
+		TestAccumulateAllData{
+			r: f(
+				"4.0",
+				"1.0",
+				"3.0",
+				"2.0",
+			),
+			opts: options.Options{
+				MedianFlag:     true,
+				Percentiles:    options.Percentiles{90},
+				QuantileMethod: "linear",
+			},
+			conf: arthmath.MinMaxSumAvgConfig{
+				NeedValues: true,
+			},
+			out: options.OutValues{
+				Count:       4,
+				Min:         1,
+				Max:         4,
+				Sum:         10,
+				Average:     2.5,
+				Median:      2.5,
+				Percentiles: map[float64]float64{90: 3.7},
+			},
+		},
+		TestAccumulateAllData{
+			r: f(
+				"2",
+				"4",
+				"4",
+				"4",
+				"5",
+				"5",
+				"7",
+				"9",
+			),
+			opts: options.Options{
+				StdDevFlag:   true,
+				VarianceFlag: true,
+			},
+			out: options.OutValues{
+				Count:          8,
+				Min:            2,
+				Max:            9,
+				Sum:            40,
+				Average:        5,
+				Variance:       4,
+				SampleVariance: 32.0 / 7.0,
+				StdDev:         2,
+				SampleStdDev:   math.Sqrt(32.0 / 7.0),
 			},
 		},
 	}
 
 	for _, v := range tds {
-		ov, err := calcOutValues(v.r, v.opts, v.conf)
+		as, err := accumulateAll(v.r, v.opts, v.conf)
+		assert.NoError(t, err)
+		ovs, err := newOutValues(as, v.opts)
 		assert.NoError(t, err)
-		assert.Equal(t, v.out, ov)
+		assert.Equal(t, []options.OutValues{v.out}, ovs)
 	}
 }
 
@@ -581,3 +2136,48 @@ func TestOut(t *testing.T) {
 	}
 	assert.NoError(t, out(lines, opts))
 }
+
+// benchmarkAccumulateFile はtestdata/bigdata.txtと同じ1行1つの数値のファイルを生成し、
+// workers個以下の範囲に分割して集計する。
+func benchmarkAccumulateFile(b *testing.B, workers int) {
+	dir, err := ioutil.TempDir("", "arth")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := rand.New(rand.NewSource(1))
+	var sb strings.Builder
+	for i := 0; i < 2000000; i++ {
+		sb.WriteString(strconv.Itoa(r.Intn(1000000)))
+		sb.WriteByte('\n')
+	}
+	fn := filepath.Join(dir, "bigdata.txt")
+	if err := ioutil.WriteFile(fn, []byte(sb.String()), 0644); err != nil {
+		b.Fatal(err)
+	}
+
+	defer func(n int64) { chunkSize = n }(chunkSize)
+	chunkSize = 1 << 20
+	opts := options.Options{
+		MedianFlag:     true,
+		Percentiles:    options.Percentiles{95},
+		InputDelimiter: "\t",
+	}
+	conf := newConfig(opts, options.SeparatableFilePath{FieldIndex: 1})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		as, err := accumulateFile(fn, opts, conf, workers)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := newOutValues(as, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAccumulateFileSequential(b *testing.B) { benchmarkAccumulateFile(b, 1) }
+func BenchmarkAccumulateFileParallel(b *testing.B) {
+	benchmarkAccumulateFile(b, runtime.NumCPU())
+}
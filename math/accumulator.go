@@ -0,0 +1,146 @@
+package math
+
+import (
+	"errors"
+	"math"
+)
+
+// Accumulator は値を1件ずつ受け取り、件数、最小値、最大値、合計値、平均値、分散を
+// 逐次計算する。
+// 分散(母分散)はWelfordのアルゴリズムで算出するため、データを保持しなくても計算できる。
+type Accumulator struct {
+	// Count は集計したデータ数です。
+	Count int
+	// Min は最小値です。
+	Min float64
+	// Max は最大値です。
+	Max float64
+	// Sum は合計値です。
+	Sum float64
+	// NeedValues は集計したデータをValuesに保持するか否かです。
+	NeedValues bool
+	// Values は集計したデータです。NeedValuesがtrueのときのみ保持する。
+	Values []float64
+	// Sketch は中央値、パーセンタイル値を近似するスケッチです。
+	// NewSketchAccumulatorで生成したときのみ保持する。
+	Sketch *TDigest
+
+	// Welfordのアルゴリズムで使う逐次平均と偏差平方和
+	mean float64
+	m2   float64
+}
+
+// NewAccumulator はAccumulatorを生成する。
+// needValuesがtrueのときは中央値などの算出用に集計したデータを保持する。
+func NewAccumulator(needValues bool) *Accumulator {
+	return &Accumulator{NeedValues: needValues}
+}
+
+// NewSketchAccumulator は中央値、パーセンタイル値をTDigestで近似するAccumulatorを生成する。
+// データを保持しないため、データ数によらず一定のメモリで集計できる。
+// compressionが0以下のときはDefaultCompressionを使う。
+func NewSketchAccumulator(compression float64) *Accumulator {
+	return &Accumulator{Sketch: NewTDigest(compression)}
+}
+
+// Add は値を1件集計する。
+// 最小値、最大値は最初に追加した値を初期値にするため、
+// 負数のみのデータでも正しく算出できる。
+func (a *Accumulator) Add(n float64) {
+	// 最初の値で初期化
+	if a.Count == 0 {
+		a.Min = n
+		a.Max = n
+	}
+	a.Min = math.Min(n, a.Min)
+	a.Max = math.Max(n, a.Max)
+	a.Sum += n
+	if a.NeedValues {
+		a.Values = append(a.Values, n)
+	}
+	if a.Sketch != nil {
+		a.Sketch.Add(n)
+	}
+	a.Count++
+
+	// 大きな値同士の差でオーバーフローしにくいように、
+	// 平均の更新はそれぞれをデータ数で割ってから差を取る
+	c := float64(a.Count)
+	d := n - a.mean
+	a.mean += n/c - a.mean/c
+	a.m2 += d * (n - a.mean)
+}
+
+// Average は平均値を返す。データがないときは0を返す。
+func (a *Accumulator) Average() float64 {
+	if a.Count == 0 {
+		return 0.0
+	}
+	avg := a.Sum / float64(a.Count)
+	// 合計値がオーバーフローしても、入力に無限大がなければ逐次平均を使う
+	if math.IsInf(a.Sum, 0) && !math.IsInf(a.Min, 0) && !math.IsInf(a.Max, 0) {
+		avg = a.mean
+	}
+	return avg
+}
+
+// Variance は母分散を返す。データがないときは0を返す。
+func (a *Accumulator) Variance() float64 {
+	if a.Count == 0 {
+		return 0.0
+	}
+	return a.m2 / float64(a.Count)
+}
+
+// Merge は別のAccumulatorの集計結果を併合する。引数のAccumulatorは変更しない。
+// 分散は並列アルゴリズム(Chanらの方法)で併合するため、すべての値を1つずつ
+// Addした場合と同じ結果になる(浮動小数点の誤差を除く)。
+// 中央値、パーセンタイル値の算出に使うデータ、スケッチは次のように併合する。
+// レシーバがスケッチを持つときは、bのスケッチ、あるいはデータをスケッチに追加する。
+// レシーバがデータを保持し、bがスケッチのみを持つときは、レシーバのデータから
+// スケッチを生成して近似に切り替える。
+// レシーバがデータもスケッチも持たないときは、bのデータ、スケッチは併合しない。
+// レシーバがデータかスケッチを持ち、bがどちらも持たないときはエラーを返し、併合しない。
+func (a *Accumulator) Merge(b *Accumulator) error {
+	if b.Count == 0 {
+		return nil
+	}
+	if (a.NeedValues || a.Sketch != nil) && !b.NeedValues && b.Sketch == nil {
+		return errors.New("cannot merge an accumulator without values or a sketch for median and percentiles.")
+	}
+	if a.Count == 0 {
+		a.Min = b.Min
+		a.Max = b.Max
+	}
+	a.Min = math.Min(a.Min, b.Min)
+	a.Max = math.Max(a.Max, b.Max)
+	a.Sum += b.Sum
+	switch {
+	case a.Sketch != nil && b.Sketch != nil:
+		a.Sketch.Merge(b.Sketch)
+	case a.Sketch != nil:
+		for _, n := range b.Values {
+			a.Sketch.Add(n)
+		}
+	case a.NeedValues && b.NeedValues:
+		a.Values = append(a.Values, b.Values...)
+	case a.NeedValues:
+		a.Sketch = NewTDigest(b.Sketch.Compression)
+		for _, n := range a.Values {
+			a.Sketch.Add(n)
+		}
+		a.Sketch.Merge(b.Sketch)
+		a.NeedValues = false
+		a.Values = nil
+	}
+
+	// 大きな値同士でもオーバーフローしにくいように、データ数の比で平均を更新する
+	na := float64(a.Count)
+	nb := float64(b.Count)
+	n := na + nb
+	d := b.mean - a.mean
+	a.mean = a.mean*(na/n) + b.mean*(nb/n)
+	a.m2 += b.m2 + d*d*(na/n)*nb
+	a.Count += b.Count
+	return nil
+}
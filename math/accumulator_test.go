@@ -0,0 +1,188 @@
+package math
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type TestAccumulatorData struct {
+	needValues bool
+	in         []float64
+	outCount   int
+	outMin     float64
+	outMax     float64
+	outSum     float64
+	outAvg     float64
+	outVar     float64
+	outValues  []float64
+}
+
+func TestAccumulator(t *testing.T) {
+	tds := []TestAccumulatorData{
+		TestAccumulatorData{ // データを保持しない
+			in:       []float64{1, 2, 3, 4, 5},
+			outCount: 5,
+			outMin:   1,
+			outMax:   5,
+			outSum:   15,
+			outAvg:   3,
+			outVar:   2,
+		},
+		TestAccumulatorData{ // データを保持する
+			needValues: true,
+			in:         []float64{3, 1, 2},
+			outCount:   3,
+			outMin:     1,
+			outMax:     3,
+			outSum:     6,
+			outAvg:     2,
+			outVar:     2.0 / 3.0,
+			outValues:  []float64{3, 1, 2},
+		},
+		TestAccumulatorData{ // 負数のみ
+			in:       []float64{-3, -1, -2},
+			outCount: 3,
+			outMin:   -3,
+			outMax:   -1,
+			outSum:   -6,
+			outAvg:   -2,
+			outVar:   2.0 / 3.0,
+		},
+		TestAccumulatorData{ // データなし
+			needValues: true,
+			in:         []float64{},
+		},
+	}
+	for _, v := range tds {
+		a := NewAccumulator(v.needValues)
+		for _, n := range v.in {
+			a.Add(n)
+		}
+		assert.Equal(t, v.outCount, a.Count)
+		assert.Equal(t, v.outMin, a.Min)
+		assert.Equal(t, v.outMax, a.Max)
+		assert.Equal(t, v.outSum, a.Sum)
+		assert.Equal(t, v.outAvg, a.Average())
+		assert.InDelta(t, v.outVar, a.Variance(), 1e-9)
+		assert.Equal(t, v.outValues, a.Values)
+	}
+}
+
+func TestSketchAccumulator(t *testing.T) {
+	a := NewSketchAccumulator(0)
+	for _, n := range []float64{5, 1, 3, 2, 4} {
+		a.Add(n)
+	}
+	assert.Equal(t, 5, a.Count)
+	assert.Equal(t, 15.0, a.Sum)
+	assert.Equal(t, 2.0, a.Variance())
+	// データは保持しない
+	assert.Nil(t, a.Values)
+	assert.Equal(t, 3.0, a.Sketch.Quantile(50))
+}
+
+func TestAccumulatorMerge(t *testing.T) {
+	ins := [][]float64{
+		{3, 1, 2},
+		{},
+		{-5, 10},
+		{1e15, 1e15 + 1},
+	}
+	all := NewAccumulator(true)
+	merged := NewAccumulator(true)
+	for _, in := range ins {
+		a := NewAccumulator(true)
+		for _, n := range in {
+			a.Add(n)
+			all.Add(n)
+		}
+		assert.NoError(t, merged.Merge(a))
+		// 引数は変更しない
+		assert.Equal(t, len(in), a.Count)
+	}
+	assert.Equal(t, all.Count, merged.Count)
+	assert.Equal(t, all.Min, merged.Min)
+	assert.Equal(t, all.Max, merged.Max)
+	assert.Equal(t, all.Sum, merged.Sum)
+	assert.Equal(t, all.Values, merged.Values)
+	assert.InDelta(t, all.Average(), merged.Average(), 1e-3)
+	assert.InDelta(t, 1, merged.Variance()/all.Variance(), 1e-9)
+
+	// 空のAccumulatorへの併合は最小値、最大値も引き継ぐ
+	neg := NewAccumulator(false)
+	neg.Add(-3)
+	neg.Add(-1)
+	a := NewAccumulator(false)
+	assert.NoError(t, a.Merge(neg))
+	assert.Equal(t, -3.0, a.Min)
+	assert.Equal(t, -1.0, a.Max)
+	assert.Equal(t, 1.0, a.Variance())
+	assert.Nil(t, a.Values)
+
+	// スケッチの併合
+	s1 := NewSketchAccumulator(0)
+	s2 := NewSketchAccumulator(0)
+	for i := 1; i <= 100; i++ {
+		if i%2 == 0 {
+			s1.Add(float64(i))
+		} else {
+			s2.Add(float64(i))
+		}
+	}
+	assert.NoError(t, s1.Merge(s2))
+	assert.Equal(t, 100, s1.Count)
+	assert.Equal(t, 100.0, s1.Sketch.Count())
+	assert.InDelta(t, 50.5, s1.Sketch.Quantile(50), 1)
+}
+
+func TestAccumulatorMergeMixed(t *testing.T) {
+	newValues := func(ns ...float64) *Accumulator {
+		a := NewAccumulator(true)
+		for _, n := range ns {
+			a.Add(n)
+		}
+		return a
+	}
+	newSketch := func(ns ...float64) *Accumulator {
+		a := NewSketchAccumulator(0)
+		for _, n := range ns {
+			a.Add(n)
+		}
+		return a
+	}
+
+	// スケッチにデータを追加する
+	s := newSketch(1, 2)
+	assert.NoError(t, s.Merge(newValues(3, 4, 5)))
+	assert.Equal(t, 5, s.Count)
+	assert.Equal(t, 5.0, s.Sketch.Count())
+	assert.Equal(t, 3.0, s.Sketch.Quantile(50))
+
+	// データを保持する側はスケッチに切り替える
+	v := newValues(1, 2)
+	assert.NoError(t, v.Merge(newSketch(3, 4, 5)))
+	assert.False(t, v.NeedValues)
+	assert.Nil(t, v.Values)
+	assert.Equal(t, 5.0, v.Sketch.Count())
+	assert.Equal(t, 3.0, v.Sketch.Quantile(50))
+
+	// データもスケッチも持たない側は併合しない
+	n := NewAccumulator(false)
+	assert.NoError(t, n.Merge(newSketch(1, 2)))
+	assert.NoError(t, n.Merge(newValues(3)))
+	assert.Equal(t, 3, n.Count)
+	assert.Nil(t, n.Sketch)
+	assert.Nil(t, n.Values)
+
+	// データもスケッチも持たない集計結果は、中央値などを算出する側に併合できない
+	none := NewAccumulator(false)
+	none.Add(10)
+	for _, a := range []*Accumulator{newValues(1, 2), newSketch(1, 2)} {
+		assert.Error(t, a.Merge(none))
+		assert.Equal(t, 2, a.Count)
+		assert.Equal(t, 2.0, a.Max)
+	}
+	// 空の集計結果は併合できる
+	assert.NoError(t, v.Merge(NewAccumulator(false)))
+}
@@ -0,0 +1,217 @@
+package math
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	// accumulatorVersion はAccumulatorのバイナリ形式のバージョンです。
+	accumulatorVersion = 1
+	// tdigestVersion はTDigestのバイナリ形式のバージョンです。
+	tdigestVersion = 1
+)
+
+// MarshalBinary は集計結果をバイナリ形式にする。
+// 件数、最小値、最大値、合計値、分散の計算に使う逐次平均と偏差平方和、スケッチを含める。
+// 集計したデータは含めず、データを保持するときは集計したデータから生成したスケッチを含める。
+// そのため復元したAccumulatorの中央値、パーセンタイル値はスケッチから近似する。
+func (a *Accumulator) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte(accumulatorVersion)
+	putUvarint(&buf, uint64(a.Count))
+	for _, v := range []float64{a.Min, a.Max, a.Sum, a.mean, a.m2} {
+		putFloat(&buf, v)
+	}
+
+	sk := a.Sketch
+	if sk == nil && a.NeedValues {
+		sk = NewTDigest(DefaultCompression)
+		for _, v := range a.Values {
+			sk.Add(v)
+		}
+	}
+	if sk == nil {
+		buf.WriteByte(0)
+		return buf.Bytes(), nil
+	}
+	b, err := sk.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	buf.WriteByte(1)
+	putBytes(&buf, b)
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary はバイナリ形式の集計結果を復元する。
+// 復元したAccumulatorはデータを保持せず、スケッチがあればスケッチを持つ。
+func (a *Accumulator) UnmarshalBinary(b []byte) error {
+	d := decoder{r: bytes.NewReader(b)}
+	if v := d.byte(); d.err == nil && v != accumulatorVersion {
+		msg := fmt.Sprintf("unsupported accumulator version. version=%d", v)
+		return errors.New(msg)
+	}
+
+	x := Accumulator{Count: int(d.uvarint())}
+	x.Min = d.float()
+	x.Max = d.float()
+	x.Sum = d.float()
+	x.mean = d.float()
+	x.m2 = d.float()
+	if d.byte() == 1 {
+		sk := &TDigest{}
+		if err := sk.UnmarshalBinary(d.bytes()); err != nil {
+			return err
+		}
+		x.Sketch = sk
+	}
+	if err := d.end(); err != nil {
+		return err
+	}
+	*a = x
+	return nil
+}
+
+// MarshalBinary はスケッチをバイナリ形式にする。
+func (t *TDigest) MarshalBinary() ([]byte, error) {
+	cs := t.Centroids()
+	var buf bytes.Buffer
+	buf.WriteByte(tdigestVersion)
+	for _, v := range []float64{t.Compression, t.min, t.max, t.negInf, t.posInf} {
+		putFloat(&buf, v)
+	}
+	putUvarint(&buf, uint64(len(cs)))
+	for _, c := range cs {
+		putFloat(&buf, c.Mean)
+		putFloat(&buf, c.Weight)
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary はバイナリ形式のスケッチを復元する。
+func (t *TDigest) UnmarshalBinary(b []byte) error {
+	d := decoder{r: bytes.NewReader(b)}
+	if v := d.byte(); d.err == nil && v != tdigestVersion {
+		msg := fmt.Sprintf("unsupported t-digest version. version=%d", v)
+		return errors.New(msg)
+	}
+
+	x := TDigest{Compression: d.float()}
+	x.min = d.float()
+	x.max = d.float()
+	x.negInf = d.float()
+	x.posInf = d.float()
+	n := d.uvarint()
+	// 壊れた入力で巨大な領域を確保しないように、残りのバイト数で上限を判定する
+	if uint64(d.r.Len())/16 < n {
+		return errors.New("illegal t-digest. centroids are truncated.")
+	}
+	x.centroids = make([]Centroid, n)
+	for i := range x.centroids {
+		c := Centroid{Mean: d.float(), Weight: d.float()}
+		if d.err == nil && (math.IsNaN(c.Mean) || math.IsInf(c.Mean, 0) || !(0 < c.Weight)) {
+			return errors.New("illegal t-digest. centroid is not finite.")
+		}
+		x.centroids[i] = c
+		x.count += c.Weight
+	}
+	if err := d.end(); err != nil {
+		return err
+	}
+	if x.Compression <= 0 {
+		x.Compression = DefaultCompression
+	}
+	*t = x
+	return nil
+}
+
+func putUvarint(buf *bytes.Buffer, n uint64) {
+	var b [binary.MaxVarintLen64]byte
+	buf.Write(b[:binary.PutUvarint(b[:], n)])
+}
+
+func putFloat(buf *bytes.Buffer, n float64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], math.Float64bits(n))
+	buf.Write(b[:])
+}
+
+func putBytes(buf *bytes.Buffer, b []byte) {
+	putUvarint(buf, uint64(len(b)))
+	buf.Write(b)
+}
+
+// decoder はバイナリ形式を先頭から読み込む。
+// 最初のエラーを保持し、以降の読み込みはゼロ値を返す。
+type decoder struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (d *decoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	b, err := d.r.ReadByte()
+	d.fail(err)
+	return b
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	n, err := binary.ReadUvarint(d.r)
+	d.fail(err)
+	return n
+}
+
+func (d *decoder) float() float64 {
+	if d.err != nil {
+		return 0
+	}
+	var b [8]byte
+	if _, err := io.ReadFull(d.r, b[:]); err != nil {
+		d.fail(err)
+		return 0
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(b[:]))
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.uvarint()
+	if d.err != nil {
+		return nil
+	}
+	if uint64(d.r.Len()) < n {
+		d.fail(errors.New("unexpected end of data."))
+		return nil
+	}
+	b := make([]byte, n)
+	d.r.Read(b)
+	return b
+}
+
+// end は読み込みのエラー、読み残しがあればエラーを返す。
+func (d *decoder) end() error {
+	if d.err != nil {
+		msg := fmt.Sprintf("illegal binary data. %v", d.err)
+		return errors.New(msg)
+	}
+	if 0 < d.r.Len() {
+		msg := fmt.Sprintf("illegal binary data. trailing bytes=%d", d.r.Len())
+		return errors.New(msg)
+	}
+	return nil
+}
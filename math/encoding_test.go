@@ -0,0 +1,95 @@
+package math
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccumulatorMarshalBinary(t *testing.T) {
+	// データを保持するAccumulatorはスケッチを生成して含める
+	a := NewAccumulator(true)
+	for i := 1; i <= 1000; i++ {
+		a.Add(float64(i))
+	}
+	b, err := a.MarshalBinary()
+	assert.NoError(t, err)
+
+	var got Accumulator
+	assert.NoError(t, got.UnmarshalBinary(b))
+	assert.Equal(t, 1000, got.Count)
+	assert.Equal(t, 1.0, got.Min)
+	assert.Equal(t, 1000.0, got.Max)
+	assert.Equal(t, 500500.0, got.Sum)
+	assert.Equal(t, a.Average(), got.Average())
+	assert.Equal(t, a.Variance(), got.Variance())
+	assert.Nil(t, got.Values)
+	assert.InDelta(t, 500, got.Sketch.Quantile(50), 2)
+	assert.Equal(t, 1000.0, got.Sketch.Quantile(100))
+
+	// 復元したAccumulator同士を併合できる
+	got.Merge(&got)
+	assert.Equal(t, 2000, got.Count)
+	assert.Equal(t, 2000.0, got.Sketch.Count())
+
+	// データを保持するAccumulatorは、空でもスケッチを含める
+	b, err = NewAccumulator(true).MarshalBinary()
+	assert.NoError(t, err)
+	got = Accumulator{}
+	assert.NoError(t, got.UnmarshalBinary(b))
+	assert.Equal(t, 0, got.Count)
+	assert.NotNil(t, got.Sketch)
+
+	// スケッチも集計したデータもなし
+	a = NewAccumulator(false)
+	a.Add(-1)
+	a.Add(math.Inf(1))
+	b, err = a.MarshalBinary()
+	assert.NoError(t, err)
+	got = Accumulator{}
+	assert.NoError(t, got.UnmarshalBinary(b))
+	assert.Nil(t, got.Sketch)
+	assert.Equal(t, 2, got.Count)
+	assert.Equal(t, math.Inf(1), got.Max)
+}
+
+func TestTDigestMarshalBinary(t *testing.T) {
+	td := NewTDigest(100)
+	for i := 0; i < 10000; i++ {
+		td.Add(float64(i % 997))
+	}
+	td.Add(math.Inf(-1))
+	b, err := td.MarshalBinary()
+	assert.NoError(t, err)
+
+	var got TDigest
+	assert.NoError(t, got.UnmarshalBinary(b))
+	assert.Equal(t, 100.0, got.Compression)
+	assert.Equal(t, td.Count(), got.Count())
+	for _, p := range []float64{0, 1, 50, 99, 100} {
+		assert.Equal(t, td.Quantile(p), got.Quantile(p), p)
+	}
+}
+
+func TestUnmarshalBinaryError(t *testing.T) {
+	a := NewSketchAccumulator(0)
+	a.Add(1)
+	a.Add(2)
+	b, err := a.MarshalBinary()
+	assert.NoError(t, err)
+
+	var got Accumulator
+	// 途中で切れたデータ
+	for i := 0; i < len(b); i++ {
+		assert.Error(t, got.UnmarshalBinary(b[:i]), i)
+	}
+	// 読み残し
+	assert.Error(t, got.UnmarshalBinary(append(b, 0)))
+	// 未対応のバージョン
+	v := append([]byte{}, b...)
+	v[0] = 99
+	assert.EqualError(t, got.UnmarshalBinary(v), "unsupported accumulator version. version=99")
+	// 失敗したときは変更しない
+	assert.Equal(t, Accumulator{}, got)
+}
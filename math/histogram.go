@@ -0,0 +1,138 @@
+package math
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// Bucket はヒストグラムの1つの階級です。
+// Lower以上Upper未満の値の件数を持つ。最後の階級のみUpper以下の値を数える。
+type Bucket struct {
+	Lower float64
+	Upper float64
+	Count int
+}
+
+// Histogram は昇順の境界値の一覧から、階級ごとの値の件数を数える。
+// 境界値がn個のとき、階級はn-1個になる。境界値の範囲外の有限の値、NaNは数えない。
+// 無限大は範囲外でも両端の階級に数えるので、LinearEdges, LogEdgesの境界値では
+// 階級の件数の合計はNaNを除くデータ数と等しくなる。
+// データをソートする必要はない。
+func Histogram(ns []float64, edges []float64) []Bucket {
+	if len(edges) < 2 {
+		return nil
+	}
+
+	bs := make([]Bucket, len(edges)-1)
+	for i := range bs {
+		bs[i].Lower = edges[i]
+		bs[i].Upper = edges[i+1]
+	}
+
+	last := len(edges) - 1
+	for _, n := range ns {
+		switch {
+		case math.IsInf(n, -1):
+			bs[0].Count++
+			continue
+		case math.IsInf(n, 1):
+			bs[last-1].Count++
+			continue
+		case n < edges[0] || edges[last] < n || math.IsNaN(n):
+			continue
+		}
+		// 境界値と等しい値は上の階級に数える。最後の境界値のみ最後の階級に数える
+		i := sort.SearchFloat64s(edges, n)
+		if i == last || edges[i] != n {
+			i--
+		}
+		bs[i].Count++
+	}
+	return bs
+}
+
+// LinearEdges は最小値から最大値までをn個の等幅の階級に分ける境界値を返す。
+// 無限大は境界値の算出に使わず、Histogramで両端の階級に数える。
+// 有限の値がないときは無限大の最小値から最大値までの1つの階級にする。値がないときはnilを返す。
+// 最小値と最大値が同じときは階級を1つにする。
+func LinearEdges(ns []float64, n int) []float64 {
+	min, max, ok := finiteMinMax(ns, math.Inf(-1))
+	if !ok {
+		return infMinMax(ns)
+	}
+	if min == max || n < 1 {
+		return []float64{min, max}
+	}
+
+	edges := make([]float64, n+1)
+	w := (max - min) / float64(n)
+	for i := range edges {
+		edges[i] = min + w*float64(i)
+	}
+	// 誤差で最大値が範囲外にならないように末尾は最大値にする
+	edges[n] = max
+	return edges
+}
+
+// LogEdges は正の値の最小値から最大値までを、対数で等幅なn個の階級に分ける境界値を返す。
+// 0以下の値があるときは、先頭に-Infから正の最小値までの階級を追加する。
+// 正の値がないときはエラーを返す。
+func LogEdges(ns []float64, n int) ([]float64, error) {
+	min, max, ok := finiteMinMax(ns, 0)
+	if !ok {
+		return nil, errors.New("logarithmic bins need positive values.")
+	}
+
+	var edges []float64
+	for _, v := range ns {
+		if v <= 0 {
+			edges = append(edges, math.Inf(-1))
+			break
+		}
+	}
+	if min == max || n < 1 {
+		return append(edges, min, max), nil
+	}
+
+	lmin := math.Log10(min)
+	w := (math.Log10(max) - lmin) / float64(n)
+	for i := 0; i < n; i++ {
+		edges = append(edges, math.Pow(10, lmin+w*float64(i)))
+	}
+	// 誤差で最小値、最大値が範囲外にならないように両端は実際の値にする
+	edges[len(edges)-n] = min
+	edges = append(edges, max)
+	return edges, nil
+}
+
+// infMinMax は無限大の値の最小値、最大値を境界値として返す。無限大がないときはnilを返す。
+func infMinMax(ns []float64) []float64 {
+	var edges []float64
+	for _, v := range ns {
+		if !math.IsInf(v, 0) {
+			continue
+		}
+		if edges == nil {
+			edges = []float64{v, v}
+		}
+		edges[0] = math.Min(edges[0], v)
+		edges[1] = math.Max(edges[1], v)
+	}
+	return edges
+}
+
+// finiteMinMax は下限より大きい有限の値の最小値、最大値を返す。
+func finiteMinMax(ns []float64, lower float64) (min, max float64, ok bool) {
+	for _, v := range ns {
+		if math.IsInf(v, 0) || math.IsNaN(v) || v <= lower {
+			continue
+		}
+		if !ok {
+			min, max, ok = v, v, true
+		}
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+	}
+	return
+}
@@ -0,0 +1,120 @@
+package math
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type TestHistogramData struct {
+	desc  string
+	ns    []float64
+	edges []float64
+	out   []Bucket
+}
+
+func TestHistogram(t *testing.T) {
+	tds := []TestHistogramData{
+		TestHistogramData{
+			desc:  "境界値と等しい値は上の階級、最後の境界値は最後の階級",
+			ns:    []float64{1, 2, 3, 4, 5, 5, 10},
+			edges: []float64{1, 5, 10},
+			out: []Bucket{
+				Bucket{Lower: 1, Upper: 5, Count: 4},
+				Bucket{Lower: 5, Upper: 10, Count: 3},
+			},
+		},
+		TestHistogramData{
+			desc:  "範囲外の有限の値とNaNは数えない",
+			ns:    []float64{-1, 0, 0.5, 2, 3, math.NaN()},
+			edges: []float64{0, 1, 2},
+			out: []Bucket{
+				Bucket{Lower: 0, Upper: 1, Count: 2},
+				Bucket{Lower: 1, Upper: 2, Count: 1},
+			},
+		},
+		TestHistogramData{
+			desc:  "無限大は両端の階級に数える",
+			ns:    []float64{math.Inf(-1), 0, 0.5, 2, math.Inf(1), math.Inf(1)},
+			edges: []float64{0, 1, 2},
+			out: []Bucket{
+				Bucket{Lower: 0, Upper: 1, Count: 3},
+				Bucket{Lower: 1, Upper: 2, Count: 3},
+			},
+		},
+		TestHistogramData{
+			desc:  "無限大の境界値",
+			ns:    []float64{math.Inf(-1), -5, 10, 50, math.Inf(1)},
+			edges: []float64{math.Inf(-1), 10, math.Inf(1)},
+			out: []Bucket{
+				Bucket{Lower: math.Inf(-1), Upper: 10, Count: 2},
+				Bucket{Lower: 10, Upper: math.Inf(1), Count: 3},
+			},
+		},
+		TestHistogramData{
+			desc:  "最小値と最大値が同じ",
+			ns:    []float64{3, 3},
+			edges: []float64{3, 3},
+			out: []Bucket{
+				Bucket{Lower: 3, Upper: 3, Count: 2},
+			},
+		},
+		TestHistogramData{
+			desc:  "境界値が足りない",
+			ns:    []float64{1},
+			edges: []float64{1},
+			out:   nil,
+		},
+	}
+	for _, v := range tds {
+		assert.Equal(t, v.out, Histogram(v.ns, v.edges), v.desc)
+	}
+}
+
+func TestLinearEdges(t *testing.T) {
+	assert.Equal(t, []float64{0, 2.5, 5, 7.5, 10}, LinearEdges([]float64{10, 0, 3, 7}, 4))
+	// 無限大は使わない
+	ns := []float64{math.Inf(-1), 1, 3, math.Inf(1)}
+	assert.Equal(t, []float64{1, 2, 3}, LinearEdges(ns, 2))
+	// 無限大は両端の階級に数え、件数の合計はデータ数になる
+	assert.Equal(t, []Bucket{
+		Bucket{Lower: 1, Upper: 2, Count: 2},
+		Bucket{Lower: 2, Upper: 3, Count: 2},
+	}, Histogram(ns, LinearEdges(ns, 2)))
+	assert.Equal(t, []float64{5, 5}, LinearEdges([]float64{5, 5}, 10))
+	// 有限の値がなければ無限大の範囲の1つの階級
+	assert.Equal(t, []float64{math.Inf(1), math.Inf(1)}, LinearEdges([]float64{math.Inf(1)}, 10))
+	assert.Equal(t, []float64{math.Inf(-1), math.Inf(1)}, LinearEdges([]float64{math.Inf(1), math.Inf(-1)}, 10))
+	assert.Equal(t, []Bucket{
+		Bucket{Lower: math.Inf(-1), Upper: math.Inf(1), Count: 3},
+	}, Histogram([]float64{math.Inf(1), math.Inf(-1), math.Inf(1)}, []float64{math.Inf(-1), math.Inf(1)}))
+	assert.Nil(t, LinearEdges([]float64{math.NaN()}, 10))
+	assert.Nil(t, LinearEdges(nil, 10))
+}
+
+func TestLogEdges(t *testing.T) {
+	es, err := LogEdges([]float64{1, 50, 1000}, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{1, 10, 100, 1000}, es)
+
+	// 0以下の値は先頭の階級に数える
+	es, err = LogEdges([]float64{0, -3, 1, 100}, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{math.Inf(-1), 1, 10, 100}, es)
+	assert.Equal(t, []Bucket{
+		Bucket{Lower: math.Inf(-1), Upper: 1, Count: 2},
+		Bucket{Lower: 1, Upper: 10, Count: 1},
+		Bucket{Lower: 10, Upper: 100, Count: 1},
+	}, Histogram([]float64{0, -3, 1, 100}, es))
+
+	// 正の無限大は最後の階級に数える
+	assert.Equal(t, []Bucket{
+		Bucket{Lower: math.Inf(-1), Upper: 1, Count: 2},
+		Bucket{Lower: 1, Upper: 10, Count: 1},
+		Bucket{Lower: 10, Upper: 100, Count: 2},
+	}, Histogram([]float64{math.Inf(-1), 0, 1, 100, math.Inf(1)}, es))
+
+	_, err = LogEdges([]float64{0, -1}, 10)
+	assert.Error(t, err)
+}
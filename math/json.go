@@ -0,0 +1,155 @@
+package math
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// maxJSONLineSize はJSONの1行の最大のバイト数です。
+// 1行に1つのオブジェクトを書くので、テキストの入力より長い行を読み込めるようにする。
+const maxJSONLineSize = 64 << 20
+
+// scanJSON は入力を1行1つのJSONオブジェクト(NDJSON)として読み込み、
+// JSONFieldのパスの値を集計する。
+// 集計キーの指定があるときは、GroupFieldNameをパスとして値を取り出す。
+// 時間窓の指定があるときは、TimeFieldNameをパスとして時刻を取り出す。
+// 不正なJSON、パスの値がない行は不正な値として警告を出力し、後続の処理を継続する。
+// 1行がmaxJSONLineSizeを超えるときはエラーを返す。
+func (s *valueScanner) scanJSON(r io.Reader) error {
+	path := splitJSONPath(s.conf.JSONField)
+	var groupPath []string
+	if s.conf.GroupFieldName != "" {
+		groupPath = splitJSONPath(s.conf.GroupFieldName)
+	}
+	var timePath []string
+	if 0 < s.conf.Window {
+		timePath = splitJSONPath(s.conf.TimeFieldName)
+	}
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), maxJSONLineSize)
+	for sc.Scan() {
+		// 指定行数まで無視
+		if s.ignoredCounter < s.conf.IgnoreHeaderRows {
+			s.ignoredCounter++
+			continue
+		}
+
+		line := sc.Text()
+		obj := parseJSONLine(sc.Bytes())
+		if obj.err != nil {
+			// 不正なJSONは、集計キーや値がない行と区別できるように解析のエラーを出力する
+			msg := fmt.Sprintf("warn: illegal JSON. %v value=%v", obj.err, line)
+			fmt.Fprintln(os.Stderr, msg)
+			continue
+		}
+		var key string
+		if groupPath != nil {
+			raw, err := obj.value(groupPath)
+			if err != nil {
+				// 集計キーがない行は無視して後続の処理を継続
+				msg := fmt.Sprintf("warn: illegal key. value=%v", line)
+				fmt.Fprintln(os.Stderr, msg)
+				continue
+			}
+			key = jsonText(raw)
+		}
+		if timePath != nil {
+			raw, err := obj.value(timePath)
+			if !s.setWindow(jsonText(raw), err == nil, line) {
+				continue
+			}
+		}
+
+		raw, err := obj.value(path)
+		if err != nil {
+			msg := fmt.Sprintf("warn: illegal value. value=%v", line)
+			fmt.Fprintln(os.Stderr, msg)
+			continue
+		}
+		if n, ok := s.parse(jsonText(raw)); ok {
+			s.f(key, 0, n)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		if err == bufio.ErrTooLong {
+			msg := fmt.Sprintf("JSON line is too long. max=%d bytes", maxJSONLineSize)
+			return errors.New(msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// splitJSONPath はドット区切りのパスをキーの一覧に分割する。
+func splitJSONPath(p string) []string {
+	return strings.Split(p, ".")
+}
+
+// jsonLine は1行のJSONオブジェクトです。
+// 値は未解析のまま保持し、必要な階層のみ解析するため、オブジェクト全体を解析するより速い。
+// 行は1回だけ解析し、入れ子のオブジェクトも最初に参照したときに1回だけ解析する。
+type jsonLine struct {
+	obj map[string]json.RawMessage
+	err error
+	// nested はドット区切りのパスごとの解析済みの入れ子のオブジェクトです。
+	nested map[string]map[string]json.RawMessage
+}
+
+// parseJSONLine は1行のJSONオブジェクトを解析する。
+// 不正なJSONのときは、値を取り出すときにエラーを返す。
+func parseJSONLine(b []byte) *jsonLine {
+	l := &jsonLine{}
+	l.err = json.Unmarshal(b, &l.obj)
+	return l
+}
+
+// value はパスの値を未解析のまま返す。
+// 不正なJSONのとき、途中の値がオブジェクトでないとき、キーがないときはエラーを返す。
+func (l *jsonLine) value(path []string) (json.RawMessage, error) {
+	if l.err != nil {
+		return nil, l.err
+	}
+	obj := l.obj
+	last := len(path) - 1
+	for i, k := range path {
+		v, ok := obj[k]
+		if !ok {
+			msg := fmt.Sprintf("key is not found. key=%s", k)
+			return nil, errors.New(msg)
+		}
+		if i == last {
+			return v, nil
+		}
+
+		p := strings.Join(path[:i+1], ".")
+		next, ok := l.nested[p]
+		if !ok {
+			if err := json.Unmarshal(v, &next); err != nil {
+				return nil, err
+			}
+			if l.nested == nil {
+				l.nested = make(map[string]map[string]json.RawMessage)
+			}
+			l.nested[p] = next
+		}
+		obj = next
+	}
+	return nil, errors.New("JSON path is empty.")
+}
+
+// jsonText はJSONの値を文字列に変換する。
+// 文字列はクォートを外し、それ以外(数値など)はJSONの表記のまま返す。
+func jsonText(raw json.RawMessage) string {
+	t := strings.TrimSpace(string(raw))
+	var s string
+	if strings.HasPrefix(t, `"`) && json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	return t
+}
@@ -0,0 +1,130 @@
+package math
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var jsonInput = strings.Join([]string{
+	`{"path":"/a","latency_ms":12.5,"timing":{"total":20}}`,
+	`{"path":"/b","latency_ms":"30","timing":{"total":45}}`,
+	`not json`,
+	`{"path":"/a","timing":{"total":10}}`,
+	`{"path":"/a","latency_ms":null,"timing":{"total":5}}`,
+	`{"path":1,"latency_ms":7.5,"timing":1}`,
+	``,
+}, "\n")
+
+type TestJSONFieldData struct {
+	desc   string
+	field  string
+	ignore int
+	cnt    int
+	sum    float64
+}
+
+func TestAccumulateJSON(t *testing.T) {
+	tds := []TestJSONFieldData{
+		TestJSONFieldData{desc: "数値と数値の文字列", field: "latency_ms", cnt: 3, sum: 50},
+		TestJSONFieldData{desc: "入れ子のキー", field: "timing.total", cnt: 4, sum: 80},
+		TestJSONFieldData{desc: "行の無視", field: "timing.total", ignore: 1, cnt: 3, sum: 60},
+		TestJSONFieldData{desc: "存在しないキー", field: "timing.db", cnt: 0, sum: 0},
+	}
+	for _, v := range tds {
+		a, err := Accumulate(bytes.NewBufferString(jsonInput), MinMaxSumAvgConfig{
+			JSONField:        v.field,
+			IgnoreHeaderRows: v.ignore,
+			// JSONでは区切り文字、フィールド番号を使わない
+			Delimiter:  ",",
+			FieldIndex: 2,
+		})
+		assert.NoError(t, err, v.desc)
+		assert.Equal(t, v.cnt, a.Count, v.desc)
+		assert.Equal(t, v.sum, a.Sum, v.desc)
+	}
+}
+
+func TestGroupMinMaxSumAvgJSON(t *testing.T) {
+	keys, accs, err := GroupMinMaxSumAvg(bytes.NewBufferString(jsonInput), MinMaxSumAvgConfig{
+		JSONField:      "latency_ms",
+		GroupFieldName: "path",
+	})
+	assert.NoError(t, err)
+	// 数値の集計キーはJSONの表記のまま
+	assert.Equal(t, []string{"/a", "/b", "1"}, keys)
+	assert.Equal(t, 1, accs["/a"].Count)
+	assert.Equal(t, 12.5, accs["/a"].Sum)
+	assert.Equal(t, 30.0, accs["/b"].Sum)
+	assert.Equal(t, 7.5, accs["1"].Sum)
+}
+
+func TestJSONLineValue(t *testing.T) {
+	l := parseJSONLine([]byte(`{"a":{"b":{"c":1.5e3,"d":"y"}},"s":"x","n":null}`))
+	raw, err := l.value([]string{"a", "b", "c"})
+	assert.NoError(t, err)
+	assert.Equal(t, "1.5e3", jsonText(raw))
+
+	// 解析済みの入れ子のオブジェクトを再利用する
+	assert.Equal(t, 2, len(l.nested))
+	raw, err = l.value([]string{"a", "b", "d"})
+	assert.NoError(t, err)
+	assert.Equal(t, "y", jsonText(raw))
+	assert.Equal(t, 2, len(l.nested))
+
+	raw, err = l.value([]string{"s"})
+	assert.NoError(t, err)
+	assert.Equal(t, "x", jsonText(raw))
+
+	raw, err = l.value([]string{"n"})
+	assert.NoError(t, err)
+	assert.Equal(t, "null", jsonText(raw))
+
+	// キーがない、途中の値がオブジェクトでない、途中の値がnull、不正なJSON
+	_, err = l.value([]string{"a", "x"})
+	assert.Error(t, err)
+	_, err = l.value([]string{"s", "x"})
+	assert.Error(t, err)
+	_, err = l.value([]string{"n", "x"})
+	assert.Error(t, err)
+	_, err = parseJSONLine([]byte(`{"a":1`)).value([]string{"a"})
+	assert.Error(t, err)
+	_, err = parseJSONLine([]byte(`{"a":1} x`)).value([]string{"a"})
+	assert.Error(t, err)
+}
+
+func TestAccumulateJSONLongLine(t *testing.T) {
+	// bufio.Scannerの既定の上限(64KiB)を超える行も読み込む
+	long := `{"pad":"` + strings.Repeat("x", 100*1024) + `","latency_ms":5}`
+	in := strings.Join([]string{long, `{"latency_ms":10}`}, "\n")
+	a, err := Accumulate(bytes.NewBufferString(in), MinMaxSumAvgConfig{JSONField: "latency_ms"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, a.Count)
+	assert.Equal(t, 15.0, a.Sum)
+}
+
+func TestScanJSONWarning(t *testing.T) {
+	stderr := os.Stderr
+	r, w, err := os.Pipe()
+	assert.NoError(t, err)
+	os.Stderr = w
+	_, _, err = GroupMinMaxSumAvg(bytes.NewBufferString("{\"latency\":1\n{\"latency\":2}"), MinMaxSumAvgConfig{
+		JSONField:      "latency",
+		GroupFieldName: "path",
+	})
+	os.Stderr = stderr
+	w.Close()
+	assert.NoError(t, err)
+	b, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+
+	// 不正なJSONは集計キーがない行と区別して、解析のエラーを出力する
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	assert.Equal(t, 2, len(lines))
+	assert.True(t, strings.HasPrefix(lines[0], "warn: illegal JSON. unexpected end of JSON input"), lines[0])
+	assert.Equal(t, `warn: illegal key. value={"latency":2}`, lines[1])
+}
@@ -2,15 +2,18 @@ package math
 
 import (
 	"bufio"
+	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
 	"math"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
-// MinMaxSumAvgConfig はMinMaxSumAvg関数の設定です。
+// MinMaxSumAvgConfig はAccumulate、GroupMinMaxSumAvgなど、入力を読み込んで集計する関数の設定です。
 type MinMaxSumAvgConfig struct {
 	// NeedValues は計算途中に読み込んだデータを返却するか否かです。
 	NeedValues bool
@@ -18,55 +21,431 @@ type MinMaxSumAvgConfig struct {
 	Delimiter string
 	// FieldNum は読み込んだ行データのうち、取り出すフィールド番号です。
 	FieldIndex int
+	// FieldName は取り出すフィールドのヘッダ名です。
+	// FieldIndexが未指定で、FieldNameを指定したときは先頭行をヘッダとしてフィールド番号を解決する。
+	FieldName string
+	// Fields はFieldsMinMaxSumAvg関数で取り出す複数のフィールドです。
+	// 指定したときはFieldIndex, FieldNameより優先する。
+	Fields []Field
 	// IgnoreHeaderRows は読み込むデータの開始から無視する行数です。
 	IgnoreHeaderRows int
+	// GroupFieldIndex はGroupMinMaxSumAvg関数で集計キーにするフィールド番号です。
+	GroupFieldIndex int
+	// GroupFieldName はGroupMinMaxSumAvg関数で集計キーにするフィールドのヘッダ名です。
+	// 指定したときは先頭行をヘッダとしてフィールド番号を解決する。
+	GroupFieldName string
+	// CSV は入力をRFC 4180のCSVとして読み込むか否かです。
+	// trueのときはDelimiterの1文字を区切り文字にする。
+	CSV bool
+	// Approx は中央値、パーセンタイル値をTDigestで近似するか否かです。
+	// trueのときはデータを保持せず、NeedValuesより優先する。
+	Approx bool
+	// JSONField は入力を1行1つのJSONオブジェクトとして読み込むときの、値のパスです。
+	// timing.totalのようにドット区切りで入れ子のキーを指定する。
+	// 指定したときはGroupFieldNameも集計キーのパスとして扱い、
+	// Delimiter, FieldIndex, FieldName, Fields, GroupFieldIndexは使わない。
+	JSONField string
+	// Unit は単位付きの値を読み込むときの単位です。
+	// 指定したときは12.5msのような単位付きの値を、この単位の数値に正規化する。
+	Unit *Unit
+	// TimeFieldIndex はWindowMinMaxSumAvg関数で時刻を取り出すフィールド番号です。
+	TimeFieldIndex int
+	// TimeFieldName は時刻のフィールドのヘッダ名です。
+	// 指定したときは先頭行をヘッダとしてフィールド番号を解決する。
+	// JSONの入力では時刻のパスとして扱う。
+	TimeFieldName string
+	// TimeFormat は時刻のフィールドの形式です。
+	TimeFormat TimeFormat
+	// Window はWindowMinMaxSumAvg関数で集計する時間窓の幅です。
+	// 指定したときは時刻のフィールドから行が属する時間窓を判定する。
+	Window time.Duration
 }
 
-// MinMaxSumAvg は入力から最小値、最大値、合計値、平均値を算出する
+// newAccumulator は設定に応じたAccumulatorを生成する。
+func (c MinMaxSumAvgConfig) newAccumulator() *Accumulator {
+	if c.Approx {
+		return NewSketchAccumulator(DefaultCompression)
+	}
+	return NewAccumulator(c.NeedValues)
+}
+
+// Field はフィールド番号(1〜)、あるいはヘッダ名によるフィールド指定です。
+type Field struct {
+	Index int
+	Name  string
+}
+
+// fields は取り出すフィールドの一覧を返す。
+func (c MinMaxSumAvgConfig) fields() []Field {
+	if 0 < len(c.Fields) {
+		fs := make([]Field, len(c.Fields))
+		copy(fs, c.Fields)
+		return fs
+	}
+	return []Field{Field{Index: c.FieldIndex, Name: c.FieldName}}
+}
+
+// MinMaxSumAvg は入力から最小値、最大値、合計値、平均値、分散を算出する
+// 分散(母分散)はWelfordのアルゴリズムで1回の走査の中で算出する
+// 最小値、最大値は最初に読み込んだ有効な値を初期値にするため、
+// 負数のみのデータでも正しく算出できる
+// NaNは不正な値として扱い、集計対象にしない
 // needValuesフラグがtrueのときは入力をfloat64スライスに変換した値も返す
 // needValuesフラグをセットしなければスライスは初期値のまま返却し、
 // スライスにデータを保持しないため省メモリになる
-func MinMaxSumAvg(r io.Reader, conf MinMaxSumAvgConfig) (cnt int, min, max, sum, avg float64, ns []float64, err error) {
-	min = math.MaxFloat64 // 最初にでかい値を入れてないと判定されない
-	max = 0.0
-	sum = 0.0
-	avg = 0.0
+//
+// Deprecated: Accumulateを使う。集計結果のAccumulatorから同じ値を取り出せる。
+func MinMaxSumAvg(r io.Reader, conf MinMaxSumAvgConfig) (cnt int, min, max, sum, avg, vari float64, ns []float64, err error) {
+	a, err := Accumulate(r, conf)
+	return a.Count, a.Min, a.Max, a.Sum, a.Average(), a.Variance(), a.Values, err
+}
+
+// Accumulate は入力の1つのフィールドを集計したAccumulatorを返す。
+// 集計キー、複数フィールド、時間窓の指定は無視する。
+// NaNは不正な値として扱い、集計対象にしない。
+// NeedValuesがtrueのときは、中央値などの算出用に集計したデータもAccumulatorに保持する。
+// 値を1件ずつ集計して統計値を算出するときは、statsパッケージのAccumulatorを使う。
+func Accumulate(r io.Reader, conf MinMaxSumAvgConfig) (*Accumulator, error) {
+	a := conf.newAccumulator()
+	conf.Fields = nil
+	conf.GroupFieldIndex = 0
+	conf.GroupFieldName = ""
+	conf.Window = 0
+	_, err := scanValues(r, conf, func(_ string, _ int, n float64) {
+		a.Add(n)
+	})
+	return a, err
+}
+
+// GroupMinMaxSumAvg は入力を集計キーのフィールドの値ごとに集計する。
+// 集計キーごとにAccumulatorを1つ持ち、1回の走査で集計する。
+// 集計キーは出現順に返す。
+// 集計キーのフィールドが存在しない行は不正な値として扱い、集計対象にしない。
+func GroupMinMaxSumAvg(r io.Reader, conf MinMaxSumAvgConfig) (keys []string, accs map[string]*Accumulator, err error) {
+	accs = make(map[string]*Accumulator)
+	conf.Fields = nil
+	_, err = scanValues(r, conf, func(k string, _ int, n float64) {
+		a, ok := accs[k]
+		if !ok {
+			a = conf.newAccumulator()
+			accs[k] = a
+			keys = append(keys, k)
+		}
+		a.Add(n)
+	})
+	return
+}
+
+// FieldsMinMaxSumAvg は入力の複数のフィールドを1回の読み込みで集計する。
+// 各行は1回だけ区切り文字で分割し、フィールドごとのAccumulatorに値を渡す。
+// 集計キーの指定があるときは集計キーごとに集計する。指定がなければ集計キーは空文字1つになる。
+// fieldsはヘッダ名を解決したフィールドの一覧で、accsの各スライスと同じ順番になる。
+func FieldsMinMaxSumAvg(r io.Reader, conf MinMaxSumAvgConfig) (fields []Field, keys []string, accs map[string][]*Accumulator, err error) {
+	accs = make(map[string][]*Accumulator)
+	l := len(conf.fields())
+	add := func(k string) []*Accumulator {
+		as := make([]*Accumulator, l)
+		for j := range as {
+			as[j] = conf.newAccumulator()
+		}
+		accs[k] = as
+		keys = append(keys, k)
+		return as
+	}
+
+	// 集計キーの指定がなければ、データがなくてもフィールドごとの結果を返す
+	if conf.GroupFieldIndex < 1 && conf.GroupFieldName == "" {
+		add("")
+	}
+
+	fields, err = scanValues(r, conf, func(k string, i int, n float64) {
+		as, ok := accs[k]
+		if !ok {
+			as = add(k)
+		}
+		as[i].Add(n)
+	})
+	return
+}
+
+// scanValues は入力を1行ずつ読み込み、数値に変換できた値を関数に渡す。
+// 関数には集計キーと、何番目のフィールドの値かも渡す。
+// 集計キーの指定がない場合、集計キーは空文字になる。
+// ヘッダ名で指定されたフィールドは先頭行から解決し、解決したフィールドの一覧を返す。
+func scanValues(r io.Reader, conf MinMaxSumAvgConfig, f func(key string, i int, n float64)) ([]Field, error) {
+	s := newValueScanner(conf, f)
+	return s.fields, s.scan(r)
+}
+
+// valueScanner は読み込んだ行、レコードからフィールドを取り出して集計関数に渡す。
+type valueScanner struct {
+	conf            MinMaxSumAvgConfig
+	f               func(key string, i int, n float64)
+	fields          []Field
+	groupIndex      int
+	needGroupHeader bool
+	needHeader      bool
+	ignoredCounter  int
+	timeIndex       int
+	needTimeHeader  bool
+	// window は集計関数に渡す値の行が属する時間窓の開始時刻です。
+	window time.Time
+}
+
+func newValueScanner(conf MinMaxSumAvgConfig, f func(key string, i int, n float64)) *valueScanner {
+	s := &valueScanner{
+		conf:            conf,
+		f:               f,
+		fields:          conf.fields(),
+		groupIndex:      conf.GroupFieldIndex,
+		needGroupHeader: conf.GroupFieldName != "" && conf.GroupFieldIndex < 1,
+		timeIndex:       conf.TimeFieldIndex,
+		needTimeHeader:  0 < conf.Window && conf.TimeFieldName != "" && conf.TimeFieldIndex < 1,
+	}
+	s.needHeader = s.needGroupHeader || s.needTimeHeader
+	for _, v := range s.fields {
+		if v.Name != "" && v.Index < 1 {
+			s.needHeader = true
+		}
+	}
+	return s
+}
+
+// HeaderRows は入力の先頭の、ヘッダあるいは無視する行として集計しない行数を返す。
+// ヘッダ名でフィールドを指定したときは、少なくとも先頭行をヘッダとして扱う。
+// 入力を分割して読み込むときに、各部分の先頭に付け直す行数の判定に使う。
+func (c MinMaxSumAvgConfig) HeaderRows() int {
+	if c.JSONField != "" {
+		return c.IgnoreHeaderRows
+	}
+	s := newValueScanner(c, nil)
+	if s.needHeader && c.IgnoreHeaderRows < 1 {
+		return 1
+	}
+	return c.IgnoreHeaderRows
+}
+
+// scan は入力の形式に応じて読み込み、集計関数に値を渡す。
+// CSVの指定があるときはRFC 4180のCSVとして1レコードずつ読み込む。
+// JSONのパスの指定があるときは1行1つのJSONオブジェクトとして読み込む。
+func (s *valueScanner) scan(r io.Reader) error {
+	if s.conf.JSONField != "" {
+		return s.scanJSON(r)
+	}
+	if s.conf.CSV {
+		return s.scanCSV(r)
+	}
+	return s.scanLines(r)
+}
+
+// scanLines は入力を1行ずつ読み込み、区切り文字で分割して集計する。
+func (s *valueScanner) scanLines(r io.Reader) error {
+	// 1フィールドのみで集計キー、時間窓もなければ、従来どおりの切り出し方をする
+	simple := len(s.fields) == 1 && s.groupIndex < 1 && !s.needGroupHeader && s.conf.Window <= 0
 
-	ignoredCounter := 0
 	// 入力をfloatに変換して都度計算
 	sc := bufio.NewScanner(r)
 	for sc.Scan() {
-		// 指定行数まで無視
-		if ignoredCounter < conf.IgnoreHeaderRows {
-			ignoredCounter++
+		line := sc.Text()
+		skip, err := s.skip(func() []string { return strings.Split(line, s.conf.Delimiter) })
+		if err != nil {
+			return err
+		}
+		if skip {
 			continue
 		}
 
-		line := sc.Text()
 		line = strings.Trim(line, " ")
-		line = cutField(line, conf.Delimiter, conf.FieldIndex)
-		n, err := strconv.ParseFloat(line, 64)
+
+		if simple {
+			v := cutField(line, s.conf.Delimiter, s.fields[0].Index)
+			if n, ok := s.parse(v); ok {
+				s.f("", 0, n)
+			}
+			continue
+		}
+
+		// 行は1回だけ分割する
+		s.record(strings.Split(line, s.conf.Delimiter), line)
+	}
+	return sc.Err()
+}
+
+// scanCSV は入力をRFC 4180のCSVとして読み込んで集計する。
+// クォートされたフィールド中の区切り文字、エスケープされたクォート、改行を扱える。
+// 区切り文字は1文字でなければならない。
+// 不正なレコードは警告を出力して無視し、後続の処理を継続する。
+func (s *valueScanner) scanCSV(r io.Reader) error {
+	comma, err := csvComma(s.conf.Delimiter)
+	if err != nil {
+		return err
+	}
+
+	cr := csv.NewReader(r)
+	cr.Comma = comma
+	// フィールド数はレコードごとに異なってもよい
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
 		if err != nil {
-			// 不正な文字列が存在しても後続の処理を継続してほしいのでcontinue
-			msg := fmt.Sprintf("warn: illegal value. value=%v", line)
-			fmt.Fprintln(os.Stderr, msg)
+			if _, ok := err.(*csv.ParseError); ok {
+				msg := fmt.Sprintf("warn: illegal record. %v", err)
+				fmt.Fprintln(os.Stderr, msg)
+				continue
+			}
+			return err
+		}
+
+		skip, err := s.skip(func() []string { return rec })
+		if err != nil {
+			return err
+		}
+		if skip {
 			continue
 		}
-		min = math.Min(n, min)
-		max = math.Max(n, max)
-		sum += n
-		if conf.NeedValues {
-			ns = append(ns, n)
+
+		s.record(rec, strings.Join(rec, s.conf.Delimiter))
+	}
+}
+
+// csvComma はCSVの区切り文字を返す。
+func csvComma(d string) (rune, error) {
+	rs := []rune(d)
+	if len(rs) != 1 {
+		msg := fmt.Sprintf("csv delimiter must be a single character. delimiter=%q", d)
+		return 0, errors.New(msg)
+	}
+	return rs[0], nil
+}
+
+// skip はヘッダ行、無視する行のときにtrueを返す。
+// ヘッダ名でフィールドが指定されていれば、先頭行からフィールド番号を解決する。
+func (s *valueScanner) skip(header func() []string) (bool, error) {
+	if s.needHeader {
+		s.needHeader = false
+		names := header()
+		for i, v := range s.fields {
+			if v.Name == "" || 0 < v.Index {
+				continue
+			}
+			n, err := fieldIndexOf(names, v.Name)
+			if err != nil {
+				return false, err
+			}
+			s.fields[i].Index = n
+		}
+		if s.needGroupHeader {
+			n, err := fieldIndexOf(names, s.conf.GroupFieldName)
+			if err != nil {
+				return false, err
+			}
+			s.groupIndex = n
 		}
-		cnt++
+		if s.needTimeHeader {
+			n, err := fieldIndexOf(names, s.conf.TimeFieldName)
+			if err != nil {
+				return false, err
+			}
+			s.timeIndex = n
+		}
+
+		// 先頭行はヘッダなので集計対象にしない
+		if s.conf.IgnoreHeaderRows < 1 {
+			return true, nil
+		}
+	}
+
+	// 指定行数まで無視
+	if s.ignoredCounter < s.conf.IgnoreHeaderRows {
+		s.ignoredCounter++
+		return true, nil
 	}
-	if cnt == 0 {
-		min = 0
+	return false, nil
+}
+
+// record は分割済みの行から集計キーと値を取り出して集計関数に渡す。
+// lineは警告の出力に使う。
+func (s *valueScanner) record(ss []string, line string) {
+	var key string
+	if 0 < s.groupIndex {
+		k, ok := field(ss, s.groupIndex)
+		if !ok {
+			// 集計キーがない行は無視して後続の処理を継続
+			msg := fmt.Sprintf("warn: illegal key. value=%v", line)
+			fmt.Fprintln(os.Stderr, msg)
+			return
+		}
+		key = k
+	}
+
+	t, ok := field(ss, s.timeIndex)
+	if !s.setWindow(t, ok, line) {
 		return
 	}
-	avg = sum / float64(cnt)
-	err = sc.Err()
-	return
+
+	for i, v := range s.fields {
+		// 集計キーと値の取り違えを防ぐため、値のフィールドがない行は不正な値とする
+		val, _ := field(ss, v.Index)
+		if n, ok := s.parse(val); ok {
+			s.f(key, i, n)
+		}
+	}
+}
+
+// parse は設定の単位に応じて文字列を数値に変換する。
+// 単位の指定がなければparseValueと同じ。
+func (s *valueScanner) parse(v string) (float64, bool) {
+	if s.conf.Unit == nil {
+		return parseValue(v)
+	}
+	n, err := s.conf.Unit.Parse(v)
+	if err != nil || math.IsNaN(n) {
+		msg := fmt.Sprintf("warn: illegal value. value=%v", v)
+		fmt.Fprintln(os.Stderr, msg)
+		return 0, false
+	}
+	return n, true
+}
+
+// parseValue は文字列を数値に変換する。
+// 変換できない値とNaNは警告を出力してfalseを返す。
+func parseValue(s string) (float64, bool) {
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(n) {
+		// 不正な文字列が存在しても後続の処理を継続してほしいので警告のみ
+		msg := fmt.Sprintf("warn: illegal value. value=%v", s)
+		fmt.Fprintln(os.Stderr, msg)
+		return 0, false
+	}
+	return n, true
+}
+
+// fieldIndexOf は分割済みのヘッダ行からヘッダ名のフィールド番号(1〜)を返す。
+// 見つからないときは、指定可能なヘッダ名の一覧をエラーメッセージに含める。
+func fieldIndexOf(header []string, name string) (int, error) {
+	names := make([]string, len(header))
+	for i, v := range header {
+		names[i] = strings.TrimSpace(v)
+		if names[i] == name {
+			return i + 1, nil
+		}
+	}
+	msg := fmt.Sprintf("field is not found in header. name=%s available=[%s]", name, strings.Join(names, ", "))
+	return 0, errors.New(msg)
+}
+
+// field は分割済みの行から指定の番号(1〜)のフィールドを返す。
+// cutFieldと異なり、フィールドが存在しないときはfalseを返す。
+func field(ss []string, i int) (string, bool) {
+	n := i - 1
+	if n < 0 || len(ss) <= n {
+		return "", false
+	}
+	return strings.TrimSpace(ss[n]), true
 }
 
 // cutField は文字列を指定文字で区切り、指定の番号のフィールドを返す。
@@ -90,6 +469,116 @@ func cutField(l, d string, i int) string {
 	return ss[n]
 }
 
+// SampleVariance は母分散とデータ数から標本分散(不偏分散)を算出する。
+// データ数が2未満のときは0を返す。
+func SampleVariance(vari float64, cnt int) float64 {
+	if cnt < 2 {
+		return 0.0
+	}
+	return vari * float64(cnt) / float64(cnt-1)
+}
+
+// QuantileMethod は中央値、パーセンタイル値の算出方法です。
+type QuantileMethod string
+
+const (
+	// QuantileLegacy は従来の算出方法です。
+	// パーセンタイルは l*p/100-1 を切り捨てた位置の値、
+	// 中央値はデータ数が偶数のとき中央の2つのうち小さい方の値を返す。
+	QuantileLegacy QuantileMethod = "legacy"
+	// QuantileNearestRank は最近順位法(ceil(p/100*n)番目の値)です。
+	QuantileNearestRank QuantileMethod = "nearest"
+	// QuantileLinear は線形補間です。RのType7、numpy、Excelのデフォルトと同じ。
+	QuantileLinear QuantileMethod = "linear"
+	// QuantileMidpoint は前後の値の中点です。
+	QuantileMidpoint QuantileMethod = "midpoint"
+	// QuantileLower は前後の値のうち小さい方です。
+	QuantileLower QuantileMethod = "lower"
+	// QuantileHigher は前後の値のうち大きい方です。
+	QuantileHigher QuantileMethod = "higher"
+)
+
+// Quantile はソート済みのfloat配列から、指定の算出方法でパーセンタイル値を計算する。
+// pは0~100で指定する。算出方法が空のときはQuantileLegacyとして扱う。
+func Quantile(ns []float64, p float64, m QuantileMethod) float64 {
+	if m == "" || m == QuantileLegacy {
+		return Percentile(ns, p)
+	}
+
+	l := len(ns)
+	if l <= 0 || p < 0 {
+		return 0.0
+	}
+	if 100 < p {
+		p = 100
+	}
+
+	if m == QuantileNearestRank {
+		i := int(math.Ceil(p/100*float64(l))) - 1
+		if i < 0 {
+			i = 0
+		}
+		return ns[i]
+	}
+
+	// 補間系は (l-1)*p/100 の位置を基準にする
+	h := float64(l-1) * p / 100
+	lo := int(math.Floor(h))
+	hi := int(math.Ceil(h))
+	switch m {
+	case QuantileLower:
+		return ns[lo]
+	case QuantileHigher:
+		return ns[hi]
+	}
+
+	// 位置がちょうど値の上にあるときは補間しない
+	// 無限大と掛け合わせてNaNにならないように、割合が0でも補間しない
+	f := h - float64(lo)
+	if lo == hi || f == 0 {
+		return ns[lo]
+	}
+	if m == QuantileMidpoint {
+		f = 0.5
+	}
+	a, b := ns[lo], ns[hi]
+	if math.IsInf(a, 0) || math.IsInf(b, 0) {
+		return infEndpoint(a, b, f)
+	}
+	// 非常に大きい値同士でもオーバーフローしないように補間する
+	if m == QuantileMidpoint {
+		return a/2 + b/2
+	}
+	if d := b - a; !math.IsInf(d, 0) {
+		return a + f*d
+	}
+	return a*(1-f) + b*f
+}
+
+// infEndpoint は少なくとも一方が無限大の前後の値から、補間せずに無限大の端点を返す。
+// 両方が異なる符号の無限大のときは、割合が0.5未満なら前、以上なら後ろの値を返す。
+func infEndpoint(a, b, f float64) float64 {
+	switch {
+	case math.IsInf(a, 0) && math.IsInf(b, 0):
+		if f < 0.5 {
+			return a
+		}
+		return b
+	case math.IsInf(a, 0):
+		return a
+	}
+	return b
+}
+
+// MedianBy はソート済みのfloat配列から、指定の算出方法で中央値を計算する。
+// 算出方法が空のときはQuantileLegacyとして扱う。
+func MedianBy(ns []float64, m QuantileMethod) float64 {
+	if m == "" || m == QuantileLegacy {
+		return Median(ns)
+	}
+	return Quantile(ns, 50, m)
+}
+
 // Median はfloat配列から中央値を算出する。
 func Median(ns []float64) float64 {
 	l := len(ns)
@@ -103,7 +592,8 @@ func Median(ns []float64) float64 {
 }
 
 // Percentile はパーセンタイル値を計算する。
-func Percentile(ns []float64, n int) float64 {
+// nは99.9のように小数も指定できる。
+func Percentile(ns []float64, n float64) float64 {
 	if n <= 0 {
 		return 0.0
 	}
@@ -113,7 +603,7 @@ func Percentile(ns []float64, n int) float64 {
 		return 0.0
 	}
 
-	i := l*n/100 - 1
+	i := int(float64(l)*n/100) - 1
 	if i < 0 {
 		i = 0
 	}
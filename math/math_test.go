@@ -3,13 +3,14 @@ package math
 import (
 	"bytes"
 	"io"
+	"math"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
-type TestMinMaxSumAvgData struct {
+type TestAccumulateData struct {
 	inR      io.Reader
 	inConf   MinMaxSumAvgConfig
 	outCount int
@@ -17,16 +18,17 @@ type TestMinMaxSumAvgData struct {
 	outMax   float64
 	outSum   float64
 	outAvg   float64
+	outVar   float64
 	outNs    []float64
 }
 
-func TestMinMaxSumAvg(t *testing.T) {
+func TestAccumulate(t *testing.T) {
 	f := func(s ...string) io.Reader {
 		return bytes.NewBufferString(strings.Join(s, "\n"))
 	}
 
-	tds := []TestMinMaxSumAvgData{
-		TestMinMaxSumAvgData{ // ソート不要のとき、nsが空になる
+	tds := []TestAccumulateData{
+		TestAccumulateData{ // ソート不要のとき、nsが空になる
 			inR: f(
 				"1.0",
 				"2.0",
@@ -40,9 +42,10 @@ func TestMinMaxSumAvg(t *testing.T) {
 			outMax:   5.0,
 			outSum:   15.0,
 			outAvg:   3.0,
+			outVar:   2.0,
 			outNs:    nil,
 		},
-		TestMinMaxSumAvgData{ // ソートされてないデータとソート必要フラグ。読み取ったデータを返却
+		TestAccumulateData{ // ソートされてないデータとソート必要フラグ。読み取ったデータを返却
 			inR: f(
 				"1.0",
 				"5.0",
@@ -58,9 +61,10 @@ func TestMinMaxSumAvg(t *testing.T) {
 			outMax:   5.0,
 			outSum:   15.0,
 			outAvg:   3.0,
+			outVar:   2.0,
 			outNs:    []float64{1, 5, 4, 3, 2},
 		},
-		TestMinMaxSumAvgData{ // 不正なデータがあってもエラーを無視すること
+		TestAccumulateData{ // 不正なデータがあってもエラーを無視すること
 			inR: f(
 				"1.0",
 				"5.0",
@@ -77,9 +81,10 @@ func TestMinMaxSumAvg(t *testing.T) {
 			outMax:   5.0,
 			outSum:   15.0,
 			outAvg:   3.0,
+			outVar:   2.0,
 			outNs:    []float64{1, 5, 4, 3, 2},
 		},
-		TestMinMaxSumAvgData{ // データが1つだけ
+		TestAccumulateData{ // データが1つだけ
 			inR: f(
 				"1.0",
 			),
@@ -91,9 +96,10 @@ func TestMinMaxSumAvg(t *testing.T) {
 			outMax:   1.0,
 			outSum:   1.0,
 			outAvg:   1.0,
+			outVar:   0.0,
 			outNs:    []float64{1.0},
 		},
-		TestMinMaxSumAvgData{ // データが0
+		TestAccumulateData{ // データが0
 			inR: f(),
 			inConf: MinMaxSumAvgConfig{
 				NeedValues: true,
@@ -105,7 +111,7 @@ func TestMinMaxSumAvg(t *testing.T) {
 			outAvg:   0.0,
 			outNs:    nil,
 		},
-		TestMinMaxSumAvgData{ // 空データのみ
+		TestAccumulateData{ // 空データのみ
 			inR: f(
 				"",
 				"",
@@ -120,7 +126,7 @@ func TestMinMaxSumAvg(t *testing.T) {
 			outAvg:   0.0,
 			outNs:    nil,
 		},
-		TestMinMaxSumAvgData{ // フィールド指定
+		TestAccumulateData{ // フィールド指定
 			inR: f(
 				"val1,val2",
 				"1,2",
@@ -137,9 +143,10 @@ func TestMinMaxSumAvg(t *testing.T) {
 			outMax:   5.0,
 			outSum:   9.0,
 			outAvg:   3.0,
+			outVar:   8.0 / 3.0,
 			outNs:    []float64{1, 3, 5},
 		},
-		TestMinMaxSumAvgData{ // ヘッダ無視
+		TestAccumulateData{ // ヘッダ無視
 			inR: f(
 				"val1,val2",
 				"1,2",
@@ -157,9 +164,10 @@ func TestMinMaxSumAvg(t *testing.T) {
 			outMax:   5.0,
 			outSum:   9.0,
 			outAvg:   3.0,
+			outVar:   8.0 / 3.0,
 			outNs:    []float64{1, 3, 5},
 		},
-		TestMinMaxSumAvgData{ // ヘッダ2行無視
+		TestAccumulateData{ // ヘッダ2行無視
 			inR: f(
 				"val1,val2",
 				"1,2",
@@ -177,21 +185,380 @@ func TestMinMaxSumAvg(t *testing.T) {
 			outMax:   5.0,
 			outSum:   8.0,
 			outAvg:   4.0,
+			outVar:   1.0,
+			outNs:    []float64{3, 5},
+		},
+		TestAccumulateData{ // 負数のみ
+			inR: f(
+				"-5",
+				"-1",
+				"-3",
+				"-2",
+				"-4",
+			),
+			inConf:   MinMaxSumAvgConfig{},
+			outCount: 5,
+			outMin:   -5.0,
+			outMax:   -1.0,
+			outSum:   -15.0,
+			outAvg:   -3.0,
+			outVar:   2.0,
+		},
+		TestAccumulateData{ // 正負の混在
+			inR: f(
+				"-2",
+				"3",
+				"-0.0",
+				"0",
+				"1",
+			),
+			inConf:   MinMaxSumAvgConfig{},
+			outCount: 5,
+			outMin:   -2.0,
+			outMax:   3.0,
+			outSum:   2.0,
+			outAvg:   0.4,
+			outVar:   2.64,
+		},
+		TestAccumulateData{ // 最初の値が最大値
+			inR: f(
+				"10",
+				"-1",
+				"5",
+			),
+			inConf:   MinMaxSumAvgConfig{},
+			outCount: 3,
+			outMin:   -1.0,
+			outMax:   10.0,
+			outSum:   14.0,
+			outAvg:   14.0 / 3.0,
+			outVar:   182.0 / 9.0,
+		},
+		TestAccumulateData{ // ヘッダ名でフィールド指定。ヘッダ行は集計しない
+			inR: f(
+				"val1,val2",
+				"1,2",
+				"3,4",
+				"5,6",
+			),
+			inConf: MinMaxSumAvgConfig{
+				NeedValues: true,
+				Delimiter:  ",",
+				FieldName:  "val2",
+			},
+			outCount: 3,
+			outMin:   2.0,
+			outMax:   6.0,
+			outSum:   12.0,
+			outAvg:   4.0,
+			outVar:   8.0 / 3.0,
+			outNs:    []float64{2, 4, 6},
+		},
+		TestAccumulateData{ // ヘッダ名指定とヘッダ無視の併用
+			inR: f(
+				"val1,val2",
+				"1,2",
+				"3,4",
+				"5,6",
+			),
+			inConf: MinMaxSumAvgConfig{
+				NeedValues:       true,
+				Delimiter:        ",",
+				FieldName:        "val1",
+				IgnoreHeaderRows: 2,
+			},
+			outCount: 2,
+			outMin:   3.0,
+			outMax:   5.0,
+			outSum:   8.0,
+			outAvg:   4.0,
+			outVar:   1.0,
 			outNs:    []float64{3, 5},
 		},
 	}
 	for _, v := range tds {
-		cnt, min, max, sum, avg, ns, err := MinMaxSumAvg(v.inR, v.inConf)
+		a, err := Accumulate(v.inR, v.inConf)
 		assert.NoError(t, err)
-		assert.Equal(t, v.outCount, cnt)
-		assert.Equal(t, v.outMin, min)
-		assert.Equal(t, v.outMax, max)
-		assert.Equal(t, v.outSum, sum)
-		assert.Equal(t, v.outAvg, avg)
-		assert.EqualValues(t, v.outNs, ns)
+		assert.Equal(t, v.outCount, a.Count)
+		assert.Equal(t, v.outMin, a.Min)
+		assert.Equal(t, v.outMax, a.Max)
+		assert.Equal(t, v.outSum, a.Sum)
+		assert.Equal(t, v.outAvg, a.Average())
+		assert.InDelta(t, v.outVar, a.Variance(), 1e-9)
+		assert.EqualValues(t, v.outNs, a.Values)
 	}
 }
 
+func TestMinMaxSumAvg(t *testing.T) {
+	// Accumulateと同じ値を返す
+	cnt, min, max, sum, avg, vari, ns, err := MinMaxSumAvg(bytes.NewBufferString("5\n1\nx\n3"), MinMaxSumAvgConfig{NeedValues: true})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, cnt)
+	assert.Equal(t, 1.0, min)
+	assert.Equal(t, 5.0, max)
+	assert.Equal(t, 9.0, sum)
+	assert.Equal(t, 3.0, avg)
+	assert.InDelta(t, 8.0/3.0, vari, 1e-9)
+	assert.Equal(t, []float64{5, 1, 3}, ns)
+
+	_, _, _, _, _, _, _, err = MinMaxSumAvg(bytes.NewBufferString("a\n1"), MinMaxSumAvgConfig{FieldName: "b"})
+	assert.Error(t, err)
+}
+
+type TestGroupMinMaxSumAvgData struct {
+	inR     io.Reader
+	inConf  MinMaxSumAvgConfig
+	outKeys []string
+	outSums map[string]float64
+	outNs   map[string][]float64
+}
+
+func TestGroupMinMaxSumAvg(t *testing.T) {
+	f := func(s ...string) io.Reader {
+		return bytes.NewBufferString(strings.Join(s, "\n"))
+	}
+
+	tds := []TestGroupMinMaxSumAvgData{
+		TestGroupMinMaxSumAvgData{ // フィールド番号指定。出現順に返す
+			inR: f(
+				"/b,100",
+				"/a,10",
+				"/b,300",
+				"/a,30",
+			),
+			inConf: MinMaxSumAvgConfig{
+				NeedValues:      true,
+				Delimiter:       ",",
+				FieldIndex:      2,
+				GroupFieldIndex: 1,
+			},
+			outKeys: []string{"/b", "/a"},
+			outSums: map[string]float64{"/b": 400, "/a": 40},
+			outNs:   map[string][]float64{"/b": []float64{100, 300}, "/a": []float64{10, 30}},
+		},
+		TestGroupMinMaxSumAvgData{ // ヘッダ名指定。ヘッダ行は集計しない
+			inR: f(
+				"latency,endpoint",
+				"10,/a",
+				"20,/a",
+				"5,/c",
+			),
+			inConf: MinMaxSumAvgConfig{
+				Delimiter:      ",",
+				FieldIndex:     1,
+				GroupFieldName: "endpoint",
+			},
+			outKeys: []string{"/a", "/c"},
+			outSums: map[string]float64{"/a": 30, "/c": 5},
+			outNs:   map[string][]float64{"/a": nil, "/c": nil},
+		},
+		TestGroupMinMaxSumAvgData{ // ヘッダ名指定とヘッダ無視の併用
+			inR: f(
+				"latency,endpoint",
+				"# comment",
+				"10,/a",
+				"20,/a",
+			),
+			inConf: MinMaxSumAvgConfig{
+				Delimiter:        ",",
+				FieldIndex:       1,
+				IgnoreHeaderRows: 2,
+				GroupFieldName:   "endpoint",
+			},
+			outKeys: []string{"/a"},
+			outSums: map[string]float64{"/a": 30},
+			outNs:   map[string][]float64{"/a": nil},
+		},
+		TestGroupMinMaxSumAvgData{ // 集計キーがない行と不正な値は無視
+			inR: f(
+				"/a,10",
+				"20",
+				"/a,x",
+				"/b,5",
+			),
+			inConf: MinMaxSumAvgConfig{
+				Delimiter:       ",",
+				FieldIndex:      2,
+				GroupFieldIndex: 1,
+			},
+			outKeys: []string{"/a", "/b"},
+			outSums: map[string]float64{"/a": 10, "/b": 5},
+			outNs:   map[string][]float64{"/a": nil, "/b": nil},
+		},
+	}
+	for _, v := range tds {
+		keys, accs, err := GroupMinMaxSumAvg(v.inR, v.inConf)
+		assert.NoError(t, err)
+		assert.Equal(t, v.outKeys, keys)
+		for k, sum := range v.outSums {
+			assert.Equal(t, sum, accs[k].Sum)
+			assert.Equal(t, v.outNs[k], accs[k].Values)
+		}
+	}
+
+	// 存在しないヘッダ名
+	_, _, err := GroupMinMaxSumAvg(f("latency,endpoint", "10,/a"), MinMaxSumAvgConfig{
+		Delimiter:      ",",
+		FieldIndex:     1,
+		GroupFieldName: "path",
+	})
+	assert.Error(t, err)
+}
+
+func TestAccumulateFieldNameNotFound(t *testing.T) {
+	r := bytes.NewBufferString("name, score ,ok\nkokugo,75,80")
+	_, err := Accumulate(r, MinMaxSumAvgConfig{
+		Delimiter: ",",
+		FieldName: "elapsed",
+	})
+	assert.EqualError(t, err, "field is not found in header. name=elapsed available=[name, score, ok]")
+}
+
+type TestHeaderRowsData struct {
+	desc   string
+	conf   MinMaxSumAvgConfig
+	expect int
+}
+
+func TestHeaderRows(t *testing.T) {
+	tds := []TestHeaderRowsData{
+		TestHeaderRowsData{desc: "ヘッダなし", conf: MinMaxSumAvgConfig{FieldIndex: 1}, expect: 0},
+		TestHeaderRowsData{desc: "無視する行", conf: MinMaxSumAvgConfig{FieldIndex: 1, IgnoreHeaderRows: 2}, expect: 2},
+		TestHeaderRowsData{desc: "ヘッダ名", conf: MinMaxSumAvgConfig{FieldName: "score"}, expect: 1},
+		TestHeaderRowsData{desc: "ヘッダ名と無視する行", conf: MinMaxSumAvgConfig{FieldName: "score", IgnoreHeaderRows: 3}, expect: 3},
+		TestHeaderRowsData{desc: "集計キーのヘッダ名", conf: MinMaxSumAvgConfig{FieldIndex: 2, GroupFieldName: "name"}, expect: 1},
+		TestHeaderRowsData{desc: "複数フィールドのヘッダ名", conf: MinMaxSumAvgConfig{Fields: []Field{Field{Index: 2}, Field{Name: "ok"}}}, expect: 1},
+		TestHeaderRowsData{desc: "JSON", conf: MinMaxSumAvgConfig{JSONField: "score", GroupFieldName: "name"}, expect: 0},
+	}
+	for _, v := range tds {
+		assert.Equal(t, v.expect, v.conf.HeaderRows(), v.desc)
+	}
+}
+
+func TestAccumulateCSV(t *testing.T) {
+	in := strings.Join([]string{
+		"request,status,ms",
+		`"GET /a,b",200,10`,
+		`"POST /say ""hi""",200,20`,
+		"\"GET /multi\nline\",500,30",
+		`"GET /a,b",200,40`,
+	}, "\n")
+
+	// クォート中の区切り文字、エスケープされたクォート、改行でフィールドがずれない
+	a, err := Accumulate(bytes.NewBufferString(in), MinMaxSumAvgConfig{
+		Delimiter: ",",
+		FieldName: "ms",
+		CSV:       true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, a.Count)
+	assert.Equal(t, 10.0, a.Min)
+	assert.Equal(t, 40.0, a.Max)
+	assert.Equal(t, 100.0, a.Sum)
+
+	// 区切り文字で分割するだけでは後続のフィールドがずれる
+	a, _ = Accumulate(bytes.NewBufferString(in), MinMaxSumAvgConfig{
+		Delimiter:        ",",
+		FieldIndex:       3,
+		IgnoreHeaderRows: 1,
+	})
+	assert.NotEqual(t, 100.0, a.Sum)
+
+	// 集計キーにクォートされたフィールドを指定
+	keys, accs, err := GroupMinMaxSumAvg(bytes.NewBufferString(in), MinMaxSumAvgConfig{
+		Delimiter:      ",",
+		FieldIndex:     3,
+		GroupFieldName: "request",
+		CSV:            true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"GET /a,b", `POST /say "hi"`, "GET /multi\nline"}, keys)
+	assert.Equal(t, 50.0, accs["GET /a,b"].Sum)
+	assert.Equal(t, 20.0, accs[`POST /say "hi"`].Sum)
+
+	// 区切り文字の変更と不正なレコードの無視
+	a, err = Accumulate(bytes.NewBufferString("a;1\nb\"x;2\n\"c;d\";3"), MinMaxSumAvgConfig{
+		Delimiter:  ";",
+		FieldIndex: 2,
+		CSV:        true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, a.Count)
+	assert.Equal(t, 4.0, a.Sum)
+
+	// 区切り文字は1文字のみ
+	a, err = Accumulate(bytes.NewBufferString("1"), MinMaxSumAvgConfig{
+		Delimiter:  "::",
+		FieldIndex: 1,
+		CSV:        true,
+	})
+	assert.Error(t, err)
+}
+
+func TestFieldsMinMaxSumAvg(t *testing.T) {
+	f := func(s ...string) io.Reader {
+		return bytes.NewBufferString(strings.Join(s, "\n"))
+	}
+
+	// フィールド番号とヘッダ名の混在。不正な値はそのフィールドのみ無視する
+	fields, keys, accs, err := FieldsMinMaxSumAvg(f(
+		"endpoint,latency,bytes",
+		"/a,10,100",
+		"/b,100,x",
+		"/a,30,300",
+	), MinMaxSumAvgConfig{
+		NeedValues: true,
+		Delimiter:  ",",
+		Fields: []Field{
+			Field{Index: 2},
+			Field{Name: "bytes"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []Field{Field{Index: 2}, Field{Index: 3, Name: "bytes"}}, fields)
+	assert.Equal(t, []string{""}, keys)
+	assert.Equal(t, 3, accs[""][0].Count)
+	assert.Equal(t, 140.0, accs[""][0].Sum)
+	assert.Equal(t, []float64{10, 100, 30}, accs[""][0].Values)
+	assert.Equal(t, 2, accs[""][1].Count)
+	assert.Equal(t, 400.0, accs[""][1].Sum)
+
+	// 集計キーとの併用
+	fields, keys, accs, err = FieldsMinMaxSumAvg(f(
+		"/a,10,100",
+		"/b,100,1000",
+		"/a,30,300",
+	), MinMaxSumAvgConfig{
+		Delimiter:       ",",
+		Fields:          []Field{Field{Index: 2}, Field{Index: 3}},
+		GroupFieldIndex: 1,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []Field{Field{Index: 2}, Field{Index: 3}}, fields)
+	assert.Equal(t, []string{"/a", "/b"}, keys)
+	assert.Equal(t, 40.0, accs["/a"][0].Sum)
+	assert.Equal(t, 400.0, accs["/a"][1].Sum)
+	assert.Equal(t, 100.0, accs["/b"][0].Sum)
+	assert.Equal(t, 1000.0, accs["/b"][1].Sum)
+
+	// データなしでもフィールドごとの結果を返す
+	_, keys, accs, err = FieldsMinMaxSumAvg(f(), MinMaxSumAvgConfig{
+		Delimiter: ",",
+		Fields:    []Field{Field{Index: 1}, Field{Index: 2}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{""}, keys)
+	assert.Equal(t, 2, len(accs[""]))
+	assert.Equal(t, 0, accs[""][1].Count)
+
+	// 存在しないヘッダ名
+	_, _, _, err = FieldsMinMaxSumAvg(f("a,b", "1,2"), MinMaxSumAvgConfig{
+		Delimiter: ",",
+		Fields:    []Field{Field{Index: 1}, Field{Name: "c"}},
+	})
+	assert.Error(t, err)
+}
+
 type TestCutFieldData struct {
 	inLine       string
 	inDelimiter  string
@@ -237,6 +604,75 @@ func TestCutField(t *testing.T) {
 	}
 }
 
+func TestAccumulateVarianceStability(t *testing.T) {
+	// 大きなオフセットがあっても桁落ちせずに分散が求まること
+	r := bytes.NewBufferString(strings.Join([]string{
+		"1000000004",
+		"1000000007",
+		"1000000013",
+		"1000000016",
+	}, "\n"))
+	a, err := Accumulate(r, MinMaxSumAvgConfig{})
+	assert.NoError(t, err)
+	assert.InDelta(t, 22.5, a.Variance(), 1e-9)
+	assert.InDelta(t, 30.0, SampleVariance(a.Variance(), 4), 1e-9)
+}
+
+func TestAccumulateExtremeValues(t *testing.T) {
+	f := func(s ...string) io.Reader {
+		return bytes.NewBufferString(strings.Join(s, "\n"))
+	}
+
+	// 無限大は集計対象にする。分散は定義できないのでNaNになる
+	// NaNは不正な値として無視する
+	a, err := Accumulate(f("1", "Inf", "NaN", "-2"), MinMaxSumAvgConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, a.Count)
+	assert.Equal(t, -2.0, a.Min)
+	assert.True(t, math.IsInf(a.Max, 1))
+	assert.True(t, math.IsInf(a.Sum, 1))
+	assert.True(t, math.IsInf(a.Average(), 1))
+	assert.True(t, math.IsNaN(a.Variance()))
+
+	// 正負の無限大が混在すると合計値、平均値は不定
+	a, err = Accumulate(f("-Inf", "1", "+Inf"), MinMaxSumAvgConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, a.Count)
+	assert.True(t, math.IsInf(a.Min, -1))
+	assert.True(t, math.IsInf(a.Max, 1))
+	assert.True(t, math.IsNaN(a.Sum))
+	assert.True(t, math.IsNaN(a.Average()))
+
+	// 合計値がオーバーフローしても平均値は算出できる
+	a, err = Accumulate(f("1e308", "1.5e308", "1.2e308"), MinMaxSumAvgConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, a.Count)
+	assert.Equal(t, 1e308, a.Min)
+	assert.Equal(t, 1.5e308, a.Max)
+	assert.True(t, math.IsInf(a.Sum, 1))
+	assert.InEpsilon(t, 3.7e308/3, a.Average(), 1e-12)
+
+	a, err = Accumulate(f("-1e308", "-1.5e308", "-1.2e308"), MinMaxSumAvgConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, a.Count)
+	assert.Equal(t, -1.5e308, a.Min)
+	assert.Equal(t, -1e308, a.Max)
+	assert.True(t, math.IsInf(a.Sum, -1))
+	assert.InEpsilon(t, -3.7e308/3, a.Average(), 1e-12)
+
+	// -0のみ
+	a, err = Accumulate(f("-0"), MinMaxSumAvgConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, a.Min)
+	assert.Equal(t, 0.0, a.Max)
+}
+
+func TestSampleVariance(t *testing.T) {
+	assert.Equal(t, 2.5, SampleVariance(2.0, 5))
+	assert.Equal(t, 0.0, SampleVariance(0.0, 1))
+	assert.Equal(t, 0.0, SampleVariance(0.0, 0))
+}
+
 func TestMedian(t *testing.T) {
 	assert.Equal(t, 3.0, Median([]float64{1.0, 2.0, 3.0, 4.0, 5.0}))
 	assert.Equal(t, 3.0, Median([]float64{1.0, 2.0, 3.0, 4.0, 5.0, 6.0}))
@@ -248,7 +684,7 @@ func TestMedian(t *testing.T) {
 
 type TestPercentileData struct {
 	ns []float64
-	n  int
+	n  float64
 	p  float64 // percentile
 }
 
@@ -275,6 +711,13 @@ func TestPercentile(t *testing.T) {
 			n:  95,
 			p:  1.0,
 		},
+		TestPercentileData{ // 小数指定
+			ns: []float64{
+				1.0, 2.0, 3.0, 4.0, 5.0, 6.0, 7.0, 8.0, 9.0, 10.0,
+			},
+			n: 99.9,
+			p: 9.0,
+		},
 		TestPercentileData{
 			ns: []float64{1.0},
 			n:  0,
@@ -295,3 +738,86 @@ func TestPercentile(t *testing.T) {
 		assert.Equal(t, v.p, Percentile(v.ns, v.n))
 	}
 }
+
+type TestQuantileData struct {
+	p   float64
+	m   QuantileMethod
+	out float64
+}
+
+type TestQuantileInfData struct {
+	desc string
+	ns   []float64
+	p    float64
+	m    QuantileMethod
+	out  float64
+}
+
+func TestQuantile(t *testing.T) {
+	ns := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	tds := []TestQuantileData{
+		TestQuantileData{p: 50, m: "", out: 5},
+		TestQuantileData{p: 50, m: QuantileLegacy, out: 5},
+		TestQuantileData{p: 50, m: QuantileNearestRank, out: 5},
+		TestQuantileData{p: 50, m: QuantileLinear, out: 5.5},
+		TestQuantileData{p: 50, m: QuantileMidpoint, out: 5.5},
+		TestQuantileData{p: 50, m: QuantileLower, out: 5},
+		TestQuantileData{p: 50, m: QuantileHigher, out: 6},
+		TestQuantileData{p: 90, m: QuantileNearestRank, out: 9},
+		TestQuantileData{p: 90, m: QuantileLinear, out: 9.1},
+		TestQuantileData{p: 90, m: QuantileMidpoint, out: 9.5},
+		TestQuantileData{p: 90, m: QuantileLower, out: 9},
+		TestQuantileData{p: 90, m: QuantileHigher, out: 10},
+		TestQuantileData{p: 0, m: QuantileNearestRank, out: 1},
+		TestQuantileData{p: 0, m: QuantileLinear, out: 1},
+		TestQuantileData{p: 100, m: QuantileNearestRank, out: 10},
+		TestQuantileData{p: 100, m: QuantileLinear, out: 10},
+		TestQuantileData{p: 100, m: QuantileHigher, out: 10},
+	}
+	for _, v := range tds {
+		assert.InDelta(t, v.out, Quantile(ns, v.p, v.m), 1e-9, "p=%v method=%v", v.p, v.m)
+	}
+
+	// 無限大を含むときは補間せず、NaNにしない
+	inf := math.Inf(1)
+	ninf := math.Inf(-1)
+	itds := []TestQuantileInfData{
+		TestQuantileInfData{desc: "割合が0で隣が無限大", ns: []float64{1, inf, inf}, p: 50, m: QuantileLinear, out: inf},
+		TestQuantileInfData{desc: "最大が無限大", ns: []float64{1, inf}, p: 100, m: QuantileLinear, out: inf},
+		TestQuantileInfData{desc: "後ろが無限大", ns: []float64{1, inf}, p: 50, m: QuantileLinear, out: inf},
+		TestQuantileInfData{desc: "前が負の無限大", ns: []float64{ninf, 1}, p: 90, m: QuantileLinear, out: ninf},
+		TestQuantileInfData{desc: "割合が0で前が負の無限大", ns: []float64{ninf, 1, 2}, p: 50, m: QuantileLinear, out: 1},
+		TestQuantileInfData{desc: "両端が異なる符号の無限大(前)", ns: []float64{ninf, inf}, p: 25, m: QuantileLinear, out: ninf},
+		TestQuantileInfData{desc: "両端が異なる符号の無限大(後ろ)", ns: []float64{ninf, inf}, p: 75, m: QuantileLinear, out: inf},
+		TestQuantileInfData{desc: "中点で後ろが無限大", ns: []float64{1, inf}, p: 50, m: QuantileMidpoint, out: inf},
+		TestQuantileInfData{desc: "中点で両端が異なる符号の無限大", ns: []float64{ninf, inf}, p: 50, m: QuantileMidpoint, out: inf},
+		TestQuantileInfData{desc: "中点で割合が0", ns: []float64{1, inf, inf}, p: 50, m: QuantileMidpoint, out: inf},
+		TestQuantileInfData{desc: "中点で無限大の位置", ns: []float64{1, 2, inf}, p: 100, m: QuantileMidpoint, out: inf},
+		TestQuantileInfData{desc: "中央値", ns: []float64{1, inf, inf}, p: 50, m: QuantileMidpoint, out: inf},
+	}
+	for _, v := range itds {
+		assert.Equal(t, v.out, Quantile(v.ns, v.p, v.m), v.desc)
+	}
+	assert.Equal(t, inf, MedianBy([]float64{1, inf, inf}, QuantileLinear))
+
+	// 非常に大きい値同士の補間はオーバーフローしない
+	assert.Equal(t, 1.35e+308, Quantile([]float64{1.2e+308, 1.5e+308}, 50, QuantileMidpoint))
+	assert.InDelta(t, 0.25e+308, Quantile([]float64{-1e+308, 1.5e+308}, 50, QuantileLinear), 1e+294)
+
+	// 空データ
+	assert.Equal(t, 0.0, Quantile([]float64{}, 50, QuantileLinear))
+	// データが1つ
+	assert.Equal(t, 3.0, Quantile([]float64{3}, 99, QuantileLinear))
+}
+
+func TestMedianBy(t *testing.T) {
+	ns := []float64{1, 2, 3, 4}
+	assert.Equal(t, 2.0, MedianBy(ns, ""))
+	assert.Equal(t, 2.0, MedianBy(ns, QuantileLegacy))
+	assert.Equal(t, 2.5, MedianBy(ns, QuantileLinear))
+	assert.Equal(t, 2.5, MedianBy(ns, QuantileMidpoint))
+	assert.Equal(t, 2.0, MedianBy(ns, QuantileNearestRank))
+	assert.Equal(t, 2.0, MedianBy(ns, QuantileLower))
+	assert.Equal(t, 3.0, MedianBy(ns, QuantileHigher))
+	assert.Equal(t, 0.0, MedianBy([]float64{}, QuantileLinear))
+}
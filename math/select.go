@@ -0,0 +1,161 @@
+package math
+
+import (
+	"math"
+	"sort"
+)
+
+// selectInsertionThreshold は挿入ソートに切り替える範囲の要素数です。
+const selectInsertionThreshold = 16
+
+// Select は指定の位置に、ソートしたときと同じ値が入るようにfloat配列を部分的に並べ替える。
+// 全体をソートせずに必要な順序統計量だけを求めるため、O(n log n)のソートより高速に
+// 中央値、パーセンタイル値を算出できる。
+// 複数の位置は1回の走査でまとめて選択する(multi-quickselect)。
+// 再帰が深くなりすぎたときは、その範囲をソートして最悪計算量をO(n log n)に抑える(introselect)。
+// 範囲外の位置は無視する。
+func Select(ns []float64, ks []int) {
+	idx := make([]int, 0, len(ks))
+	for _, k := range ks {
+		if 0 <= k && k < len(ns) {
+			idx = append(idx, k)
+		}
+	}
+	if len(idx) < 1 {
+		return
+	}
+	sort.Ints(idx)
+
+	depth := 2 * int(math.Ceil(math.Log2(float64(len(ns)+1))))
+	multiSelect(ns, 0, len(ns)-1, idx, depth)
+}
+
+// multiSelect はns[lo:hi+1]の範囲で、昇順のksの各位置の値を選択する。
+func multiSelect(ns []float64, lo, hi int, ks []int, depth int) {
+	for 0 < len(ks) {
+		if hi-lo < selectInsertionThreshold {
+			insertionSort(ns, lo, hi)
+			return
+		}
+		if depth <= 0 {
+			sort.Float64s(ns[lo : hi+1])
+			return
+		}
+		depth--
+
+		// 重複の多いデータでも偏らないように3分割する
+		lt, gt := partition3(ns, lo, hi, medianOfThree(ns, lo, lo+(hi-lo)/2, hi))
+
+		// ピボットより小さい範囲、大きい範囲の位置に分ける
+		// ピボットと等しい範囲の位置は選択済み
+		i := sort.SearchInts(ks, lt)
+		j := sort.SearchInts(ks, gt+1)
+		left, right := ks[:i], ks[j:]
+
+		// 位置の少ない方を再帰し、多い方はループで処理する
+		if len(left) < len(right) {
+			multiSelect(ns, lo, lt-1, left, depth)
+			lo, ks = gt+1, right
+		} else {
+			multiSelect(ns, gt+1, hi, right, depth)
+			hi, ks = lt-1, left
+		}
+	}
+}
+
+// partition3 はピボットより小さい値、等しい値、大きい値の順にns[lo:hi+1]を並べ替え、
+// 等しい値の範囲の先頭と末尾を返す。
+func partition3(ns []float64, lo, hi int, pivot float64) (int, int) {
+	lt, i, gt := lo, lo, hi
+	for i <= gt {
+		switch {
+		case ns[i] < pivot:
+			ns[lt], ns[i] = ns[i], ns[lt]
+			lt++
+			i++
+		case pivot < ns[i]:
+			ns[i], ns[gt] = ns[gt], ns[i]
+			gt--
+		default:
+			i++
+		}
+	}
+	return lt, gt
+}
+
+// medianOfThree は3つの位置の値の中央値を返す。
+func medianOfThree(ns []float64, a, b, c int) float64 {
+	x, y, z := ns[a], ns[b], ns[c]
+	if y < x {
+		x, y = y, x
+	}
+	if z < y {
+		y = z
+		if y < x {
+			y = x
+		}
+	}
+	return y
+}
+
+// insertionSort はns[lo:hi+1]を挿入ソートする。
+func insertionSort(ns []float64, lo, hi int) {
+	for i := lo + 1; i <= hi; i++ {
+		for j := i; lo < j && ns[j] < ns[j-1]; j-- {
+			ns[j], ns[j-1] = ns[j-1], ns[j]
+		}
+	}
+}
+
+// QuantileIndices はQuantileが参照するソート済み配列の位置を返す。
+// Selectでこの位置を選択しておけば、ソートしなくてもQuantileで同じ値を算出できる。
+func QuantileIndices(l int, p float64, m QuantileMethod) []int {
+	if l <= 0 {
+		return nil
+	}
+
+	if m == "" || m == QuantileLegacy {
+		if p <= 0 {
+			return nil
+		}
+		i := int(float64(l)*p/100) - 1
+		if i < 0 {
+			i = 0
+		}
+		return []int{i}
+	}
+
+	if p < 0 {
+		return nil
+	}
+	if 100 < p {
+		p = 100
+	}
+
+	if m == QuantileNearestRank {
+		i := int(math.Ceil(p/100*float64(l))) - 1
+		if i < 0 {
+			i = 0
+		}
+		return []int{i}
+	}
+
+	h := float64(l-1) * p / 100
+	lo := int(math.Floor(h))
+	hi := int(math.Ceil(h))
+	return []int{lo, hi}
+}
+
+// MedianIndices はMedianByが参照するソート済み配列の位置を返す。
+func MedianIndices(l int, m QuantileMethod) []int {
+	if m == "" || m == QuantileLegacy {
+		if l <= 0 {
+			return nil
+		}
+		if l%2 == 1 {
+			return []int{l / 2}
+		}
+		return []int{l/2 - 1}
+	}
+	return QuantileIndices(l, 50, m)
+}
@@ -0,0 +1,137 @@
+package math
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var quantileMethods = []QuantileMethod{
+	QuantileLegacy,
+	QuantileNearestRank,
+	QuantileLinear,
+	QuantileMidpoint,
+	QuantileLower,
+	QuantileHigher,
+}
+
+func TestSelect(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, l := range []int{0, 1, 2, 3, 15, 16, 17, 100, 1000, 10000} {
+		for _, gen := range []func(i int) float64{
+			func(i int) float64 { return r.Float64() },               // ランダム
+			func(i int) float64 { return float64(r.Intn(5)) },        // 重複が多い
+			func(i int) float64 { return float64(i) },                // ソート済み
+			func(i int) float64 { return float64(l - i) },            // 逆順
+			func(i int) float64 { return math.Inf(1 - 2*(i%2)) },     // 無限大のみ
+			func(i int) float64 { return float64(i%7) - float64(3) }, // 負数を含む周期
+		} {
+			ns := make([]float64, l)
+			for i := range ns {
+				ns[i] = gen(i)
+			}
+			sorted := make([]float64, l)
+			copy(sorted, ns)
+			sort.Float64s(sorted)
+
+			ks := []int{0, l / 4, l / 2, l / 2, l - 1, l * 99 / 100, -1, l}
+			Select(ns, ks)
+			for _, k := range ks {
+				if 0 <= k && k < l {
+					assert.Equal(t, sorted[k], ns[k], "l=%d k=%d", l, k)
+				}
+			}
+		}
+	}
+}
+
+// TestSelectQuantile は選択した配列とソートした配列から同じ値を算出できることを確認する。
+func TestSelectQuantile(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	ps := []float64{0, 0.1, 1, 25, 50, 90, 95, 99, 99.9, 100}
+	for _, l := range []int{0, 1, 2, 5, 10, 99, 100, 1001} {
+		orig := make([]float64, l)
+		for i := range orig {
+			orig[i] = r.NormFloat64()
+		}
+		sorted := make([]float64, l)
+		copy(sorted, orig)
+		sort.Float64s(sorted)
+
+		for _, m := range quantileMethods {
+			ns := make([]float64, l)
+			copy(ns, orig)
+			ks := MedianIndices(l, m)
+			for _, p := range ps {
+				ks = append(ks, QuantileIndices(l, p, m)...)
+			}
+			Select(ns, ks)
+
+			assert.Equal(t, MedianBy(sorted, m), MedianBy(ns, m), "l=%d m=%s", l, m)
+			for _, p := range ps {
+				assert.Equal(t, Quantile(sorted, p, m), Quantile(ns, p, m), "l=%d m=%s p=%v", l, m, p)
+			}
+		}
+	}
+}
+
+func TestQuantileIndices(t *testing.T) {
+	assert.Nil(t, QuantileIndices(0, 50, QuantileLinear))
+	assert.Nil(t, QuantileIndices(10, 0, QuantileLegacy))
+	assert.Equal(t, []int{8}, QuantileIndices(10, 95, QuantileLegacy))
+	assert.Equal(t, []int{9}, QuantileIndices(10, 95, QuantileNearestRank))
+	assert.Equal(t, []int{8, 9}, QuantileIndices(10, 95, QuantileLinear))
+	assert.Equal(t, []int{9, 9}, QuantileIndices(10, 120, QuantileHigher))
+	assert.Equal(t, []int{4}, MedianIndices(10, QuantileLegacy))
+	assert.Equal(t, []int{5}, MedianIndices(11, ""))
+	assert.Equal(t, []int{4, 5}, MedianIndices(10, QuantileMidpoint))
+}
+
+// benchmarkValues はベンチマーク用の乱数を生成する。
+func benchmarkValues(n int) []float64 {
+	r := rand.New(rand.NewSource(1))
+	ns := make([]float64, n)
+	for i := range ns {
+		ns[i] = r.ExpFloat64() * 100
+	}
+	return ns
+}
+
+func benchmarkMedianP95P99(b *testing.B, n int, f func(ns []float64)) {
+	orig := benchmarkValues(n)
+	ns := make([]float64, n)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		copy(ns, orig)
+		b.StartTimer()
+		f(ns)
+	}
+}
+
+func sortMedianP95P99(ns []float64) {
+	sort.Float64s(ns)
+	MedianBy(ns, QuantileLinear)
+	Quantile(ns, 95, QuantileLinear)
+	Quantile(ns, 99, QuantileLinear)
+}
+
+func selectMedianP95P99(ns []float64) {
+	ks := MedianIndices(len(ns), QuantileLinear)
+	ks = append(ks, QuantileIndices(len(ns), 95, QuantileLinear)...)
+	ks = append(ks, QuantileIndices(len(ns), 99, QuantileLinear)...)
+	Select(ns, ks)
+	MedianBy(ns, QuantileLinear)
+	Quantile(ns, 95, QuantileLinear)
+	Quantile(ns, 99, QuantileLinear)
+}
+
+func BenchmarkSort100K(b *testing.B)   { benchmarkMedianP95P99(b, 100000, sortMedianP95P99) }
+func BenchmarkSelect100K(b *testing.B) { benchmarkMedianP95P99(b, 100000, selectMedianP95P99) }
+func BenchmarkSort1M(b *testing.B)     { benchmarkMedianP95P99(b, 1000000, sortMedianP95P99) }
+func BenchmarkSelect1M(b *testing.B)   { benchmarkMedianP95P99(b, 1000000, selectMedianP95P99) }
+func BenchmarkSort5M(b *testing.B)     { benchmarkMedianP95P99(b, 5000000, sortMedianP95P99) }
+func BenchmarkSelect5M(b *testing.B)   { benchmarkMedianP95P99(b, 5000000, selectMedianP95P99) }
@@ -0,0 +1,142 @@
+package math
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type TestTDigestQuantileData struct {
+	in  []float64
+	p   float64
+	out float64
+}
+
+func TestTDigestQuantile(t *testing.T) {
+	tds := []TestTDigestQuantileData{
+		TestTDigestQuantileData{in: nil, p: 50, out: 0},                      // データなし
+		TestTDigestQuantileData{in: []float64{7}, p: 99, out: 7},             // 1件
+		TestTDigestQuantileData{in: []float64{5, 1, 3, 2, 4}, p: 50, out: 3}, // 少量のデータは重心にまとめない
+		TestTDigestQuantileData{in: []float64{5, 1, 3, 2, 4}, p: 0, out: 1},
+		TestTDigestQuantileData{in: []float64{5, 1, 3, 2, 4}, p: 100, out: 5},
+		TestTDigestQuantileData{in: []float64{5, 1, 3, 2, 4}, p: 120, out: 5},
+		TestTDigestQuantileData{in: []float64{1, 2, 3, 4}, p: 50, out: 2.5},
+		TestTDigestQuantileData{in: []float64{-1, -3, -2}, p: 50, out: -2}, // 負数のみ
+		TestTDigestQuantileData{in: []float64{math.Inf(-1), 1, 2, math.Inf(1)}, p: 10, out: math.Inf(-1)},
+		TestTDigestQuantileData{in: []float64{math.Inf(-1), 1, 2, math.Inf(1)}, p: 50, out: 1.5},
+		TestTDigestQuantileData{in: []float64{math.Inf(-1), 1, 2, math.Inf(1)}, p: 90, out: math.Inf(1)},
+		TestTDigestQuantileData{in: []float64{math.Inf(1), math.Inf(1)}, p: 50, out: math.Inf(1)}, // 無限大のみ
+		TestTDigestQuantileData{in: []float64{1, math.NaN(), 3}, p: 50, out: 2},                   // NaNは無視
+	}
+	for _, v := range tds {
+		td := NewTDigest(0)
+		for _, n := range v.in {
+			td.Add(n)
+		}
+		assert.Equal(t, v.out, td.Quantile(v.p), "in=%v p=%v", v.in, v.p)
+	}
+}
+
+// randomValues は分布の偏ったテスト用の乱数を生成する。
+func randomValues(seed int64, n int) []float64 {
+	r := rand.New(rand.NewSource(seed))
+	ns := make([]float64, n)
+	for i := range ns {
+		ns[i] = math.Exp(r.NormFloat64() * 2)
+	}
+	return ns
+}
+
+// rankError は推定値の順位と分位数の差(割合)を返す。
+func rankError(sorted []float64, est, p float64) float64 {
+	rank := sort.SearchFloat64s(sorted, est)
+	return math.Abs(float64(rank)/float64(len(sorted)) - p/100)
+}
+
+func TestTDigestAccuracy(t *testing.T) {
+	ns := randomValues(1, 200000)
+	td := NewTDigest(0)
+	for _, n := range ns {
+		td.Add(n)
+	}
+	sort.Float64s(ns)
+
+	// 順位の誤差はπ√(q(1-q))/δ以内
+	for _, p := range []float64{0.1, 1, 25, 50, 75, 90, 99, 99.9} {
+		q := p / 100
+		bound := math.Pi * math.Sqrt(q*(1-q)) / DefaultCompression
+		assert.True(t, rankError(ns, td.Quantile(p), p) <= bound, "p=%v", p)
+	}
+
+	// 重心の数はデータ数によらずδ程度に収まる
+	assert.True(t, len(td.Centroids()) <= DefaultCompression)
+	assert.Equal(t, float64(len(ns)), td.Count())
+	assert.Equal(t, ns[0], td.Quantile(0))
+	assert.Equal(t, ns[len(ns)-1], td.Quantile(100))
+}
+
+func TestTDigestMerge(t *testing.T) {
+	ns := randomValues(2, 100000)
+	a := NewTDigest(0)
+	b := NewTDigest(0)
+	for i, n := range ns {
+		if i%3 == 0 {
+			a.Add(n)
+		} else {
+			b.Add(n)
+		}
+	}
+	b.Add(math.Inf(1))
+	bCount := b.Count()
+
+	a.Merge(b)
+	// 引数のTDigestは変更しない
+	assert.Equal(t, bCount, b.Count())
+	assert.Equal(t, float64(len(ns)+1), a.Count())
+	assert.Equal(t, math.Inf(1), a.Quantile(100))
+
+	sort.Float64s(ns)
+	for _, p := range []float64{1, 50, 99} {
+		q := p / 100
+		bound := math.Pi * math.Sqrt(q*(1-q)) / DefaultCompression
+		assert.True(t, rankError(ns, a.Quantile(p), p) <= bound*2, "p=%v", p)
+	}
+
+	// 自身との併合
+	c := NewTDigest(0)
+	for _, n := range []float64{1, 2, 3} {
+		c.Add(n)
+	}
+	c.Merge(c)
+	assert.Equal(t, 6.0, c.Count())
+	assert.Equal(t, 2.0, c.Quantile(50))
+}
+
+func TestTDigestMergeMinMax(t *testing.T) {
+	// 両端の重心が複数の値をまとめていても、併合した最小値、最大値は重心の平均にならない
+	merged := NewTDigest(20)
+	min, max := math.Inf(1), math.Inf(-1)
+	for i := 0; i < 20; i++ {
+		d := NewTDigest(20)
+		for _, n := range randomValues(int64(10+i), 50000) {
+			d.Add(n)
+			min = math.Min(min, n)
+			max = math.Max(max, n)
+		}
+		merged.Merge(d)
+	}
+	assert.Equal(t, min, merged.Quantile(0))
+	assert.Equal(t, max, merged.Quantile(100))
+
+	// 空のTDigestとの併合
+	e := NewTDigest(0)
+	e.Merge(NewTDigest(0))
+	assert.Equal(t, 0.0, e.Count())
+	e.Add(5)
+	e.Merge(NewTDigest(0))
+	assert.Equal(t, 5.0, e.Quantile(0))
+	assert.Equal(t, 5.0, e.Quantile(100))
+}
@@ -0,0 +1,227 @@
+package math
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UnitKind は単位の種類です。
+type UnitKind int
+
+const (
+	// UnitDuration は時間の単位です。
+	UnitDuration UnitKind = iota + 1
+	// UnitBytes はバイト数の単位です。
+	UnitBytes
+)
+
+// Unit は値の単位です。
+// 入力の単位付きの値を、この単位の数値に正規化する。
+type Unit struct {
+	// Name は単位の表記です。
+	Name string
+	// Kind は単位の種類です。
+	Kind UnitKind
+	// Scale は種類ごとの最小の単位(ns、B)に対する大きさです。
+	Scale float64
+	// binary はバイト数の単位が1024の累乗(KiB, MiB)か否かです。
+	binary bool
+}
+
+// unitScale は単位の表記と大きさの組です。
+type unitScale struct {
+	name  string
+	scale float64
+}
+
+// durationUnits は時間の単位です。大きさはnsに対する値。
+// 表記はGoのtime.Durationと同じで、大文字小文字を区別する。
+var durationUnits = []unitScale{
+	{"ns", 1},
+	{"us", 1e3},
+	{"µs", 1e3}, // U+00B5
+	{"μs", 1e3}, // U+03BC
+	{"ms", 1e6},
+	{"s", 1e9},
+	{"m", 60e9},
+	{"h", 3600e9},
+}
+
+// byteUnits はバイト数の単位です。大きさはBに対する値。
+// 表記の大文字小文字は区別しない。
+var byteUnits = []unitScale{
+	{"B", 1},
+	{"KB", 1e3},
+	{"MB", 1e6},
+	{"GB", 1e9},
+	{"TB", 1e12},
+	{"PB", 1e15},
+	{"KiB", 1 << 10},
+	{"MiB", 1 << 20},
+	{"GiB", 1 << 30},
+	{"TiB", 1 << 40},
+	{"PiB", 1 << 50},
+}
+
+// humanDurationUnits は時間を人が読みやすい単位で出力するときの単位です。
+var humanDurationUnits = []unitScale{
+	{"ns", 1},
+	{"µs", 1e3},
+	{"ms", 1e6},
+	{"s", 1e9},
+	{"m", 60e9},
+	{"h", 3600e9},
+}
+
+var (
+	humanDecimalUnits = byteUnits[:6]
+	humanBinaryUnits  = append([]unitScale{byteUnits[0]}, byteUnits[6:]...)
+)
+
+// ParseUnit は単位の表記から単位を返す。
+// 時間はns, us(µs), ms, s, m, h、バイト数はB, KB, MB, GB, TB, PB, KiB, MiB, GiB, TiB, PiBを指定できる。
+func ParseUnit(name string) (Unit, error) {
+	if sc, ok := findUnit(durationUnits, name, false); ok {
+		return Unit{Name: sc.name, Kind: UnitDuration, Scale: sc.scale}, nil
+	}
+	if sc, ok := findUnit(byteUnits, name, true); ok {
+		return Unit{Name: sc.name, Kind: UnitBytes, Scale: sc.scale, binary: strings.Contains(sc.name, "i") || sc.name == "B"}, nil
+	}
+	msg := fmt.Sprintf("unit is a duration (ns, us, ms, s, m, h) or a byte size (B, KB, MB, GB, KiB, MiB, GiB, ...). unit=%s", name)
+	return Unit{}, errors.New(msg)
+}
+
+func findUnit(us []unitScale, name string, fold bool) (unitScale, bool) {
+	for _, u := range us {
+		if u.name == name || (fold && strings.EqualFold(u.name, name)) {
+			return u, true
+		}
+	}
+	return unitScale{}, false
+}
+
+// units は単位の種類の単位の一覧を返す。
+func (u Unit) units() ([]unitScale, bool) {
+	if u.Kind == UnitBytes {
+		return byteUnits, true
+	}
+	return durationUnits, false
+}
+
+// Parse は単位付きの値をこの単位の数値に変換する。
+// 12.5ms、340µs、1.5 MiBのように数値の後に単位を付ける。単位がない値はこの単位の値とみなす。
+// 時間は1m30sのようなGoのtime.Durationの複合した表記も変換できる。
+func (u Unit) Parse(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		return n, nil
+	}
+
+	i := numberPrefixLen(s)
+	if i == 0 {
+		msg := fmt.Sprintf("value is not a number with unit. value=%s", s)
+		return 0, errors.New(msg)
+	}
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, err
+	}
+
+	us, fold := u.units()
+	sc, ok := findUnit(us, strings.TrimSpace(s[i:]), fold)
+	if !ok {
+		if u.Kind == UnitDuration {
+			if d, err := time.ParseDuration(s); err == nil {
+				return u.convert(float64(d), 1), nil
+			}
+		}
+		msg := fmt.Sprintf("unit is not a %s. value=%s", u.kindName(), s)
+		return 0, errors.New(msg)
+	}
+	return u.convert(n, sc.scale), nil
+}
+
+// convert は大きさがscaleの単位の値を、この単位の値に変換する。
+// 誤差を抑えるため、単位の比が整数になる向きで計算する。
+func (u Unit) convert(n, scale float64) float64 {
+	if u.Scale <= scale {
+		return n * (scale / u.Scale)
+	}
+	return n / (u.Scale / scale)
+}
+
+func (u Unit) kindName() string {
+	if u.Kind == UnitBytes {
+		return "byte size"
+	}
+	return "duration"
+}
+
+// numberPrefixLen は文字列の先頭の数値の長さを返す。
+func numberPrefixLen(s string) int {
+	i := 0
+	if i < len(s) && (s[i] == '+' || s[i] == '-') {
+		i++
+	}
+	digits := 0
+	for ; i < len(s) && ('0' <= s[i] && s[i] <= '9' || s[i] == '.'); i++ {
+		digits++
+	}
+	if digits == 0 {
+		return 0
+	}
+	// 指数表記。eの後に数字が続くときのみ数値とみなす
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		j := i + 1
+		if j < len(s) && (s[j] == '+' || s[j] == '-') {
+			j++
+		}
+		if j < len(s) && '0' <= s[j] && s[j] <= '9' {
+			for j < len(s) && '0' <= s[j] && s[j] <= '9' {
+				j++
+			}
+			i = j
+		}
+	}
+	return i
+}
+
+// Format はこの単位の値を、人が読みやすい単位の文字列にする。
+// 絶対値が1以上になる最大の単位を選び、小数点以下3桁までにする。
+// バイト数は、この単位がB、KiBなどのときは1024の累乗、KBなどのときは1000の累乗の単位にする。
+func (u Unit) Format(n float64) string {
+	if math.IsInf(n, 0) || math.IsNaN(n) {
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+
+	us := humanDurationUnits
+	if u.Kind == UnitBytes {
+		us = humanDecimalUnits
+		if u.binary {
+			us = humanBinaryUnits
+		}
+	}
+
+	v := n * u.Scale
+	sc := us[0]
+	for _, c := range us[1:] {
+		if c.scale <= math.Abs(v) {
+			sc = c
+		}
+	}
+	if n == 0 {
+		sc = unitScale{u.Name, u.Scale}
+	}
+
+	s := strconv.FormatFloat(v/sc.scale, 'f', 3, 64)
+	s = strings.TrimRight(s, "0")
+	s = strings.TrimRight(s, ".")
+	if s == "-0" {
+		s = "0"
+	}
+	return s + sc.name
+}
@@ -0,0 +1,146 @@
+package math
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseUnit(t *testing.T) {
+	for _, v := range []struct {
+		in    string
+		name  string
+		kind  UnitKind
+		scale float64
+	}{
+		{"ms", "ms", UnitDuration, 1e6},
+		{"µs", "µs", UnitDuration, 1e3},
+		{"h", "h", UnitDuration, 3600e9},
+		{"B", "B", UnitBytes, 1},
+		{"mib", "MiB", UnitBytes, 1 << 20},
+		{"KB", "KB", UnitBytes, 1000},
+	} {
+		u, err := ParseUnit(v.in)
+		assert.NoError(t, err, v.in)
+		assert.Equal(t, v.name, u.Name, v.in)
+		assert.Equal(t, v.kind, u.Kind, v.in)
+		assert.Equal(t, v.scale, u.Scale, v.in)
+	}
+
+	// 時間の単位は大文字小文字を区別する
+	for _, v := range []string{"", "MS", "sec", "bit", "1ms"} {
+		_, err := ParseUnit(v)
+		assert.Error(t, err, v)
+	}
+}
+
+type TestUnitParseData struct {
+	unit string
+	in   string
+	out  float64
+}
+
+func TestUnitParse(t *testing.T) {
+	tds := []TestUnitParseData{
+		TestUnitParseData{unit: "ms", in: "12.5ms", out: 12.5},
+		TestUnitParseData{unit: "ms", in: "1.2s", out: 1200},
+		TestUnitParseData{unit: "ms", in: "340µs", out: 0.34},
+		TestUnitParseData{unit: "ms", in: "340μs", out: 0.34},
+		TestUnitParseData{unit: "ms", in: "340us", out: 0.34},
+		TestUnitParseData{unit: "ms", in: "1500ns", out: 0.0015},
+		TestUnitParseData{unit: "ms", in: " 2 m ", out: 120000},
+		TestUnitParseData{unit: "s", in: "1.5h", out: 5400},
+		TestUnitParseData{unit: "s", in: "1m30.5s", out: 90.5},
+		TestUnitParseData{unit: "ms", in: "-5ms", out: -5},
+		TestUnitParseData{unit: "ms", in: "1e3us", out: 1},
+		TestUnitParseData{unit: "ms", in: "250", out: 250},
+		TestUnitParseData{unit: "B", in: "1.5MiB", out: 1572864},
+		TestUnitParseData{unit: "B", in: "2 kb", out: 2000},
+		TestUnitParseData{unit: "KiB", in: "1MiB", out: 1024},
+		TestUnitParseData{unit: "MB", in: "500KB", out: 0.5},
+	}
+	for _, v := range tds {
+		u, err := ParseUnit(v.unit)
+		assert.NoError(t, err)
+		n, err := u.Parse(v.in)
+		assert.NoError(t, err, v.in)
+		assert.Equal(t, v.out, n, v.in)
+	}
+
+	// Infは単位がなくても変換できる
+	u, _ := ParseUnit("ms")
+	n, err := u.Parse("+Inf")
+	assert.NoError(t, err)
+	assert.True(t, math.IsInf(n, 1))
+
+	// 種類の異なる単位、不明な単位、数値のない値
+	for _, v := range []string{"5KB", "5 parsecs", "ms", "", "1EB", "1.2.3s"} {
+		_, err := u.Parse(v)
+		assert.Error(t, err, v)
+	}
+	b, _ := ParseUnit("B")
+	_, err = b.Parse("5ms")
+	assert.Error(t, err)
+}
+
+func TestUnitFormat(t *testing.T) {
+	for _, v := range []struct {
+		unit string
+		in   float64
+		out  string
+	}{
+		{"ms", 12.5, "12.5ms"},
+		{"ms", 1200, "1.2s"},
+		{"ms", 0.34, "340µs"},
+		{"ms", 0.0005, "500ns"},
+		{"ms", 90000, "1.5m"},
+		{"ms", 7200000, "2h"},
+		{"ms", -1500, "-1.5s"},
+		{"ms", 0, "0ms"},
+		{"ms", 1.23456, "1.235ms"},
+		{"ms", math.Inf(1), "+Inf"},
+		{"B", 1572864, "1.5MiB"},
+		{"B", 512, "512B"},
+		{"KiB", 2048, "2MiB"},
+		{"KB", 2500, "2.5MB"},
+		{"MB", 0.5, "500KB"},
+	} {
+		u, err := ParseUnit(v.unit)
+		assert.NoError(t, err)
+		assert.Equal(t, v.out, u.Format(v.in), "%s %v", v.unit, v.in)
+	}
+}
+
+func TestAccumulateUnit(t *testing.T) {
+	u, _ := ParseUnit("ms")
+	in := "a\t12.5ms\nb\t1.2s\nc\t340µs\nd\tabc\ne\t5KB\n"
+	a, err := Accumulate(bytes.NewBufferString(in), MinMaxSumAvgConfig{
+		Delimiter:  "\t",
+		FieldIndex: 2,
+		Unit:       &u,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, a.Count)
+	assert.Equal(t, 0.34, a.Min)
+	assert.Equal(t, 1200.0, a.Max)
+	assert.InDelta(t, 1212.84, a.Sum, 1e-9)
+
+	// 単位の指定がなければ単位付きの値は不正な値
+	a, err = Accumulate(bytes.NewBufferString(in), MinMaxSumAvgConfig{
+		Delimiter:  "\t",
+		FieldIndex: 2,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, a.Count)
+
+	// JSONの文字列の値
+	a, err = Accumulate(bytes.NewBufferString(`{"t":"1.5s"}`+"\n"+`{"t":20}`), MinMaxSumAvgConfig{
+		JSONField: "t",
+		Unit:      &u,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, a.Count)
+	assert.Equal(t, 1520.0, a.Sum)
+}
@@ -0,0 +1,175 @@
+package math
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// TimeFormatRFC3339 はRFC 3339の時刻(2006-01-02T15:04:05Z07:00)です。小数点以下の秒も読み込める。
+	TimeFormatRFC3339 = "RFC3339"
+	// TimeFormatUnix はUNIX時間の秒です。小数点以下の秒も読み込める。
+	TimeFormatUnix = "unix"
+	// TimeFormatUnixMilli はUNIX時間のミリ秒です。
+	TimeFormatUnixMilli = "unixms"
+)
+
+// TimeFormat は入力の時刻の形式です。
+type TimeFormat struct {
+	// Name は形式の表記です。RFC3339, unix, unixms以外はGoの時刻のレイアウトです。
+	Name string
+	// layout はtime.Parseに渡すレイアウトです。UNIX時間のときは空文字です。
+	layout string
+}
+
+// ParseTimeFormat は時刻の形式の表記から形式を返す。
+// RFC3339, unix, unixms(大文字小文字を区別しない)以外は、
+// 2006-01-02 15:04:05のようなGoの時刻のレイアウトとして扱う。
+func ParseTimeFormat(name string) (TimeFormat, error) {
+	switch {
+	case strings.EqualFold(name, TimeFormatRFC3339):
+		return TimeFormat{Name: TimeFormatRFC3339, layout: time.RFC3339Nano}, nil
+	case strings.EqualFold(name, TimeFormatUnix):
+		return TimeFormat{Name: TimeFormatUnix}, nil
+	case strings.EqualFold(name, TimeFormatUnixMilli):
+		return TimeFormat{Name: TimeFormatUnixMilli}, nil
+	}
+
+	// 基準の時刻の要素を1つも含まないレイアウトは、どの時刻で整形しても変わらない
+	t := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	if strings.TrimSpace(name) == "" || t.Format(name) == name {
+		msg := fmt.Sprintf("time format is RFC3339, unix, unixms or a Go time layout (2006-01-02 15:04:05). format=%s", name)
+		return TimeFormat{}, errors.New(msg)
+	}
+	return TimeFormat{Name: name, layout: name}, nil
+}
+
+// Parse は時刻の文字列をこの形式で解析する。
+// 形式が未指定(ゼロ値)のときはRFC3339として扱う。
+// UNIX時間、タイムゾーンを含まないレイアウトの時刻はUTCとして扱う。
+func (f TimeFormat) Parse(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	switch f.Name {
+	case TimeFormatUnix:
+		return parseUnix(s, time.Second)
+	case TimeFormatUnixMilli:
+		return parseUnix(s, time.Millisecond)
+	case "":
+		return time.Parse(time.RFC3339Nano, s)
+	}
+	return time.Parse(f.layout, s)
+}
+
+// parseUnix はUNIX時間の文字列を、1がscaleの大きさの時刻として解析する。
+// 整数はそのまま、小数は誤差を含むのでナノ秒に丸めて変換する。
+func parseUnix(s string, scale time.Duration) (time.Time, error) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		sec := int64(time.Second / scale)
+		return time.Unix(n/sec, n%sec*int64(scale)).UTC(), nil
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		msg := fmt.Sprintf("time is not a unix time. value=%s", s)
+		return time.Time{}, errors.New(msg)
+	}
+	sec := float64(time.Second / scale)
+	i, frac := splitFloat(n / sec)
+	return time.Unix(i, int64(frac*float64(time.Second)+0.5)).UTC(), nil
+}
+
+// splitFloat は数値を整数部と0以上1未満の小数部に分ける。
+func splitFloat(n float64) (int64, float64) {
+	i := int64(n)
+	frac := n - float64(i)
+	if frac < 0 {
+		i--
+		frac++
+	}
+	return i, frac
+}
+
+// WindowMinMaxSumAvg は入力を時刻のフィールドの値で時間窓に分け、時間窓ごとに集計する。
+// 時間窓は時刻をWindowの幅で切り捨てた開始時刻で表し、開始時刻の昇順に返す。
+// windowsとaccsは同じ順番になる。
+// 時刻のフィールドがない行、時刻を解析できない行は不正な値として扱い、集計対象にしない。
+// 集計キー、複数フィールドの指定は無視する。
+func WindowMinMaxSumAvg(r io.Reader, conf MinMaxSumAvgConfig) (windows []time.Time, accs []*Accumulator, err error) {
+	if conf.Window <= 0 {
+		return nil, nil, errors.New("window must be positive.")
+	}
+	conf.Fields = nil
+	conf.GroupFieldIndex = 0
+	conf.GroupFieldName = ""
+
+	// 時刻は同じでもタイムゾーンの情報が異なりうるので、UNIX時間で時間窓を判定する
+	idx := make(map[int64]int)
+	s := newValueScanner(conf, nil)
+	s.f = func(_ string, _ int, n float64) {
+		k := s.window.UnixNano()
+		i, ok := idx[k]
+		if !ok {
+			i = len(accs)
+			idx[k] = i
+			windows = append(windows, s.window)
+			accs = append(accs, conf.newAccumulator())
+		}
+		accs[i].Add(n)
+	}
+	if err = s.scan(r); err != nil {
+		return
+	}
+
+	// 入力の時刻は前後しうるので、開始時刻の昇順に並べ替える
+	is := make([]int, len(windows))
+	for i := range is {
+		is[i] = i
+	}
+	sort.SliceStable(is, func(a, b int) bool {
+		return windows[is[a]].Before(windows[is[b]])
+	})
+	ws := make([]time.Time, len(is))
+	as := make([]*Accumulator, len(is))
+	for i, v := range is {
+		ws[i] = windows[v]
+		as[i] = accs[v]
+	}
+	return ws, as, nil
+}
+
+// truncateWindow は時刻を、UNIX時間の起点から時間窓の幅の倍数の時刻に切り捨てる。
+// time.Time.Truncateは西暦1年を起点にするため、1日を割り切れない幅では
+// 他のツールと時間窓の境界が一致しない。タイムゾーンは元の時刻のものを引き継ぐ。
+func truncateWindow(t time.Time, w time.Duration) time.Time {
+	n := t.UnixNano()
+	m := n % w.Nanoseconds()
+	// UNIX時間の起点より前の時刻も、前の境界に切り捨てる
+	if m < 0 {
+		m += w.Nanoseconds()
+	}
+	return time.Unix(0, n-m).In(t.Location())
+}
+
+// setWindow は時刻の文字列から、行が属する時間窓の開始時刻をセットする。
+// 時間窓の指定がなければ何もしない。
+// 時刻がない行、解析できない行は警告を出力してfalseを返す。lineは警告の出力に使う。
+func (s *valueScanner) setWindow(v string, found bool, line string) bool {
+	if s.conf.Window <= 0 {
+		return true
+	}
+	if found {
+		if t, err := s.conf.TimeFormat.Parse(v); err == nil {
+			s.window = truncateWindow(t, s.conf.Window)
+			return true
+		}
+	}
+	// 不正な時刻が存在しても後続の処理を継続してほしいので警告のみ
+	msg := fmt.Sprintf("warn: illegal time. value=%v", line)
+	fmt.Fprintln(os.Stderr, msg)
+	return false
+}
@@ -0,0 +1,168 @@
+package math
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type TestParseTimeFormatData struct {
+	desc   string
+	name   string
+	expect string
+	err    bool
+}
+
+func TestParseTimeFormat(t *testing.T) {
+	tds := []TestParseTimeFormatData{
+		TestParseTimeFormatData{desc: "RFC3339", name: "RFC3339", expect: TimeFormatRFC3339},
+		TestParseTimeFormatData{desc: "大文字小文字を区別しない", name: "rfc3339", expect: TimeFormatRFC3339},
+		TestParseTimeFormatData{desc: "UNIX時間", name: "unix", expect: TimeFormatUnix},
+		TestParseTimeFormatData{desc: "UNIX時間(ミリ秒)", name: "UnixMS", expect: TimeFormatUnixMilli},
+		TestParseTimeFormatData{desc: "レイアウト", name: "2006-01-02 15:04:05", expect: "2006-01-02 15:04:05"},
+		TestParseTimeFormatData{desc: "時刻の要素がない", name: "time", err: true},
+		TestParseTimeFormatData{desc: "空文字", name: "", err: true},
+	}
+	for _, v := range tds {
+		f, err := ParseTimeFormat(v.name)
+		if v.err {
+			assert.Error(t, err, v.desc)
+			continue
+		}
+		assert.NoError(t, err, v.desc)
+		assert.Equal(t, v.expect, f.Name, v.desc)
+	}
+}
+
+type TestTimeFormatParseData struct {
+	desc   string
+	format string
+	value  string
+	expect time.Time
+	err    bool
+}
+
+func TestTimeFormatParse(t *testing.T) {
+	tds := []TestTimeFormatParseData{
+		TestTimeFormatParseData{desc: "RFC3339", format: "RFC3339", value: "2024-05-01T10:00:03Z", expect: time.Date(2024, 5, 1, 10, 0, 3, 0, time.UTC)},
+		TestTimeFormatParseData{desc: "RFC3339の小数点以下の秒", format: "RFC3339", value: "2024-05-01T10:00:03.25Z", expect: time.Date(2024, 5, 1, 10, 0, 3, 250000000, time.UTC)},
+		TestTimeFormatParseData{desc: "RFC3339のタイムゾーン", format: "RFC3339", value: "2024-05-01T19:00:03+09:00", expect: time.Date(2024, 5, 1, 10, 0, 3, 0, time.UTC)},
+		TestTimeFormatParseData{desc: "UNIX時間", format: "unix", value: "1714557603", expect: time.Date(2024, 5, 1, 10, 0, 3, 0, time.UTC)},
+		TestTimeFormatParseData{desc: "UNIX時間の小数", format: "unix", value: "1714557603.5", expect: time.Date(2024, 5, 1, 10, 0, 3, 500000000, time.UTC)},
+		TestTimeFormatParseData{desc: "UNIX時間(ミリ秒)", format: "unixms", value: "1714557603250", expect: time.Date(2024, 5, 1, 10, 0, 3, 250000000, time.UTC)},
+		TestTimeFormatParseData{desc: "負のUNIX時間(ミリ秒)", format: "unixms", value: "-1500", expect: time.Date(1969, 12, 31, 23, 59, 58, 500000000, time.UTC)},
+		TestTimeFormatParseData{desc: "レイアウト", format: "2006-01-02 15:04:05", value: "2024-05-01 10:00:03", expect: time.Date(2024, 5, 1, 10, 0, 3, 0, time.UTC)},
+		TestTimeFormatParseData{desc: "形式が異なる", format: "RFC3339", value: "1714557603", err: true},
+		TestTimeFormatParseData{desc: "UNIX時間でない", format: "unix", value: "2024-05-01", err: true},
+	}
+	for _, v := range tds {
+		f, err := ParseTimeFormat(v.format)
+		assert.NoError(t, err, v.desc)
+		got, err := f.Parse(v.value)
+		if v.err {
+			assert.Error(t, err, v.desc)
+			continue
+		}
+		assert.NoError(t, err, v.desc)
+		assert.True(t, v.expect.Equal(got), v.desc+" got="+got.String())
+	}
+}
+
+var windowInput = strings.Join([]string{
+	"time,latency",
+	"2024-05-01T10:00:03Z,10",
+	"2024-05-01T10:00:09.999Z,20",
+	"2024-05-01T10:00:21Z,5",
+	"2024-05-01T10:00:10Z,30",
+	"not time,100",
+	"2024-05-01T10:00:22Z,abc",
+	"2024-05-01T10:00:25Z",
+	"",
+}, "\n")
+
+func TestWindowMinMaxSumAvg(t *testing.T) {
+	ws, accs, err := WindowMinMaxSumAvg(bytes.NewBufferString(windowInput), MinMaxSumAvgConfig{
+		NeedValues:    true,
+		Delimiter:     ",",
+		FieldName:     "latency",
+		TimeFieldName: "time",
+		Window:        10 * time.Second,
+	})
+	assert.NoError(t, err)
+	// 時間窓は開始時刻の昇順
+	assert.Equal(t, 3, len(ws))
+	assert.Equal(t, 3, len(accs))
+	base := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	for i, w := range ws {
+		assert.True(t, base.Add(time.Duration(i)*10*time.Second).Equal(w), w.String())
+	}
+	assert.Equal(t, []float64{10, 20}, accs[0].Values)
+	assert.Equal(t, []float64{30}, accs[1].Values)
+	assert.Equal(t, []float64{5}, accs[2].Values)
+}
+
+type TestTruncateWindowData struct {
+	desc   string
+	in     time.Time
+	window time.Duration
+	expect time.Time
+}
+
+func TestTruncateWindow(t *testing.T) {
+	jst := time.FixedZone("JST", 9*60*60)
+	tds := []TestTruncateWindowData{
+		TestTruncateWindowData{desc: "1日を割り切る幅", in: time.Date(2024, 5, 1, 10, 0, 9, 0, time.UTC), window: 10 * time.Second, expect: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)},
+		TestTruncateWindowData{desc: "1日を割り切らない幅", in: time.Date(2024, 5, 1, 10, 8, 0, 0, time.UTC), window: 7 * time.Minute, expect: time.Date(2024, 5, 1, 10, 7, 0, 0, time.UTC)},
+		TestTruncateWindowData{desc: "1日を割り切らない幅の境界", in: time.Date(2024, 5, 1, 10, 6, 59, 0, time.UTC), window: 7 * time.Minute, expect: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)},
+		TestTruncateWindowData{desc: "90分", in: time.Date(2024, 5, 1, 10, 5, 0, 0, time.UTC), window: 90 * time.Minute, expect: time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)},
+		TestTruncateWindowData{desc: "タイムゾーンを引き継ぐ", in: time.Date(2024, 5, 1, 19, 8, 0, 0, jst), window: 7 * time.Minute, expect: time.Date(2024, 5, 1, 19, 7, 0, 0, jst)},
+		TestTruncateWindowData{desc: "UNIX時間の起点より前", in: time.Unix(-1, -500000000), window: time.Second, expect: time.Unix(-2, 0)},
+	}
+	for _, v := range tds {
+		got := truncateWindow(v.in, v.window)
+		assert.True(t, v.expect.Equal(got), v.desc+" got="+got.String())
+		assert.Equal(t, v.in.Location(), got.Location(), v.desc)
+	}
+}
+
+func TestWindowMinMaxSumAvgFormats(t *testing.T) {
+	// UNIX時間(ミリ秒)のフィールド番号指定
+	f, err := ParseTimeFormat(TimeFormatUnixMilli)
+	assert.NoError(t, err)
+	in := "1714557603250 1\n1714557601000 2\n1714557602000 3\n"
+	ws, accs, err := WindowMinMaxSumAvg(bytes.NewBufferString(in), MinMaxSumAvgConfig{
+		Delimiter:      " ",
+		FieldIndex:     2,
+		TimeFieldIndex: 1,
+		TimeFormat:     f,
+		Window:         2 * time.Second,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(ws))
+	assert.True(t, time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC).Equal(ws[0]))
+	assert.Equal(t, 2.0, accs[0].Sum)
+	assert.Equal(t, 4.0, accs[1].Sum)
+
+	// JSONの時刻のパス
+	in = strings.Join([]string{
+		`{"ts":{"at":"2024-05-01T10:00:03Z"},"latency":10}`,
+		`{"latency":20}`,
+		`{"ts":{"at":"2024-05-01T10:00:13Z"},"latency":30}`,
+	}, "\n")
+	ws, accs, err = WindowMinMaxSumAvg(bytes.NewBufferString(in), MinMaxSumAvgConfig{
+		JSONField:     "latency",
+		TimeFieldName: "ts.at",
+		Window:        10 * time.Second,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(ws))
+	assert.Equal(t, 10.0, accs[0].Sum)
+	assert.Equal(t, 30.0, accs[1].Sum)
+
+	// 時間窓の幅がない
+	_, _, err = WindowMinMaxSumAvg(bytes.NewBufferString(in), MinMaxSumAvgConfig{JSONField: "latency"})
+	assert.Error(t, err)
+}
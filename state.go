@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/jiro4989/arth/internal/options"
+	arthmath "github.com/jiro4989/arth/math"
+	"github.com/jiro4989/arth/stats"
+)
+
+const (
+	// stateMagic は集計の状態ファイルの先頭の識別子です。
+	stateMagic = "ARTHSTATE"
+	// stateVersion は集計の状態ファイルの形式のバージョンです。
+	// 形式を変更したときは上げて、古いバージョンのファイルを誤って読み込まないようにする。
+	stateVersion = 2
+)
+
+// stateSpec は集計の状態を出力したときの集計の指定です。
+// 併合では出力データの列と併合する組み合わせをこの指定に従って決める。
+// オプションの型を変更しても状態ファイルの形式が変わらないように、数値と文字列で保持する。
+type stateSpec struct {
+	// GroupByIndex、GroupByName は集計キーのフィールド番号とヘッダ名です。
+	GroupByIndex int
+	GroupByName  string
+	// FieldIndexes、FieldNames は複数のフィールドを集計したときの、
+	// フィールドごとのフィールド番号とヘッダ名です。
+	FieldIndexes []int
+	FieldNames   []string
+	Window       time.Duration
+	// Unit は入力の単位の名前です。--humanの出力に使う。
+	Unit string
+}
+
+// stateEntry は1つの出力データに対応する集計の状態です。
+type stateEntry struct {
+	FieldIndex int
+	FieldName  string
+	GroupKey   string
+	Window     time.Time
+	// Acc はstats.AccumulatorのMarshalBinaryの結果です。
+	Acc []byte
+}
+
+// stateFile は集計の状態ファイルの内容です。
+type stateFile struct {
+	Spec    stateSpec
+	Entries []stateEntry
+}
+
+// newStateSpec はオプションと集計結果から集計の指定を生成する。
+func newStateSpec(as []accumulated, opts options.Options) stateSpec {
+	spec := stateSpec{
+		GroupByIndex: opts.GroupBy.Index,
+		GroupByName:  opts.GroupBy.Name,
+		Window:       opts.Window,
+		Unit:         opts.Unit.Name,
+	}
+	if opts.MultiFields() {
+		spec.setFields(fieldsOf(as))
+	}
+	return spec
+}
+
+// groupBy は集計キーのフィールドを返す。
+func (s stateSpec) groupBy() options.Field {
+	return options.Field{Index: s.GroupByIndex, Name: s.GroupByName}
+}
+
+// fields は複数のフィールドを集計したときのフィールドの一覧を返す。
+func (s stateSpec) fields() options.Fields {
+	var fs options.Fields
+	for i, idx := range s.FieldIndexes {
+		fs = append(fs, options.Field{Index: idx, Name: s.FieldNames[i]})
+	}
+	return fs
+}
+
+// setFields は複数のフィールドを集計したときのフィールドの一覧をセットする。
+func (s *stateSpec) setFields(fs options.Fields) {
+	s.FieldIndexes = make([]int, len(fs))
+	s.FieldNames = make([]string, len(fs))
+	for i, f := range fs {
+		s.FieldIndexes[i] = f.Index
+		s.FieldNames[i] = f.Name
+	}
+}
+
+// fieldsOf は集計結果のフィールドを重複を除いて出現順に返す。
+func fieldsOf(as []accumulated) options.Fields {
+	var fs options.Fields
+	seen := make(map[options.Field]bool)
+	for _, v := range as {
+		f := options.Field{Index: v.fieldIndex, Name: v.fieldName}
+		if !seen[f] {
+			seen[f] = true
+			fs = append(fs, f)
+		}
+	}
+	return fs
+}
+
+// compatible は2つの集計の指定の状態を併合できるか否かを返す。
+// 複数フィールドの状態同士は、集計したフィールドが異なっても併合できる。
+func (s stateSpec) compatible(x stateSpec) bool {
+	return s.groupBy() == x.groupBy() &&
+		(1 < len(s.FieldIndexes)) == (1 < len(x.FieldIndexes)) &&
+		s.Window == x.Window &&
+		s.Unit == x.Unit
+}
+
+// apply は集計の指定をオプションにセットする。
+func (s stateSpec) apply(opts options.Options) (options.Options, error) {
+	opts.GroupBy = s.groupBy()
+	opts.Fields = s.fields()
+	opts.Window = s.Window
+	if s.Unit != "" {
+		u, err := arthmath.ParseUnit(s.Unit)
+		if err != nil {
+			return opts, err
+		}
+		opts.Unit = options.Unit{Unit: u}
+	}
+	return opts, nil
+}
+
+// writeState は集計結果を、mergeで併合できる集計の状態ファイルに出力する。
+// ファイルは識別子、形式のバージョン、gobでエンコードした集計の状態の順に書き込む。
+func writeState(fn string, as []accumulated, spec stateSpec) error {
+	sf := stateFile{Spec: spec, Entries: make([]stateEntry, len(as))}
+	for i, v := range as {
+		b, err := v.acc.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		sf.Entries[i] = stateEntry{
+			FieldIndex: v.fieldIndex,
+			FieldName:  v.fieldName,
+			GroupKey:   v.groupKey,
+			Window:     v.window,
+			Acc:        b,
+		}
+	}
+
+	f, err := os.Create(fn)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	w.WriteString(stateMagic)
+	w.WriteByte(stateVersion)
+	if err := gob.NewEncoder(w).Encode(sf); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readState は集計の状態ファイルを読み込み、集計の指定と集計結果を返す。
+// 集計結果の統計値はsoの指定で算出する。
+func readState(fn string, so stats.Options) (stateSpec, []accumulated, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return stateSpec{}, nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	head := make([]byte, len(stateMagic)+1)
+	if _, err := io.ReadFull(r, head); err != nil || string(head[:len(stateMagic)]) != stateMagic {
+		return stateSpec{}, nil, errors.New("not a state file of arth.")
+	}
+	if v := head[len(stateMagic)]; v != stateVersion {
+		msg := fmt.Sprintf("unsupported state version. version=%d", v)
+		return stateSpec{}, nil, errors.New(msg)
+	}
+
+	var sf stateFile
+	if err := gob.NewDecoder(r).Decode(&sf); err != nil {
+		msg := fmt.Sprintf("illegal state file. %v", err)
+		return stateSpec{}, nil, errors.New(msg)
+	}
+	if len(sf.Spec.FieldIndexes) != len(sf.Spec.FieldNames) {
+		return stateSpec{}, nil, errors.New("illegal state file. the number of field indexes and names are different.")
+	}
+	as := make([]accumulated, len(sf.Entries))
+	for i, e := range sf.Entries {
+		acc := stats.New(so)
+		if err := acc.UnmarshalBinary(e.Acc); err != nil {
+			return stateSpec{}, nil, err
+		}
+		as[i] = accumulated{
+			fieldIndex: e.FieldIndex,
+			fieldName:  e.FieldName,
+			groupKey:   e.GroupKey,
+			window:     e.Window,
+			acc:        acc,
+		}
+	}
+	return sf.Spec, as, nil
+}
+
+// processMerge は集計の状態ファイルを読み込み、フィールドと集計キー、時間窓ごとに併合した
+// 出力データを返す。件数、合計値、最小値、最大値、平均値、分散は、もとのデータを
+// すべて集計した場合と同じ値になり、中央値、パーセンタイル値はスケッチから近似する。
+// 読み込みに失敗したファイル、併合できない指定のファイルは併合せず、
+// ファイルごとのエラーをinputErrorで返す。
+// 集計の指定は最初に読み込めたファイルの指定を返す。
+func processMerge(fns []string, opts options.Options) ([]options.OutValues, stateSpec, error) {
+	so := statsOptions(opts)
+	var spec stateSpec
+	var first string
+	var ass [][]accumulated
+	var ierr inputError
+	for _, fn := range fns {
+		s, as, err := readState(fn, so)
+		if err == nil && 0 < len(ass) && !spec.compatible(s) {
+			err = errors.New("state is not compatible with the first state file. --group-by, --fields, --window and --unit must be the same.")
+		}
+		if err != nil {
+			ierr = append(ierr, fileError{fileName: fn, err: err})
+			continue
+		}
+		if len(ass) < 1 {
+			spec = s
+			first = fn
+		}
+		ass = append(ass, as)
+	}
+
+	var ovs []options.OutValues
+	if 0 < len(ass) {
+		o, err := spec.apply(opts)
+		if err == nil {
+			var merged []accumulated
+			merged, err = mergeAccumulated(ass, o)
+			if err == nil && 1 < len(spec.FieldIndexes) {
+				spec.setFields(fieldsOf(merged))
+			}
+			if err == nil && o.EmitState != "" {
+				if err := writeState(o.EmitState, merged, spec); err != nil {
+					ierr = append(ierr, fileError{fileName: o.EmitState, err: err})
+				}
+			}
+			if err == nil {
+				ovs, err = newOutValues(merged, o)
+			}
+		}
+		if err != nil {
+			ierr = append(ierr, fileError{fileName: first, err: err})
+		}
+	}
+	if 0 < len(ierr) {
+		return ovs, spec, ierr
+	}
+	return ovs, spec, nil
+}
@@ -0,0 +1,226 @@
+// Package stats は値を1件ずつ受け取り、件数、最小値、最大値、合計値、平均値、
+// 中央値、パーセンタイル値、分散、標準偏差を逐次集計する。
+// arthコマンドの集計もこのパッケージで行うため、コマンドと同じ結果になる。
+//
+//	a := stats.New(stats.Options{Median: true, Percentiles: []float64{95, 99}})
+//	for _, n := range latencies {
+//		a.Add(n)
+//	}
+//	r := a.Result()
+//	fmt.Println(r.Count, r.Average, r.Percentiles[99])
+package stats
+
+import (
+	"errors"
+	"math"
+
+	arthmath "github.com/jiro4989/arth/math"
+)
+
+// QuantileMethod は中央値、パーセンタイル値の算出方法です。
+type QuantileMethod = arthmath.QuantileMethod
+
+const (
+	// QuantileLegacy はarthの従来の算出方法です。
+	QuantileLegacy = arthmath.QuantileLegacy
+	// QuantileNearestRank は最近順位法です。
+	QuantileNearestRank = arthmath.QuantileNearestRank
+	// QuantileLinear は線形補間です。RのType7、numpy、Excelのデフォルトと同じ。
+	QuantileLinear = arthmath.QuantileLinear
+	// QuantileMidpoint は前後の値の中点です。
+	QuantileMidpoint = arthmath.QuantileMidpoint
+	// QuantileLower は前後の値のうち小さい方です。
+	QuantileLower = arthmath.QuantileLower
+	// QuantileHigher は前後の値のうち大きい方です。
+	QuantileHigher = arthmath.QuantileHigher
+)
+
+// Options は件数、最小値、最大値、合計値、平均値以外に算出する統計値の指定です。
+// ゼロ値のときは件数、最小値、最大値、合計値、平均値のみを算出し、データを保持しない。
+type Options struct {
+	// Median は中央値を算出するか否かです。
+	Median bool
+	// Percentiles は算出するパーセンタイル(0より大きく100以下)の一覧です。
+	Percentiles []float64
+	// Variance は分散と標準偏差を算出するか否かです。
+	Variance bool
+	// Method は中央値、パーセンタイル値の算出方法です。空のときはQuantileLegacyです。
+	Method QuantileMethod
+	// Approx は中央値、パーセンタイル値をデータを保持せずにt-digestで近似するか否かです。
+	// trueのときはデータ数によらず一定のメモリで集計できる。
+	Approx bool
+	// KeepValues は中央値、パーセンタイル値を算出しないときも、
+	// 追加したデータをValuesで参照できるように保持するか否かです。
+	// Approxがtrueのときは保持しない。
+	KeepValues bool
+	// Sorted は値が昇順に追加されるか否かです。
+	// trueのときは中央値、パーセンタイル値の算出でデータを並べ替えない。
+	Sorted bool
+}
+
+// NeedValues は統計値の算出にデータの保持、あるいは近似が必要か否かを返す。
+func (o Options) NeedValues() bool {
+	return o.Median || 0 < len(o.Percentiles) || o.KeepValues
+}
+
+// Result は集計結果の統計値です。
+// Optionsで指定していない統計値は0、Percentilesはnilになる。
+type Result struct {
+	Count   int
+	Min     float64
+	Max     float64
+	Sum     float64
+	Average float64
+	Median  float64
+	// Percentiles はパーセンタイルをキーとしたパーセンタイル値です。
+	Percentiles map[float64]float64
+	// Variance は母分散です。
+	Variance float64
+	// SampleVariance は標本分散(不偏分散)です。
+	SampleVariance float64
+	// StdDev は母集団の標準偏差です。
+	StdDev float64
+	// SampleStdDev は標本標準偏差です。
+	SampleStdDev float64
+}
+
+// Accumulator は値を1件ずつ受け取って集計する。
+// 並行して使うときは呼び出し側で排他する。
+type Accumulator struct {
+	opts Options
+	acc  *arthmath.Accumulator
+}
+
+// New はOptionsの統計値を算出するAccumulatorを生成する。
+func New(opts Options) *Accumulator {
+	acc := arthmath.NewAccumulator(opts.NeedValues() && !opts.Approx)
+	if opts.Approx && opts.NeedValues() {
+		acc = arthmath.NewSketchAccumulator(arthmath.DefaultCompression)
+	}
+	return Wrap(acc, opts)
+}
+
+// Wrap は集計済みのarthmath.Accumulatorから、Optionsの統計値を算出するAccumulatorを生成する。
+// arthmathの入力を読み込む関数で集計した結果に使う。
+// 中央値、パーセンタイル値は、accがスケッチを持てばスケッチから近似し、
+// なければ保持したデータから算出する。
+func Wrap(acc *arthmath.Accumulator, opts Options) *Accumulator {
+	return &Accumulator{opts: opts, acc: acc}
+}
+
+// Add は値を1件集計する。
+func (a *Accumulator) Add(n float64) {
+	a.acc.Add(n)
+}
+
+// Merge は別のAccumulatorの集計結果を併合する。引数のAccumulatorは変更しない。
+// すべての値を1つのAccumulatorにAddした場合と同じ結果になる(分散の浮動小数点の誤差を除く)。
+// 一方のみが近似するときは、データを保持する側もスケッチに切り替えて近似する。
+// 中央値、パーセンタイル値を算出するのに、bがデータもスケッチも持たないときはエラーを返す。
+// データは連結するだけなので、両方にデータがあるときはSortedの指定を解除する。
+func (a *Accumulator) Merge(b *Accumulator) error {
+	sorted := a.opts.Sorted && (a.acc.Count == 0 || b.acc.Count == 0)
+	if err := a.acc.Merge(b.acc); err != nil {
+		return err
+	}
+	a.opts.Sorted = sorted
+	return nil
+}
+
+// Count は集計したデータ数を返す。
+func (a *Accumulator) Count() int {
+	return a.acc.Count
+}
+
+// Values は保持しているデータを返す。データを保持しないときはnilを返す。
+// Resultの算出で並べ替えるため、順番は追加した順とは限らない。
+func (a *Accumulator) Values() []float64 {
+	return a.acc.Values
+}
+
+// MarshalBinary は集計結果を、別のプロセスやマシンで併合できるバイナリ形式にする。
+// 件数、最小値、最大値、合計値、分散の計算に必要な値と、中央値、パーセンタイル値を
+// 近似するスケッチを含める。データを保持しているときは、データからスケッチを生成する。
+func (a *Accumulator) MarshalBinary() ([]byte, error) {
+	return a.acc.MarshalBinary()
+}
+
+// UnmarshalBinary はMarshalBinaryの集計結果を復元する。統計値はレシーバのOptionsで算出する。
+// 復元したAccumulatorはデータを保持しないため、中央値、パーセンタイル値はスケッチから近似する。
+// 中央値、パーセンタイル値を算出するのに、集計結果がスケッチを持たないときはエラーを返す。
+func (a *Accumulator) UnmarshalBinary(b []byte) error {
+	acc := &arthmath.Accumulator{}
+	if err := acc.UnmarshalBinary(b); err != nil {
+		return err
+	}
+	if (a.opts.Median || 0 < len(a.opts.Percentiles)) && 0 < acc.Count && acc.Sketch == nil {
+		return errors.New("no sketch for median and percentiles.")
+	}
+	a.acc = acc
+	return nil
+}
+
+// Result はそれまでに集計した値の統計値を返す。
+// 中央値、パーセンタイル値は必要な位置の値のみを選択して算出する。
+// 呼び出したあとも値の追加、併合を続けられる。
+func (a *Accumulator) Result() Result {
+	acc := a.acc
+	r := Result{
+		Count:   acc.Count,
+		Min:     acc.Min,
+		Max:     acc.Max,
+		Sum:     acc.Sum,
+		Average: acc.Average(),
+	}
+
+	// 分散と標準偏差
+	if a.opts.Variance {
+		r.Variance = acc.Variance()
+		r.SampleVariance = arthmath.SampleVariance(r.Variance, r.Count)
+		r.StdDev = math.Sqrt(r.Variance)
+		r.SampleStdDev = math.Sqrt(r.SampleVariance)
+	}
+
+	// 近似するときはソートしない
+	if acc.Sketch != nil {
+		if a.opts.Median {
+			r.Median = acc.Sketch.Quantile(50)
+		}
+		if 0 < len(a.opts.Percentiles) {
+			r.Percentiles = make(map[float64]float64, len(a.opts.Percentiles))
+			for _, p := range a.opts.Percentiles {
+				r.Percentiles[p] = acc.Sketch.Quantile(p)
+			}
+		}
+		return r
+	}
+
+	// ソート済みでなければ、必要な位置の値だけを選択する(高速化)
+	// 中央値、パーセンタイル値が複数指定されていても1回でまとめて選択する
+	ns := acc.Values
+	m := a.opts.Method
+	if !a.opts.Sorted {
+		var ks []int
+		if a.opts.Median {
+			ks = append(ks, arthmath.MedianIndices(len(ns), m)...)
+		}
+		for _, p := range a.opts.Percentiles {
+			ks = append(ks, arthmath.QuantileIndices(len(ns), p, m)...)
+		}
+		arthmath.Select(ns, ks)
+	}
+
+	// 中央値
+	if a.opts.Median {
+		r.Median = arthmath.MedianBy(ns, m)
+	}
+
+	// パーセンタイル値
+	if 0 < len(a.opts.Percentiles) {
+		r.Percentiles = make(map[float64]float64, len(a.opts.Percentiles))
+		for _, p := range a.opts.Percentiles {
+			r.Percentiles[p] = arthmath.Quantile(ns, p, m)
+		}
+	}
+	return r
+}
@@ -0,0 +1,233 @@
+package stats
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type TestResultData struct {
+	desc   string
+	opts   Options
+	in     []float64
+	expect Result
+}
+
+func TestResult(t *testing.T) {
+	in := []float64{5, 1, 4, 2, 3}
+	tds := []TestResultData{
+		TestResultData{
+			desc:   "ゼロ値のOptions",
+			in:     in,
+			expect: Result{Count: 5, Min: 1, Max: 5, Sum: 15, Average: 3},
+		},
+		TestResultData{
+			desc: "中央値、パーセンタイル値、分散",
+			opts: Options{Median: true, Percentiles: []float64{50, 95}, Variance: true},
+			in:   in,
+			expect: Result{
+				Count: 5, Min: 1, Max: 5, Sum: 15, Average: 3, Median: 3,
+				Percentiles:    map[float64]float64{50: 2, 95: 4},
+				Variance:       2,
+				SampleVariance: 2.5,
+				StdDev:         1.4142135623730951,
+				SampleStdDev:   1.5811388300841898,
+			},
+		},
+		TestResultData{
+			desc: "線形補間",
+			opts: Options{Median: true, Percentiles: []float64{95}, Method: QuantileLinear},
+			in:   []float64{4, 1, 3, 2},
+			expect: Result{
+				Count: 4, Min: 1, Max: 4, Sum: 10, Average: 2.5, Median: 2.5,
+				Percentiles: map[float64]float64{95: 3.85},
+			},
+		},
+		TestResultData{
+			desc:   "ソート済み",
+			opts:   Options{Median: true, Sorted: true},
+			in:     []float64{1, 2, 3, 4, 5},
+			expect: Result{Count: 5, Min: 1, Max: 5, Sum: 15, Average: 3, Median: 3},
+		},
+		TestResultData{
+			desc:   "データなし",
+			opts:   Options{Median: true, Percentiles: []float64{99}, Variance: true},
+			expect: Result{Percentiles: map[float64]float64{99: 0}},
+		},
+	}
+	for _, v := range tds {
+		a := New(v.opts)
+		for _, n := range v.in {
+			a.Add(n)
+		}
+		got := a.Result()
+		assert.InDelta(t, v.expect.Percentiles[95], got.Percentiles[95], 1e-9, v.desc)
+		got.Percentiles = v.expect.Percentiles
+		assert.Equal(t, v.expect, got, v.desc)
+	}
+}
+
+func TestResultContinue(t *testing.T) {
+	// 結果を算出したあとも値を追加できる
+	a := New(Options{Median: true})
+	for _, n := range []float64{3, 1, 2} {
+		a.Add(n)
+	}
+	assert.Equal(t, 2.0, a.Result().Median)
+	a.Add(10)
+	a.Add(11)
+	assert.Equal(t, 5, a.Count())
+	assert.Equal(t, 3.0, a.Result().Median)
+	assert.Equal(t, 5, len(a.Values()))
+}
+
+func TestMerge(t *testing.T) {
+	opts := Options{Median: true, Percentiles: []float64{90}, Variance: true}
+	all := New(opts)
+	a := New(opts)
+	b := New(opts)
+	for i := 1; i <= 100; i++ {
+		n := float64(i * 7 % 101)
+		all.Add(n)
+		if i%3 == 0 {
+			a.Add(n)
+		} else {
+			b.Add(n)
+		}
+	}
+	assert.NoError(t, a.Merge(b))
+	want := all.Result()
+	got := a.Result()
+	assert.InDelta(t, want.Variance, got.Variance, 1e-9)
+	assert.InDelta(t, want.StdDev, got.StdDev, 1e-9)
+	got.Variance, got.SampleVariance = want.Variance, want.SampleVariance
+	got.StdDev, got.SampleStdDev = want.StdDev, want.SampleStdDev
+	assert.Equal(t, want, got)
+	// 引数のAccumulatorは変更しない
+	assert.Equal(t, 67, b.Count())
+
+	// ソート済みのデータ同士を併合しても、連結したデータはソート済みではない
+	sopts := Options{Median: true, Sorted: true}
+	s1 := New(sopts)
+	s2 := New(sopts)
+	for i := 1; i <= 5; i++ {
+		s1.Add(float64(i))
+		s2.Add(float64(i))
+	}
+	assert.NoError(t, s1.Merge(s2))
+	assert.Equal(t, 3.0, s1.Result().Median)
+
+	// 空のAccumulatorへの併合はソート済みのまま
+	s3 := New(sopts)
+	assert.NoError(t, s3.Merge(s2))
+	assert.True(t, s3.opts.Sorted)
+}
+
+func TestApprox(t *testing.T) {
+	a := New(Options{Median: true, Percentiles: []float64{99}, Approx: true})
+	b := New(Options{Median: true, Percentiles: []float64{99}, Approx: true})
+	for i := 1; i <= 10000; i++ {
+		if i%2 == 0 {
+			a.Add(float64(i))
+		} else {
+			b.Add(float64(i))
+		}
+	}
+	assert.NoError(t, a.Merge(b))
+	r := a.Result()
+	// データは保持しない
+	assert.Nil(t, a.Values())
+	assert.Equal(t, 10000, r.Count)
+	assert.InDelta(t, 5000, r.Median, 50)
+	assert.InDelta(t, 9900, r.Percentiles[99], 50)
+
+	// 中央値、パーセンタイル値がなければデータを保持しない
+	assert.False(t, Options{Variance: true}.NeedValues())
+	assert.True(t, Options{KeepValues: true}.NeedValues())
+	c := New(Options{KeepValues: true})
+	c.Add(1)
+	assert.Equal(t, []float64{1}, c.Values())
+}
+
+func TestMarshalBinary(t *testing.T) {
+	opts := Options{Median: true, Percentiles: []float64{99}, Variance: true}
+	all := New(opts)
+	var merged *Accumulator
+	for i := 0; i < 4; i++ {
+		part := New(opts)
+		for j := 1; j <= 2500; j++ {
+			n := float64(j*4 - i)
+			part.Add(n)
+			all.Add(n)
+		}
+		b, err := part.MarshalBinary()
+		assert.NoError(t, err)
+
+		// 別のプロセスで復元して併合したものとみなす
+		restored := New(opts)
+		assert.NoError(t, restored.UnmarshalBinary(b))
+		if merged == nil {
+			merged = restored
+			continue
+		}
+		assert.NoError(t, merged.Merge(restored))
+	}
+
+	want := all.Result()
+	got := merged.Result()
+	assert.Equal(t, want.Count, got.Count)
+	assert.Equal(t, want.Min, got.Min)
+	assert.Equal(t, want.Max, got.Max)
+	assert.Equal(t, want.Sum, got.Sum)
+	assert.Equal(t, want.Average, got.Average)
+	assert.InDelta(t, want.Variance, got.Variance, 1e-6)
+	// 中央値、パーセンタイル値はスケッチから近似する
+	assert.Nil(t, merged.Values())
+	assert.InDelta(t, want.Median, got.Median, 50)
+	assert.InDelta(t, want.Percentiles[99], got.Percentiles[99], 50)
+
+	assert.Error(t, merged.UnmarshalBinary([]byte{1}))
+	assert.Equal(t, 10000, merged.Count())
+
+	// スケッチを持たない集計結果からは中央値を算出できない
+	b, err := New(Options{}).MarshalBinary()
+	assert.NoError(t, err)
+	assert.NoError(t, New(opts).UnmarshalBinary(b))
+	noSketch := New(Options{})
+	noSketch.Add(1)
+	b, err = noSketch.MarshalBinary()
+	assert.NoError(t, err)
+	assert.Error(t, New(opts).UnmarshalBinary(b))
+	assert.NoError(t, New(Options{Variance: true}).UnmarshalBinary(b))
+}
+
+func TestMergeApprox(t *testing.T) {
+	opts := Options{Median: true}
+	exact := New(opts)
+	approx := New(Options{Median: true, Approx: true})
+	for i := 1; i <= 100; i++ {
+		if i%2 == 0 {
+			exact.Add(float64(i))
+		} else {
+			approx.Add(float64(i))
+		}
+	}
+	// 近似する側にデータを併合する
+	a := New(Options{Median: true, Approx: true})
+	assert.NoError(t, a.Merge(approx))
+	assert.NoError(t, a.Merge(exact))
+	assert.Equal(t, 100, a.Count())
+	assert.InDelta(t, 50.5, a.Result().Median, 1)
+
+	// データを保持する側は近似に切り替える
+	assert.NoError(t, exact.Merge(approx))
+	assert.Nil(t, exact.Values())
+	assert.Equal(t, 100, exact.Count())
+	assert.InDelta(t, 50.5, exact.Result().Median, 1)
+
+	// 中央値を算出しない集計結果は併合できない
+	none := New(Options{})
+	none.Add(1)
+	assert.Error(t, a.Merge(none))
+	assert.Equal(t, 100, a.Count())
+}
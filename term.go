@@ -0,0 +1,15 @@
+package main
+
+import (
+	"os"
+	"strconv"
+)
+
+// columnsEnv は環境変数COLUMNSの端末の幅を返す。未設定、不正な値のときは0を返す。
+func columnsEnv() int {
+	n, err := strconv.Atoi(os.Getenv("COLUMNS"))
+	if err != nil || n < 1 {
+		return 0
+	}
+	return n
+}
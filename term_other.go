@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package main
+
+// terminalWidth は環境変数COLUMNSから端末の幅を返す。
+// この環境では端末の幅を問い合わせないため、COLUMNSがなければ0を返す。
+func terminalWidth() int {
+	return columnsEnv()
+}
@@ -0,0 +1,32 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// winsize はioctlのTIOCGWINSZで取得する端末の大きさです。
+type winsize struct {
+	Row    uint16
+	Col    uint16
+	Xpixel uint16
+	Ypixel uint16
+}
+
+// terminalWidth は標準出力の端末の幅を返す。
+// 標準出力が端末でなければ環境変数COLUMNSを使い、それもなければ0を返す。
+func terminalWidth() int {
+	var ws winsize
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL,
+		os.Stdout.Fd(),
+		uintptr(syscall.TIOCGWINSZ),
+		uintptr(unsafe.Pointer(&ws)))
+	if errno == 0 && 0 < ws.Col {
+		return int(ws.Col)
+	}
+	return columnsEnv()
+}